@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chrissnell/gophertrak/draw"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Alert rules
+const (
+	rulePayloadSilent     = "payload_silent"      // Threshold: minutes
+	ruleBurst             = "burst"               //
+	ruleDescentBelow      = "descent_below"       // Threshold: feet
+	ruleBatteryLow        = "battery_low"         // Threshold: volts
+	ruleTNCDisconnected   = "tnc_disconnected"    //
+	ruleGPSDisconnected   = "gps_disconnected"    //
+	ruleMessageReceived   = "message_received"    //
+	ruleChaserNearLanding = "chaser_near_landing" // Threshold: miles
+)
+
+// Bursts show up as a fall of at least this many feet from the peak altitude,
+// coming down faster than burstRate ft/min
+const (
+	burstDrop = 1000
+	burstRate = -1000
+)
+
+// Until the TNC or GPS has connected once, or disconnectGrace has gone by,
+// it not being connected is just us starting up
+const disconnectGrace = time.Minute
+
+// AlertConfig is an alert rule from the config file.  Every alert shows a
+// banner; Bell and Command add to that.  Command is run by the shell with
+// GOPHERTRAK_ALERT and GOPHERTRAK_MESSAGE set.
+type AlertConfig struct {
+	Rule      string  `yaml:"rule"`
+	Threshold float64 `yaml:"threshold"`
+	Bell      bool    `yaml:"bell"`
+	Command   string  `yaml:"command"`
+}
+
+var defaultAlerts = []AlertConfig{
+	{Rule: rulePayloadSilent, Threshold: 5, Bell: true},
+	{Rule: ruleBurst, Bell: true},
+	{Rule: ruleTNCDisconnected, Bell: true},
+	{Rule: ruleGPSDisconnected, Bell: true},
+	{Rule: ruleMessageReceived, Bell: true},
+	{Rule: ruleChaserNearLanding, Threshold: 1},
+}
+
+// Alert is something that happened that someone should know about
+type Alert struct {
+	ID    int       `json:"id"`
+	Rule  string    `json:"rule"`
+	Text  string    `json:"text"`
+	Time  time.Time `json:"time"`
+	Acked bool      `json:"acked"`
+}
+
+// alertRule is a rule and whether its condition held last time we checked.
+// Alerts fire when a condition becomes true and can't fire again until it's
+// gone false.
+type alertRule struct {
+	AlertConfig
+	active bool
+}
+
+type alertEngine struct {
+	mu        sync.Mutex
+	rules     []*alertRule
+	alerts    []Alert
+	nextID    int
+	listeners []func(Alert)
+
+	a       *APRSTNC
+	g       PositionSource
+	battery BatteryConfig
+
+	// State for burst detection
+	peakAlt float64
+	burst   bool
+
+	// When we started, and whether the TNC and GPS have ever been connected
+	started time.Time
+	tncUp   bool
+	gpsUp   bool
+}
+
+func newAlertEngine(cfgs []AlertConfig, battery BatteryConfig, a *APRSTNC, g PositionSource) (*alertEngine, error) {
+	if cfgs == nil {
+		cfgs = defaultAlerts
+	}
+
+	e := &alertEngine{a: a, g: g, battery: battery, started: time.Now()}
+	for _, c := range cfgs {
+		switch c.Rule {
+		case rulePayloadSilent, ruleDescentBelow, ruleBatteryLow, ruleChaserNearLanding:
+			if c.Threshold <= 0 {
+				return nil, fmt.Errorf("alert %v needs a threshold", c.Rule)
+			}
+		case ruleBurst, ruleTNCDisconnected, ruleGPSDisconnected, ruleMessageReceived:
+		default:
+			return nil, fmt.Errorf("unknown alert rule %q", c.Rule)
+		}
+		if c.Rule == ruleBatteryLow && battery.Channel == 0 {
+			return nil, fmt.Errorf("alert %v needs a battery channel to be configured", c.Rule)
+		}
+		e.rules = append(e.rules, &alertRule{AlertConfig: c})
+	}
+
+	return e, nil
+}
+
+// Subscribe calls f, from the alert engine's goroutine, for every alert that fires
+func (e *alertEngine) Subscribe(f func(Alert)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.listeners = append(e.listeners, f)
+}
+
+// Run checks the rules every second
+func (e *alertEngine) Run(ctx context.Context) {
+	for {
+		e.checkRules()
+
+		if !sleep(ctx, 1*time.Second) {
+			return
+		}
+	}
+}
+
+// checkRules fires the alerts whose conditions have come true since we last
+// checked
+func (e *alertEngine) checkRules() {
+	e.trackBurst()
+
+	for _, r := range e.rules {
+		if r.Rule == ruleMessageReceived {
+			continue
+		}
+		on, text := e.check(r)
+		if on && !r.active {
+			e.fire(r.AlertConfig, text)
+		}
+		r.active = on
+	}
+
+	e.checkMessages()
+}
+
+// trackBurst watches the balloon's altitude for the fall that follows a burst
+func (e *alertEngine) trackBurst() {
+	lp, ok := e.a.LastPosition(balloonCallsign())
+	if !ok {
+		return
+	}
+
+	alt := lp.data.Position.Altitude
+	if alt > e.peakAlt {
+		e.peakAlt = alt
+	}
+
+	rate, ok := verticalRate(e.a.TrackAsSlice())
+	if ok && !e.burst && rate < burstRate && e.peakAlt-alt > burstDrop {
+		e.burst = true
+	}
+}
+
+// check reports whether a rule's condition holds, and what to say about it
+func (e *alertEngine) check(r *alertRule) (bool, string) {
+	bl := balloonCallsign()
+
+	switch r.Rule {
+	case rulePayloadSilent:
+		lp, ok := e.a.LastPacket(bl)
+		if !ok {
+			return false, ""
+		}
+		age := time.Since(lp.ts)
+		return age > time.Duration(r.Threshold*float64(time.Minute)),
+			fmt.Sprintf("Payload %v not heard for %v", bl, shortDuration(age))
+
+	case ruleBurst:
+		return e.burst, fmt.Sprintf("Burst detected at %v", units().Altitude.Format(e.peakAlt))
+
+	case ruleDescentBelow:
+		lp, ok := e.a.LastPosition(bl)
+		rate, rok := verticalRate(e.a.TrackAsSlice())
+		if !ok || !rok || rate >= 0 {
+			return false, ""
+		}
+		alt := lp.data.Position.Altitude
+		return alt < r.Threshold, fmt.Sprintf("Payload descending through %v", units().Altitude.Format(alt))
+
+	case ruleBatteryLow:
+		v, ok := batteryVoltage(e.a, e.battery)
+		return ok && v < r.Threshold, fmt.Sprintf("Payload battery low: %.2f V", v)
+
+	case ruleTNCDisconnected:
+		up := e.a.IsConnected()
+		e.tncUp = e.tncUp || up
+		return !up && e.armed(e.tncUp), disconnectedText("TNC", e.tncUp)
+
+	case ruleGPSDisconnected:
+		up := e.g.IsReady()
+		e.gpsUp = e.gpsUp || up
+		return !up && e.armed(e.gpsUp), disconnectedText("GPS", e.gpsUp)
+
+	case ruleChaserNearLanding:
+		me := e.g.Position()
+		pred, ok := e.a.PredictedLanding(me.Altitude)
+		if !ok {
+			return false, ""
+		}
+		if me.Lat != 0 && me.GreatCircleDistanceTo(pred.Point) < r.Threshold {
+			return true, fmt.Sprintf("We are within %v of the predicted landing", units().Distance.Format(r.Threshold))
+		}
+		for _, c := range sortedChaserCallsigns() {
+			if lp, ok := e.a.LastPosition(c); ok {
+				if d := lp.data.Position.GreatCircleDistanceTo(pred.Point); d < r.Threshold {
+					return true, fmt.Sprintf("%v is %v from the predicted landing", c, units().Distance.Format(d))
+				}
+			}
+		}
+	}
+
+	return false, ""
+}
+
+// armed reports whether a disconnect is worth an alert: once something has
+// been connected, or when it's had long enough to connect
+func (e *alertEngine) armed(beenUp bool) bool {
+	return beenUp || time.Since(e.started) > disconnectGrace
+}
+
+func disconnectedText(name string, beenUp bool) string {
+	if !beenUp {
+		return name + " has not connected"
+	}
+	return name + " disconnected"
+}
+
+// checkMessages fires an alert for each message sent to us since we last looked
+func (e *alertEngine) checkMessages() {
+	for {
+		select {
+		case pp := <-e.a.inbox:
+			for _, r := range e.rules {
+				if r.Rule == ruleMessageReceived {
+					e.fire(r.AlertConfig, fmt.Sprintf("Message from %v: %v", pp.pkt.Source.String(), pp.data.Message.Text))
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (e *alertEngine) fire(c AlertConfig, text string) {
+	e.mu.Lock()
+	e.nextID++
+	al := Alert{ID: e.nextID, Rule: c.Rule, Text: text, Time: time.Now()}
+	e.alerts = append(e.alerts, al)
+	listeners := e.listeners
+	e.mu.Unlock()
+
+	log.Printf("ALERT: %v", text)
+
+	if c.Bell {
+		draw.Beep()
+	}
+
+	if c.Command != "" {
+		go runAlertCommand(c.Command, al)
+	}
+
+	for _, f := range listeners {
+		f(al)
+	}
+}
+
+func runAlertCommand(command string, al Alert) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Env = append(os.Environ(), "GOPHERTRAK_ALERT="+al.Rule, "GOPHERTRAK_MESSAGE="+al.Text)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Printf("Alert command %q failed: %v: %s", command, err, out)
+	}
+}
+
+// Alerts returns every alert that's fired, newest first
+func (e *alertEngine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	list := make([]Alert, len(e.alerts))
+	for i, al := range e.alerts {
+		list[len(e.alerts)-1-i] = al
+	}
+	return list
+}
+
+// Unacked returns the alerts nobody's acknowledged yet, newest first
+func (e *alertEngine) Unacked() []Alert {
+	var list []Alert
+	for _, al := range e.Alerts() {
+		if !al.Acked {
+			list = append(list, al)
+		}
+	}
+	return list
+}
+
+// Ack acknowledges the alert with the given ID.  It returns false if there
+// isn't one.
+func (e *alertEngine) Ack(id int) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.alerts {
+		if e.alerts[i].ID == id {
+			e.alerts[i].Acked = true
+			return true
+		}
+	}
+	return false
+}
+
+func (e *alertEngine) AckAll() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := range e.alerts {
+		e.alerts[i].Acked = true
+	}
+}
+
+// batteryVoltage works out the payload's battery voltage from its last telemetry
+func batteryVoltage(a *APRSTNC, bc BatteryConfig) (float64, bool) {
+	if bc.Channel < 1 || bc.Channel > 5 {
+		return 0, false
+	}
+	if bc.Scale == 0 {
+		// Not set in the config, so the channel reads in volts
+		bc.Scale = 1
+	}
+
+	for _, v := range a.TrackAsSlice() {
+		var ch []float64
+		st, ct := v.data.StandardTelemetry, v.data.CompressedTelemetry
+		if st.A1 != 0 || st.A2 != 0 || st.A3 != 0 || st.A4 != 0 || st.A5 != 0 {
+			ch = []float64{float64(st.A1), float64(st.A2), float64(st.A3), float64(st.A4), float64(st.A5)}
+		} else if ct.A1 != 0 || ct.A2 != 0 || ct.A3 != 0 || ct.A4 != 0 || ct.A5 != 0 {
+			ch = []float64{float64(ct.A1), float64(ct.A2), float64(ct.A3), float64(ct.A4), float64(ct.A5)}
+		} else {
+			continue
+		}
+		return ch[bc.Channel-1]*bc.Scale + bc.Offset, true
+	}
+	return 0, false
+}
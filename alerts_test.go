@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"github.com/chrissnell/GoBalloon/aprs"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"testing"
+	"time"
+)
+
+func TestAck(t *testing.T) {
+	e := &alertEngine{}
+	for _, text := range []string{"first", "second", "third"} {
+		e.fire(AlertConfig{Rule: ruleBurst}, text)
+	}
+
+	if !e.Ack(2) {
+		t.Fatal("Ack(2) = false, want true")
+	}
+	if e.Ack(4) {
+		t.Error("Ack(4) = true for an alert that doesn't exist")
+	}
+
+	var got []string
+	for _, al := range e.Unacked() {
+		got = append(got, al.Text)
+	}
+	if len(got) != 2 || got[0] != "third" || got[1] != "first" {
+		t.Errorf("unacknowledged alerts are %v, want [third first]", got)
+	}
+
+	e.AckAll()
+	if n := len(e.Unacked()); n != 0 {
+		t.Errorf("%v alerts unacknowledged after AckAll", n)
+	}
+}
+
+func TestBatteryVoltage(t *testing.T) {
+	a := newAPRSTNC()
+	pp := PayloadPacket{ts: time.Now()}
+	pp.data.StandardTelemetry = aprs.StandardTelemetryReport{A1: 200, A2: 12}
+	a.track.Push(pp)
+
+	tests := []struct {
+		bc   BatteryConfig
+		want float64
+		ok   bool
+	}{
+		{BatteryConfig{Channel: 2}, 12, true},
+		{BatteryConfig{Channel: 1, Scale: 0.02, Offset: 0.5}, 4.5, true},
+		{BatteryConfig{Channel: 0}, 0, false},
+		{BatteryConfig{Channel: 6, Scale: 1}, 0, false},
+	}
+
+	for _, tt := range tests {
+		v, ok := batteryVoltage(a, tt.bc)
+		if ok != tt.ok || v != tt.want {
+			t.Errorf("batteryVoltage(%+v) = %v, %v, want %v, %v", tt.bc, v, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// fakePosition is a PositionSource that's wherever, and as ready as, we say
+type fakePosition struct {
+	pos   geospatial.Point
+	ready bool
+}
+
+func (f *fakePosition) Start(ctx context.Context)  {}
+func (f *fakePosition) Position() geospatial.Point { return f.pos }
+func (f *fakePosition) Fix() Fix                   { return Fix{} }
+func (f *fakePosition) IsReady() bool              { return f.ready }
+func (f *fakePosition) Address() string            { return "fake" }
+
+// testAlerts is an alert engine with just the given rules, watching a TNC and
+// GPS that haven't connected yet
+func testAlerts(t *testing.T, rules ...AlertConfig) (*alertEngine, *APRSTNC, *fakePosition) {
+	t.Helper()
+	setupFlight(t)
+
+	a := newAPRSTNC()
+	g := &fakePosition{}
+	e, err := newAlertEngine(rules, BatteryConfig{}, a, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e, a, g
+}
+
+// fired checks the rules and returns the text of the alerts that fired
+func fired(e *alertEngine) []string {
+	before := len(e.Alerts())
+	e.checkRules()
+
+	var texts []string
+	for _, al := range e.Alerts()[:len(e.Alerts())-before] {
+		texts = append(texts, al.Text)
+	}
+	return texts
+}
+
+// hearBalloon hears the balloon at each altitude in turn, 30 seconds apart and
+// ending at end
+func hearBalloon(t *testing.T, a *APRSTNC, end time.Time, alts ...float64) {
+	t.Helper()
+	for i, alt := range alts {
+		ts := end.Add(time.Duration(i-len(alts)+1) * 30 * time.Second)
+		hear(t, a, balloonCallsign(), geospatial.Point{Lat: 47.65, Lon: -122.3, Altitude: alt}, ts)
+	}
+}
+
+func TestPayloadSilent(t *testing.T) {
+	e, a, _ := testAlerts(t, AlertConfig{Rule: rulePayloadSilent, Threshold: 5})
+
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v before we've heard the payload", got)
+	}
+
+	hearBalloon(t, a, time.Now().Add(-4*time.Minute), 30000)
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v after 4 minutes of silence", got)
+	}
+
+	hearBalloon(t, a, time.Now().Add(-6*time.Minute), 30000)
+	if got := fired(e); len(got) != 1 || got[0] != "Payload N0CALL-11 not heard for 6m0s" {
+		t.Errorf("alerts %v after 6 minutes of silence", got)
+	}
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v again while still silent", got)
+	}
+
+	// Hearing it again rearms the alert
+	hearBalloon(t, a, time.Now(), 30000)
+	fired(e)
+	hearBalloon(t, a, time.Now().Add(-6*time.Minute), 30000)
+	if got := fired(e); len(got) != 1 {
+		t.Errorf("alerts %v after the payload went silent a second time", got)
+	}
+}
+
+func TestBurst(t *testing.T) {
+	e, a, _ := testAlerts(t, AlertConfig{Rule: ruleBurst})
+	now := time.Now()
+
+	hearBalloon(t, a, now.Add(-150*time.Second), 30000, 31000, 32000)
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v while climbing", got)
+	}
+
+	// A slow sink from the peak is just a wobble
+	hearBalloon(t, a, now.Add(-90*time.Second), 31900, 31800)
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v for a 200 foot wobble", got)
+	}
+
+	hearBalloon(t, a, now.Add(-30*time.Second), 30000, 28000)
+	if got := fired(e); len(got) != 1 || got[0] != "Burst detected at 32,000 feet" {
+		t.Errorf("alerts %v after falling 4,000 feet", got)
+	}
+	hearBalloon(t, a, now, 26000)
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v for the same burst", got)
+	}
+}
+
+func TestDescentBelow(t *testing.T) {
+	e, a, _ := testAlerts(t, AlertConfig{Rule: ruleDescentBelow, Threshold: 10000})
+	now := time.Now()
+
+	hearBalloon(t, a, now.Add(-time.Minute), 8000, 9000, 9500)
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v climbing through 9,500 feet", got)
+	}
+
+	hearBalloon(t, a, now, 12000, 10500, 9500)
+	if got := fired(e); len(got) != 1 || got[0] != "Payload descending through 9,500 feet" {
+		t.Errorf("alerts %v descending through 9,500 feet", got)
+	}
+}
+
+// Nothing's connected when we start, and that's not worth an alert
+func TestDisconnectedAtStartup(t *testing.T) {
+	e, a, g := testAlerts(t, AlertConfig{Rule: ruleTNCDisconnected}, AlertConfig{Rule: ruleGPSDisconnected})
+
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v at startup", got)
+	}
+
+	a.Connected(true)
+	g.ready = true
+	if got := fired(e); len(got) != 0 {
+		t.Errorf("alerts %v once connected", got)
+	}
+
+	a.Connected(false)
+	if got := fired(e); len(got) != 1 || got[0] != "TNC disconnected" {
+		t.Errorf("alerts %v when the TNC went away", got)
+	}
+
+	g.ready = false
+	if got := fired(e); len(got) != 1 || got[0] != "GPS disconnected" {
+		t.Errorf("alerts %v when the GPS went away", got)
+	}
+}
+
+// Something that never connects is reported once the grace period is up
+func TestNeverConnected(t *testing.T) {
+	e, _, _ := testAlerts(t, AlertConfig{Rule: ruleTNCDisconnected}, AlertConfig{Rule: ruleGPSDisconnected})
+	e.started = time.Now().Add(-disconnectGrace - time.Second)
+
+	got := fired(e)
+	if len(got) != 2 || got[0] != "GPS has not connected" || got[1] != "TNC has not connected" {
+		t.Errorf("alerts %v after the grace period, want the TNC and GPS not connected", got)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Callout priorities.  A callout interrupts any lower-priority one that's
+// being spoken, and critical callouts skip the gap between callouts.
+type priority int
+
+const (
+	priorityRoutine priority = iota
+	priorityEvent
+	priorityCritical
+)
+
+const (
+	defaultCalloutInterval = 60 // seconds
+	defaultCalloutGap      = 5  // seconds
+)
+
+// SpeechConfig sets up spoken callouts.  Command is a text-to-speech program
+// that reads what to say on stdin, e.g. "espeak --stdin" or "festival --tts",
+// or file:/path to append callouts to a file instead.
+type SpeechConfig struct {
+	Command  string `yaml:"command"`
+	Interval int    `yaml:"interval"` // Seconds between routine callouts
+	Gap      int    `yaml:"gap"`      // Minimum seconds between non-critical callouts
+}
+
+// speaker says things out loud.  Say returns early if ctx is cancelled.
+type speaker interface {
+	Say(ctx context.Context, text string) error
+}
+
+// commandSpeaker pipes text to a text-to-speech program
+type commandSpeaker struct {
+	args []string
+}
+
+func (s commandSpeaker) Say(ctx context.Context, text string) error {
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdin = strings.NewReader(text + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("%v: %v: %s", s.args[0], err, out)
+	}
+	return nil
+}
+
+// fileSpeaker writes callouts to a file, one per line
+type fileSpeaker struct {
+	path string
+}
+
+func (s fileSpeaker) Say(ctx context.Context, text string) error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%v %v\n", time.Now().Format(time.RFC3339), text)
+	return err
+}
+
+func newSpeaker(command string) (speaker, error) {
+	if strings.HasPrefix(command, "file:") {
+		path := strings.TrimPrefix(command, "file:")
+		if path == "" {
+			return nil, fmt.Errorf("speech command %q is missing a file name", command)
+		}
+		return fileSpeaker{path: path}, nil
+	}
+
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no speech command given")
+	}
+	return commandSpeaker{args: args}, nil
+}
+
+// announcer speaks one callout at a time.  Only the newest callout waiting at
+// each priority is kept; older ones are stale by the time they'd be spoken.
+type announcer struct {
+	mu       sync.Mutex
+	pending  [priorityCritical + 1]string
+	speaking priority
+	cancel   context.CancelFunc
+
+	wake     chan struct{}
+	speaker  speaker
+	interval time.Duration
+	gap      time.Duration
+}
+
+func newAnnouncer(c SpeechConfig) (*announcer, error) {
+	s, err := newSpeaker(c.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Interval == 0 {
+		c.Interval = defaultCalloutInterval
+	}
+	if c.Gap == 0 {
+		c.Gap = defaultCalloutGap
+	}
+	if c.Interval < 0 || c.Gap < 0 {
+		return nil, fmt.Errorf("speech interval and gap can't be negative")
+	}
+
+	return &announcer{
+		wake:     make(chan struct{}, 1),
+		speaker:  s,
+		interval: time.Duration(c.Interval) * time.Second,
+		gap:      time.Duration(c.Gap) * time.Second,
+	}, nil
+}
+
+// Say queues a callout, interrupting anything less important
+func (an *announcer) Say(p priority, text string) {
+	an.mu.Lock()
+	an.pending[p] = text
+	if an.cancel != nil && p > an.speaking {
+		an.cancel()
+	}
+	an.mu.Unlock()
+
+	select {
+	case an.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run speaks queued callouts, highest priority first
+func (an *announcer) Run(ctx context.Context) {
+	var last time.Time
+
+	for {
+		an.mu.Lock()
+		p := priorityCritical
+		for p > priorityRoutine && an.pending[p] == "" {
+			p--
+		}
+		text := an.pending[p]
+
+		if text == "" {
+			an.mu.Unlock()
+			select {
+			case <-an.wake:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if wait := an.gap - time.Since(last); p < priorityCritical && wait > 0 {
+			an.mu.Unlock()
+			select {
+			case <-time.After(wait):
+			case <-an.wake:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		sctx, cancel := context.WithCancel(ctx)
+		an.pending[p] = ""
+		an.speaking = p
+		an.cancel = cancel
+		an.mu.Unlock()
+
+		err := an.speaker.Say(sctx, text)
+		if err != nil {
+			log.Printf("Error speaking callout %q: %v", text, err)
+		}
+
+		an.mu.Lock()
+		an.cancel = nil
+		an.mu.Unlock()
+		cancel()
+
+		last = time.Now()
+	}
+}
+
+// Alert speaks an alert from the alert engine
+func (an *announcer) Alert(al Alert) {
+	p := priorityEvent
+	switch al.Rule {
+	case ruleBurst, ruleDescentBelow, ruleBatteryLow, rulePayloadSilent:
+		p = priorityCritical
+	}
+	an.Say(p, al.Text)
+}
+
+// Routine makes a callout about the payload every interval
+func (an *announcer) Routine(ctx context.Context, a *APRSTNC, g PositionSource) {
+	for sleep(ctx, an.interval) {
+
+		me := g.Position()
+		text := payloadCallout(a, me)
+		if text != "" {
+			an.Say(priorityRoutine, text)
+		}
+	}
+}
+
+// payloadCallout describes where the payload is, how it's moving and where it
+// should land, relative to us at me
+func payloadCallout(a *APRSTNC, me geospatial.Point) string {
+	lp, ok := a.LastPosition(balloonCallsign())
+	if !ok {
+		return ""
+	}
+	p := lp.data.Position
+
+	var parts []string
+	us := units()
+
+	alt := "Altitude " + us.Altitude.Say(p.Altitude, 100)
+	if rate, ok := verticalRate(a.TrackAsSlice()); ok {
+		switch {
+		case rate > 0:
+			alt += ", climbing " + us.Rate.Say(float64(rate), 50)
+		case rate < 0:
+			alt += ", descending " + us.Rate.Say(float64(-rate), 50)
+		}
+	}
+	parts = append(parts, alt)
+
+	if me.Lat != 0 && me.Lon != 0 {
+		parts = append(parts, fmt.Sprintf("Payload %v, bearing %v",
+			us.Distance.Say(me.GreatCircleDistanceTo(p), 1), spokenBearing(me.BearingTo(p))))
+
+		if pred, ok := a.PredictedLanding(me.Altitude); ok {
+			parts = append(parts, fmt.Sprintf("Landing %v, bearing %v",
+				us.Distance.Say(me.GreatCircleDistanceTo(pred.Point), 1), spokenBearing(me.BearingTo(pred.Point))))
+		}
+	}
+
+	return strings.Join(parts, ". ") + "."
+}
+
+func roundTo(v float64, step int) int {
+	return int(v/float64(step)+0.5) * step
+}
+
+// spokenBearing reads a bearing digit by digit, e.g. "zero four five"
+func spokenBearing(b uint16) string {
+	digits := []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine"}
+
+	deg := int(b) % 360
+	return fmt.Sprintf("%v %v %v", digits[deg/100], digits[deg/10%10], digits[deg%10])
+}
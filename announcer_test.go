@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSpeaker is a speaker whose callouts last until they're released or
+// interrupted
+type fakeSpeaker struct {
+	started chan string   // Each callout as it starts
+	release chan struct{} // Finishes the callout being spoken
+
+	mu   sync.Mutex
+	done []string // Finished callouts, marked if they were interrupted
+}
+
+func newFakeSpeaker() *fakeSpeaker {
+	return &fakeSpeaker{started: make(chan string, 10), release: make(chan struct{})}
+}
+
+func (s *fakeSpeaker) Say(ctx context.Context, text string) error {
+	s.started <- text
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		text += " (interrupted)"
+	}
+
+	s.mu.Lock()
+	s.done = append(s.done, text)
+	s.mu.Unlock()
+	return nil
+}
+
+// finished returns the callouts that have finished so far
+func (s *fakeSpeaker) finished() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.done...)
+}
+
+// next waits for the next callout to start
+func (s *fakeSpeaker) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case text := <-s.started:
+		return text
+	case <-time.After(time.Second):
+		t.Fatal("no callout started")
+		return ""
+	}
+}
+
+// quiet checks that no callout starts for a while
+func (s *fakeSpeaker) quiet(t *testing.T, d time.Duration) {
+	t.Helper()
+	select {
+	case text := <-s.started:
+		t.Errorf("%q started, want nothing", text)
+	case <-time.After(d):
+	}
+}
+
+// testAnnouncer runs an announcer on a fake speaker until the test ends
+func testAnnouncer(t *testing.T, gap time.Duration) (*announcer, *fakeSpeaker) {
+	s := newFakeSpeaker()
+	an := &announcer{wake: make(chan struct{}, 1), speaker: s, gap: gap}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		an.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return an, s
+}
+
+func TestCriticalInterruptsRoutine(t *testing.T) {
+	an, s := testAnnouncer(t, 0)
+
+	an.Say(priorityRoutine, "Altitude 30,000 feet")
+	if got := s.next(t); got != "Altitude 30,000 feet" {
+		t.Fatalf("spoke %q, want the routine callout", got)
+	}
+
+	an.Say(priorityCritical, "Burst detected")
+	if got := s.next(t); got != "Burst detected" {
+		t.Fatalf("spoke %q, want the critical callout", got)
+	}
+	s.release <- struct{}{}
+
+	s.quiet(t, 50*time.Millisecond)
+	done := s.finished()
+	if len(done) != 2 || done[0] != "Altitude 30,000 feet (interrupted)" || done[1] != "Burst detected" {
+		t.Errorf("callouts %q, want the routine one interrupted by the critical one", done)
+	}
+}
+
+// Lower-priority callouts don't interrupt, and an event waits out the gap
+// after the last callout while a critical one doesn't
+func TestCalloutGap(t *testing.T) {
+	gap := 200 * time.Millisecond
+	an, s := testAnnouncer(t, gap)
+
+	an.Say(priorityCritical, "Burst detected")
+	s.next(t)
+	an.Say(priorityEvent, "Message from KF7FVH-1")
+	s.quiet(t, 50*time.Millisecond)
+	s.release <- struct{}{}
+	finished := time.Now()
+
+	if got := s.next(t); got != "Message from KF7FVH-1" {
+		t.Fatalf("spoke %q, want the event", got)
+	}
+	if waited := time.Since(finished); waited < gap {
+		t.Errorf("event spoken %v after the last callout, want at least %v", waited, gap)
+	}
+	s.release <- struct{}{}
+
+	an.Say(priorityCritical, "Payload descending through 9,500 feet")
+	if got := s.next(t); got != "Payload descending through 9,500 feet" {
+		t.Fatalf("spoke %q, want the critical callout", got)
+	}
+	if waited := time.Since(finished); waited >= 2*gap {
+		t.Errorf("critical callout waited %v for the gap", waited)
+	}
+	s.release <- struct{}{}
+}
+
+// Only the newest callout waiting at each priority is spoken
+func TestNewerCalloutReplacesQueued(t *testing.T) {
+	an, s := testAnnouncer(t, 0)
+
+	an.Say(priorityCritical, "Burst detected")
+	s.next(t)
+
+	an.Say(priorityRoutine, "Altitude 30,000 feet")
+	an.Say(priorityRoutine, "Altitude 29,000 feet")
+	s.release <- struct{}{}
+
+	if got := s.next(t); got != "Altitude 29,000 feet" {
+		t.Errorf("spoke %q, want the newer routine callout", got)
+	}
+	s.release <- struct{}{}
+	s.quiet(t, 50*time.Millisecond)
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The REST API.  Reads are open unless -apitoken is set; commands always
+// require the token since one of them cuts the payload loose.  The live feeds
+// in web.go (the dashboard's WebSocket, KML, GeoJSON and metrics) are gated
+// the same way as reads.
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type messageRequest struct {
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+type cutdownArmResponse struct {
+	Armed   bool      `json:"armed"`
+	Expires time.Time `json:"expires"`
+}
+
+type commandResponse struct {
+	Status string `json:"status"`
+}
+
+func (w *webServer) registerAPI() {
+	w.mux.HandleFunc("/api/state", w.apiGet(w.handleAPIState))
+	w.mux.HandleFunc("/api/payload", w.apiGet(w.handleAPIPayload))
+	w.mux.HandleFunc("/api/chasers", w.apiGet(w.handleAPIChasers))
+	w.mux.HandleFunc("/api/packets", w.apiGet(w.handleAPIPackets))
+	w.mux.HandleFunc("/api/status", w.apiGet(w.handleAPIStatus))
+	w.mux.HandleFunc("/api/alerts", w.apiGet(w.handleAPIAlerts))
+
+	w.mux.HandleFunc("/api/message", w.apiPost(w.handleAPIMessage))
+	w.mux.HandleFunc("/api/beacon", w.apiPost(w.handleAPIBeacon))
+	w.mux.HandleFunc("/api/cutdown/arm", w.apiPost(w.handleAPICutdownArm))
+	w.mux.HandleFunc("/api/cutdown/send", w.apiPost(w.handleAPICutdownSend))
+}
+
+// authorized checks the request's bearer token against -apitoken
+func authorized(r *http.Request) bool {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return false
+	}
+	return tokenMatches(strings.TrimPrefix(h, "Bearer "))
+}
+
+// readAuthorized lets a read through if there's no -apitoken, or if the
+// request has it as a bearer token
+func readAuthorized(r *http.Request) bool {
+	return *apitoken == "" || authorized(r)
+}
+
+// queryAuthorized is readAuthorized, but also takes the token from a token
+// query parameter.  Browsers can't set headers on a WebSocket and mapping apps
+// can't on a KML NetworkLink, so only those routes accept it, since query
+// strings end up in logs and browser history.
+func queryAuthorized(r *http.Request) bool {
+	return readAuthorized(r) || tokenMatches(r.URL.Query().Get("token"))
+}
+
+func tokenMatches(token string) bool {
+	return *apitoken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(*apitoken)) == 1
+}
+
+// requireReadToken wraps a handler for a live feed with readAuthorized
+func requireReadToken(h http.Handler) http.Handler {
+	return requireToken(h, readAuthorized)
+}
+
+// requireQueryToken wraps a handler for the WebSocket or a KML NetworkLink
+// with queryAuthorized
+func requireQueryToken(h http.Handler) http.Handler {
+	return requireToken(h, queryAuthorized)
+}
+
+func requireToken(h http.Handler, ok func(*http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !ok(r) {
+			writeAPIError(rw, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		h.ServeHTTP(rw, r)
+	})
+}
+
+func (w *webServer) apiGet(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			writeAPIError(rw, http.StatusMethodNotAllowed, "use GET")
+			return
+		}
+		if !readAuthorized(r) {
+			writeAPIError(rw, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		h(rw, r)
+	}
+}
+
+func (w *webServer) apiPost(h http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeAPIError(rw, http.StatusMethodNotAllowed, "use POST")
+			return
+		}
+		if *apitoken == "" {
+			writeAPIError(rw, http.StatusForbidden, "commands are disabled; start gophertrak with -apitoken")
+			return
+		}
+		if !authorized(r) {
+			writeAPIError(rw, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		log.Printf("API command %v from %v", r.URL.Path, r.RemoteAddr)
+		h(rw, r)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	err := json.NewEncoder(rw).Encode(v)
+	if err != nil {
+		log.Printf("Error encoding API response: %v", err)
+	}
+}
+
+func writeAPIError(rw http.ResponseWriter, status int, msg string) {
+	writeJSON(rw, status, apiError{Error: msg})
+}
+
+func (w *webServer) handleAPIState(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, http.StatusOK, snapshotState(w.a, w.g))
+}
+
+func (w *webServer) handleAPIPayload(rw http.ResponseWriter, r *http.Request) {
+	st := snapshotState(w.a, w.g)
+	writeJSON(rw, http.StatusOK, struct {
+		PayloadState
+		Landing *LandingState `json:"landing,omitempty"`
+	}{st.Payload, st.Landing})
+}
+
+func (w *webServer) handleAPIChasers(rw http.ResponseWriter, r *http.Request) {
+	st := snapshotState(w.a, w.g)
+	writeJSON(rw, http.StatusOK, struct {
+		Me      ChaserState   `json:"me"`
+		Chasers []ChaserState `json:"chasers"`
+	}{st.Me, st.Chasers})
+}
+
+func (w *webServer) handleAPIStatus(rw http.ResponseWriter, r *http.Request) {
+	writeJSON(rw, http.StatusOK, snapshotState(w.a, w.g).Connections)
+}
+
+// handleAPIAlerts returns every alert raised this flight, newest first
+func (w *webServer) handleAPIAlerts(rw http.ResponseWriter, r *http.Request) {
+	alerts := w.alerts.Alerts()
+	if alerts == nil {
+		alerts = []Alert{}
+	}
+	writeJSON(rw, http.StatusOK, alerts)
+}
+
+// handleAPIPackets returns the packet history, newest first.  It can be
+// filtered by source callsign, packet type, age (since=10m or an RFC3339
+// time) and limited in length.
+func (w *webServer) handleAPIPackets(rw http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	limit := 0
+
+	q := r.URL.Query()
+	source := strings.ToUpper(q.Get("source"))
+	pktType := strings.ToUpper(q.Get("type"))
+
+	if s := q.Get("since"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil {
+			since = time.Now().Add(-d)
+		} else if t, err := time.Parse(time.RFC3339, s); err == nil {
+			since = t
+		} else {
+			writeAPIError(rw, http.StatusBadRequest, fmt.Sprintf("invalid since: %q", s))
+			return
+		}
+	}
+
+	if l := q.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			writeAPIError(rw, http.StatusBadRequest, fmt.Sprintf("invalid limit: %q", l))
+			return
+		}
+		limit = n
+	}
+
+	now := time.Now()
+	packets := []PacketState{}
+	for _, v := range w.a.HistoryAsSlice() {
+		ps := packetState(v, now)
+		if source != "" && ps.Source != source {
+			continue
+		}
+		if pktType != "" && ps.Type != pktType {
+			continue
+		}
+		if !since.IsZero() && ps.Time.Before(since) {
+			// History is newest first so nothing after this will match
+			break
+		}
+		packets = append(packets, ps)
+		if limit > 0 && len(packets) >= limit {
+			break
+		}
+	}
+
+	writeJSON(rw, http.StatusOK, packets)
+}
+
+func (w *webServer) handleAPIMessage(rw http.ResponseWriter, r *http.Request) {
+	var req messageRequest
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeAPIError(rw, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+
+	if req.To == "" {
+		writeAPIError(rw, http.StatusBadRequest, "to is required")
+		return
+	}
+	if req.Text == "" || len(req.Text) > 67 {
+		writeAPIError(rw, http.StatusBadRequest, "text must be 1-67 characters")
+		return
+	}
+
+	err = w.a.SendMessage(req.To, req.Text)
+	if err != nil {
+		writeAPIError(rw, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusAccepted, commandResponse{Status: "queued"})
+}
+
+func (w *webServer) handleAPIBeacon(rw http.ResponseWriter, r *http.Request) {
+	err := w.a.Beacon(w.g.Position())
+	if err != nil {
+		writeAPIError(rw, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusAccepted, commandResponse{Status: "queued"})
+}
+
+func (w *webServer) handleAPICutdownArm(rw http.ResponseWriter, r *http.Request) {
+	expires := w.a.ArmCutdown()
+	writeJSON(rw, http.StatusOK, cutdownArmResponse{Armed: true, Expires: expires})
+}
+
+func (w *webServer) handleAPICutdownSend(rw http.ResponseWriter, r *http.Request) {
+	err := w.a.SendCutdown()
+	if err != nil {
+		writeAPIError(rw, http.StatusConflict, err.Error())
+		return
+	}
+
+	writeJSON(rw, http.StatusAccepted, commandResponse{Status: "queued"})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadAuthorization(t *testing.T) {
+	apitoken = strPtr("s3cret")
+	defer func() { apitoken = strPtr("") }()
+
+	tests := []struct {
+		name         string
+		url, bearer  string
+		read, viaURL bool
+	}{
+		{"bearer", "/api/status", "s3cret", true, true},
+		{"wrong bearer", "/api/status", "guess", false, false},
+		{"query", "/ws?token=s3cret", "", false, true},
+		{"wrong query", "/ws?token=guess", "", false, false},
+		{"no token", "/api/status", "", false, false},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+tt.bearer)
+		}
+		if got := readAuthorized(r); got != tt.read {
+			t.Errorf("%v: readAuthorized = %v, want %v", tt.name, got, tt.read)
+		}
+		if got := queryAuthorized(r); got != tt.viaURL {
+			t.Errorf("%v: queryAuthorized = %v, want %v", tt.name, got, tt.viaURL)
+		}
+	}
+
+	// Without -apitoken, anyone can read
+	apitoken = strPtr("")
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	if !readAuthorized(r) || !queryAuthorized(r) {
+		t.Error("read refused with no -apitoken set")
+	}
+}
+
+// The REST API only takes the token as a bearer token
+func TestAPIRejectsQueryToken(t *testing.T) {
+	apitoken = strPtr("s3cret")
+	defer func() { apitoken = strPtr("") }()
+
+	w := &webServer{}
+	h := w.apiGet(func(rw http.ResponseWriter, r *http.Request) {})
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/api/status?token=s3cret", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET with ?token= got %v, want %v", rec.Code, http.StatusUnauthorized)
+	}
+
+	r := httptest.NewRequest("GET", "/api/status", nil)
+	r.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	h(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET with a bearer token got %v, want %v", rec.Code, http.StatusOK)
+	}
+}
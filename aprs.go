@@ -2,6 +2,7 @@ package main
 
 import (
 	"container/ring"
+	"context"
 	"fmt"
 	"github.com/chrissnell/GoBalloon/aprs"
 	"github.com/chrissnell/GoBalloon/ax25"
@@ -9,18 +10,31 @@ import (
 	"log"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
 
 type APRSTNC struct {
 	pr              PacketRing
+	track           PacketRing // Recent packets from the balloon only
+	history         PacketRing // Longer history of packets from concerned stations
+	heard           heardList  // Every station heard, concerned or not
+	paths           pathAnalysis
+	dedup           dedupFilter
 	pos             PayloadPosition
 	conn            net.Conn
 	aprsPosition    chan geospatial.Point
-	aprsMessage     chan string
+	aprsMessage     chan aprs.Message
+	aprsObject      chan APRSObject
+	inbox           chan PayloadPacket // Messages addressed to us
+	lastWords       sync.WaitGroup     // Senders that queue one last packet when we shut down
+	msgID           int
+	cutdownArmed    time.Time
+	cutdownMu       sync.Mutex
 	concerned       map[string]bool // Callsigns that we want to listen for
 	lastPacket      map[string]PayloadPacket
+	lastPosition    map[string]PayloadPacket // Last packet with a position, by callsign
 	lastPacketMu    sync.Mutex
 	connecting      bool
 	connectingMutex sync.Mutex
@@ -28,10 +42,16 @@ type APRSTNC struct {
 	connectedMutex  sync.Mutex
 	remotetnc       *string
 	beaconint       *string
+	cutdowncmd      *string
 	symbolTable     rune
 	symbolCode      rune
 }
 
+const (
+	outgoingQueueSize = 10
+	cutdownArmWindow  = 60 * time.Second
+)
+
 type PayloadPosition struct {
 	mu  sync.Mutex
 	pos geospatial.Point
@@ -43,9 +63,10 @@ type PacketRing struct {
 }
 
 type PayloadPacket struct {
-	data aprs.APRSData
-	pkt  ax25.APRSPacket
-	ts   time.Time
+	data     aprs.APRSData
+	pkt      ax25.APRSPacket
+	ts       time.Time
+	arrivals *arrivals // Every copy we heard of this packet
 }
 
 func (p *PayloadPosition) Set(pos geospatial.Point) {
@@ -60,19 +81,60 @@ func (p *PayloadPosition) Get() geospatial.Point {
 	return p.pos
 }
 
-func (a *APRSTNC) RingAsSlice() []PayloadPacket {
+// Push adds a packet to the front of the ring, displacing the oldest one
+func (pr *PacketRing) Push(pp PayloadPacket) {
+	pr.Lock()
+	defer pr.Unlock()
+	pr.r = pr.r.Prev()
+	pr.r.Value = pp
+}
+
+// Slice returns the packets in the ring, newest first
+func (pr *PacketRing) Slice() []PayloadPacket {
 	var recent []PayloadPacket
-	a.pr.Lock()
-	a.pr.r.Do(func(x interface{}) {
+	pr.Lock()
+	pr.r.Do(func(x interface{}) {
 		if x != nil {
 			recent = append(recent, x.(PayloadPacket))
 		}
 	})
-	a.pr.Unlock()
+	pr.Unlock()
 
 	return recent
 }
 
+func (a *APRSTNC) RingAsSlice() []PayloadPacket {
+	return a.pr.Slice()
+}
+
+// TrackAsSlice returns the recent packets heard from the balloon, newest first
+func (a *APRSTNC) TrackAsSlice() []PayloadPacket {
+	return a.track.Slice()
+}
+
+// HistoryAsSlice returns up to the last 500 packets heard from concerned stations, newest first
+func (a *APRSTNC) HistoryAsSlice() []PayloadPacket {
+	return a.history.Slice()
+}
+
+// LastPacket returns the most recent packet heard from a callsign
+func (a *APRSTNC) LastPacket(call string) (PayloadPacket, bool) {
+	a.lastPacketMu.Lock()
+	defer a.lastPacketMu.Unlock()
+	pp, exists := a.lastPacket[call]
+	return pp, exists
+}
+
+// LastPosition returns the most recent packet from a callsign that had a
+// position in it.  Stations send status, telemetry and messages too, so this
+// isn't always their last packet.
+func (a *APRSTNC) LastPosition(call string) (PayloadPacket, bool) {
+	a.lastPacketMu.Lock()
+	defer a.lastPacketMu.Unlock()
+	pp, exists := a.lastPosition[call]
+	return pp, exists
+}
+
 func (a *APRSTNC) IsConnected() bool {
 	a.connectedMutex.Lock()
 	defer a.connectedMutex.Unlock()
@@ -85,27 +147,62 @@ func (a *APRSTNC) Connected(c bool) {
 	a.connected = c
 }
 
-func (a *APRSTNC) StartAPRS() {
-	log.Println("APRS.StartAPRS()")
-
-	a.pr.Lock()
+// newAPRSTNC sets up a TNC's packet rings, queues and maps.  The UI, web
+// server, metrics and alerts all read them, so they have to exist before any
+// of those start.
+func newAPRSTNC() *APRSTNC {
+	a := &APRSTNC{
+		aprsMessage:  make(chan aprs.Message, outgoingQueueSize),
+		inbox:        make(chan PayloadPacket, outgoingQueueSize),
+		aprsPosition: make(chan geospatial.Point, outgoingQueueSize),
+		aprsObject:   make(chan APRSObject, outgoingQueueSize),
+		concerned:    make(map[string]bool),
+		lastPacket:   make(map[string]PayloadPacket),
+		lastPosition: make(map[string]PayloadPacket),
+	}
 	a.pr.r = ring.New(10)
-	a.pr.Unlock()
-	a.aprsMessage = make(chan string)
-	a.aprsPosition = make(chan geospatial.Point)
-	a.concerned = make(map[string]bool)
-	a.lastPacket = make(map[string]PayloadPacket)
+	a.track.r = ring.New(30)
+	a.history.r = ring.New(500)
+	return a
+}
+
+// StartAPRS connects to the TNC and handles packets in both directions until
+// ctx is done.  Then it sends whatever is still queued and hangs up.
+func (a *APRSTNC) StartAPRS(ctx context.Context) {
+	log.Println("APRS.StartAPRS()")
 
 	// Block on setting up a new connection to the TNC
-	a.connectToNetworkTNC()
+	if !a.connectToNetworkTNC(ctx) {
+		return
+	}
 
-	go a.incomingAPRSEventHandler()
-	go a.outgoingAPRSEventHandler()
+	incoming := make(chan bool)
+	go func() {
+		a.incomingAPRSEventHandler(ctx)
+		close(incoming)
+	}()
 
+	a.outgoingAPRSEventHandler(ctx)
+
+	// Hanging up unblocks the incoming handler's read
+	a.Close()
+	<-incoming
 }
 
-func (a *APRSTNC) connectToNetworkTNC() {
+// Close hangs up on the TNC
+func (a *APRSTNC) Close() {
+	a.Connected(false)
+	if a.conn != nil {
+		log.Printf("Closing connection to TNC %v", a.conn.RemoteAddr())
+		a.conn.Close()
+	}
+}
+
+// connectToNetworkTNC connects to the TNC, retrying until it succeeds.  It
+// returns false if ctx is done first.
+func (a *APRSTNC) connectToNetworkTNC(ctx context.Context) bool {
 	var err error
+	var d net.Dialer
 
 	// This mutex controls access to the boolean that indicates when a connect/reconnect
 	// attempt is in progress
@@ -114,20 +211,29 @@ func (a *APRSTNC) connectToNetworkTNC() {
 	if a.connecting {
 		a.connectingMutex.Unlock()
 		log.Println("Skipping reconnect since a connection attempt is already in progress")
-		return
+		return ctx.Err() == nil
 	} else {
 		// A connection attempt is not in progress so we'll start a new one
 		a.connecting = true
 		a.connectingMutex.Unlock()
 
+		if a.conn != nil {
+			tncReconnects.Inc()
+		}
+
 		log.Println("Connecting to remote TNC ", *a.remotetnc)
 
 		for {
-			a.conn, err = net.Dial("tcp", *a.remotetnc)
+			a.conn, err = d.DialContext(ctx, "tcp", *a.remotetnc)
 			if err != nil {
 				log.Printf("Could not connect to %v.  Error: %v", *a.remotetnc, err)
 				log.Println("Sleeping 5 seconds and trying again")
-				time.Sleep(5 * time.Second)
+				if !sleep(ctx, 5*time.Second) {
+					a.connectingMutex.Lock()
+					a.connecting = false
+					a.connectingMutex.Unlock()
+					return false
+				}
 			} else {
 				a.Connected(true)
 				log.Printf("Connection to TNC %v successful", a.conn.RemoteAddr())
@@ -138,13 +244,13 @@ func (a *APRSTNC) connectToNetworkTNC() {
 				// set a.connecting to false
 				a.connecting = false
 				a.connectingMutex.Unlock()
-				return
+				return true
 			}
 		}
 	}
 }
 
-func (a *APRSTNC) incomingAPRSEventHandler() {
+func (a *APRSTNC) incomingAPRSEventHandler(ctx context.Context) {
 
 	log.Println("APRS::incomingAPRSEventHandler()")
 
@@ -172,12 +278,18 @@ func (a *APRSTNC) incomingAPRSEventHandler() {
 			// Retrieve a packet
 			msg, err := d.Next()
 			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
 				a.Connected(false)
+				decodeFailures.WithLabelValues("kiss").Inc()
 				log.Printf("Error retrieving APRS message via KISS: %v", err)
 				log.Println("Attempting to reconnect to TNC")
 				// Reconnect to the TNC and break this inner loop so that a new Decoder
 				// is created over the new connection
-				a.connectToNetworkTNC()
+				if !a.connectToNetworkTNC(ctx) {
+					return
+				}
 				break
 			}
 
@@ -186,86 +298,268 @@ func (a *APRSTNC) incomingAPRSEventHandler() {
 
 			log.Printf("Incoming APRS packet received: %+v\n", msg)
 
+			packetsReceived.WithLabelValues(msg.Source.String()).Inc()
+
 			// Parse the packet
-			ad := aprs.ParsePacket(&msg)
+			ad := normalizePosition(msg, aprs.ParsePacket(&msg))
+
+			ts := time.Now()
+
+			arr, dup := a.dedup.Check(msg, ts)
+
+			// Every copy of the balloon's packets tells us something about how
+			// they're getting to us
+			if msg.Source.String() == balloon {
+				a.paths.Record(msg, arr, ts)
+			}
+
+			// Only the first copy of a packet goes any further.  The rest are
+			// noted as other paths that it arrived by.
+			if dup {
+				a.heard.Arrived(msg, arr)
+				packetsDuplicate.WithLabelValues(msg.Source.String()).Inc()
+				log.Printf("Duplicate packet from %v via %v", msg.Source.String(), markedPath(msg.Path))
+				continue
+			}
+
+			// Keep track of everyone we hear, even if we can't parse what they sent
+			a.heard.Record(msg, ad, arr, ts)
+
+			if ad == nil {
+				decodeFailures.WithLabelValues("aprs").Inc()
+				log.Printf("Could not parse APRS packet from %v", msg.Source.String())
+				continue
+			}
 
 			// If this packet is from a source that we care about, add it to our ring
 			if a.concerned[msg.Source.String()] {
-				pp := PayloadPacket{data: *ad, pkt: msg, ts: time.Now()}
-				a.pr.Lock()
-				a.pr.r = a.pr.r.Prev()
-				a.pr.r.Value = pp
-				a.pr.Unlock()
+				pp := PayloadPacket{data: *ad, pkt: msg, ts: ts, arrivals: arr}
+				a.pr.Push(pp)
+				a.history.Push(pp)
+				if msg.Source.String() == balloon {
+					a.track.Push(pp)
+				}
 				a.lastPacketMu.Lock()
 				a.lastPacket[msg.Source.String()] = pp
+				if ad.Position.Lat != 0 || ad.Position.Lon != 0 {
+					a.lastPosition[msg.Source.String()] = pp
+				}
 				a.lastPacketMu.Unlock()
 			}
 
 			if ad.Position.Lon != 0 {
-				log.Printf("Position packet received.  Lat: %v  Lon: %v\n", ad.Position.Lat, ad.Position.Lon)
-				a.pos.Set(ad.Position)
+				log.Printf("Position packet received from %v.  Lat: %v  Lon: %v  Alt: %.0f\n", msg.Source.String(), ad.Position.Lat, ad.Position.Lon, ad.Position.Altitude)
+				if msg.Source.String() == balloon {
+					a.pos.Set(ad.Position)
+				}
 			}
 
-			// Send to channel to be consumed by Recent Packets
+			// Pass on messages for us, but not the acks for the ones we sent
+			if ad.Message.Recipient.String() == chaserCallsign() {
+				txt := ad.Message.Text
+				if !strings.HasPrefix(txt, "ack") && !strings.HasPrefix(txt, "rej") {
+					select {
+					case a.inbox <- PayloadPacket{data: *ad, pkt: msg, ts: ts, arrivals: arr}:
+					default:
+						log.Printf("Inbox full, dropping message from %v", msg.Source.String())
+					}
+				}
+			}
 
 		}
 
 	}
 }
 
-func (a *APRSTNC) outgoingAPRSEventHandler() {
-
-	var msg aprs.Message
+func (a *APRSTNC) outgoingAPRSEventHandler(ctx context.Context) {
 
 	log.Println("aprs::outgoingAPRSEventHandler()")
 
 	for {
 		select {
-		case <-shutdown:
+		case <-ctx.Done():
+			a.lastWords.Wait()
+			a.flushOutgoing(ctx)
 			return
 
 		case p := <-a.aprsPosition:
+			a.sendPosition(ctx, p)
 
-			// Send a postition packet
-			pt := aprs.CreateCompressedPositionReport(p, a.symbolTable, a.symbolCode)
+		case msg := <-a.aprsMessage:
+			a.sendMessage(ctx, msg)
 
-			log.Printf("Sending position report: %v\n", pt)
-			err := a.SendAPRSPacket(pt)
-			if err != nil {
-				log.Printf("Error sending position report: %v\n", err)
-			}
+		case o := <-a.aprsObject:
+			a.sendObject(ctx, o)
 
-		case m := <-a.aprsMessage:
+		}
+	}
 
-			msg.Recipient.Callsign = *chasercall
-			ssidInt, _ := strconv.Atoi(*chaserssid)
-			msg.Recipient.SSID = uint8(ssidInt)
-			msg.Text = m
-			msg.ID = "1"
+}
 
-			mt, err := aprs.CreateMessage(msg)
-			if err != nil {
-				log.Printf("Error creating outgoing message: %v\n", err)
-			}
+// flushOutgoing sends everything that's still queued, so that a message typed
+// just before quitting still goes out
+func (a *APRSTNC) flushOutgoing(ctx context.Context) {
+	for {
+		select {
+		case p := <-a.aprsPosition:
+			a.sendPosition(ctx, p)
+		case msg := <-a.aprsMessage:
+			a.sendMessage(ctx, msg)
+		case o := <-a.aprsObject:
+			a.sendObject(ctx, o)
+		default:
+			return
+		}
+	}
+}
 
-			log.Printf("Sending message: %v\n", mt)
-			err = a.SendAPRSPacket(mt)
-			if err != nil {
-				log.Printf("Error sending message: %v\n", err)
-			}
+func (a *APRSTNC) sendPosition(ctx context.Context, p geospatial.Point) {
+	pt := aprs.CreateCompressedPositionReport(p, a.symbolTable, a.symbolCode)
+
+	log.Printf("Sending position report: %v\n", pt)
+	err := a.SendAPRSPacket(ctx, pt)
+	if err != nil {
+		log.Printf("Error sending position report: %v\n", err)
+	} else {
+		packetsTransmitted.WithLabelValues("position").Inc()
+	}
+}
+
+func (a *APRSTNC) sendMessage(ctx context.Context, msg aprs.Message) {
+	a.msgID++
+	msg.ID = strconv.Itoa(a.msgID)
+
+	mt, err := aprs.CreateMessage(msg)
+	if err != nil {
+		log.Printf("Error creating outgoing message: %v\n", err)
+		return
+	}
+
+	log.Printf("Sending message: %v\n", mt)
+	err = a.SendAPRSPacket(ctx, mt)
+	if err != nil {
+		log.Printf("Error sending message: %v\n", err)
+	} else {
+		packetsTransmitted.WithLabelValues("message").Inc()
+	}
+}
+
+func (a *APRSTNC) sendObject(ctx context.Context, o APRSObject) {
+	ot := o.Encode(time.Now())
+
+	log.Printf("Sending object: %v\n", ot)
+	err := a.SendAPRSPacket(ctx, ot)
+	if err != nil {
+		log.Printf("Error sending object: %v\n", err)
+	} else {
+		packetsTransmitted.WithLabelValues("object").Inc()
+	}
+}
+
+// SendMessage queues an APRS message to another station.  The console UI and
+// the API both send messages through here.
+func (a *APRSTNC) SendMessage(to string, text string) error {
+	var msg aprs.Message
+
+	recipient, err := parseAddress(to)
+	if err != nil {
+		return err
+	}
 
+	msg.Recipient = recipient
+	msg.Text = text
+
+	select {
+	case a.aprsMessage <- msg:
+		return nil
+	default:
+		return fmt.Errorf("outgoing message queue is full or the TNC is not ready")
+	}
+}
+
+// Beacon queues a position report for our own station
+func (a *APRSTNC) Beacon(p geospatial.Point) error {
+	if p.Lat == 0 && p.Lon == 0 {
+		return fmt.Errorf("no position to beacon")
+	}
+
+	select {
+	case a.aprsPosition <- p:
+		return nil
+	default:
+		return fmt.Errorf("outgoing position queue is full or the TNC is not ready")
+	}
+}
+
+// ArmCutdown must be called shortly before SendCutdown so that a single
+// stray keypress or request can't cut the payload loose.
+func (a *APRSTNC) ArmCutdown() time.Time {
+	a.cutdownMu.Lock()
+	defer a.cutdownMu.Unlock()
+	a.cutdownArmed = time.Now()
+	log.Println("Cutdown armed")
+	return a.cutdownArmed.Add(cutdownArmWindow)
+}
+
+func (a *APRSTNC) DisarmCutdown() {
+	a.cutdownMu.Lock()
+	defer a.cutdownMu.Unlock()
+	a.cutdownArmed = time.Time{}
+	log.Println("Cutdown disarmed")
+}
+
+func (a *APRSTNC) CutdownArmed() bool {
+	a.cutdownMu.Lock()
+	defer a.cutdownMu.Unlock()
+	return time.Since(a.cutdownArmed) < cutdownArmWindow
+}
+
+// SendCutdown messages the cutdown command to the balloon, provided that the
+// cutdown was recently armed.  Arming is consumed by sending.
+func (a *APRSTNC) SendCutdown() error {
+	a.cutdownMu.Lock()
+	armed := time.Since(a.cutdownArmed) < cutdownArmWindow
+	a.cutdownArmed = time.Time{}
+	a.cutdownMu.Unlock()
+
+	if !armed {
+		return fmt.Errorf("cutdown is not armed")
+	}
+
+	log.Printf("Sending cutdown command to %v", balloonCallsign())
+	return a.SendMessage(balloonCallsign(), *a.cutdowncmd)
+}
+
+// parseAddress turns a callsign like "KF7FVH-1" into an APRSAddress
+func parseAddress(call string) (ax25.APRSAddress, error) {
+	var addr ax25.APRSAddress
+
+	parts := strings.SplitN(strings.ToUpper(strings.TrimSpace(call)), "-", 2)
+	if parts[0] == "" || len(parts[0]) > 6 {
+		return addr, fmt.Errorf("invalid callsign: %q", call)
+	}
+	addr.Callsign = parts[0]
+
+	if len(parts) == 2 {
+		ssid, err := strconv.Atoi(parts[1])
+		if err != nil || ssid < 0 || ssid > 15 {
+			return addr, fmt.Errorf("invalid SSID in callsign: %q", call)
 		}
+		addr.SSID = uint8(ssid)
 	}
 
+	return addr, nil
 }
 
-func (a *APRSTNC) SendAPRSPacket(s string) error {
+// outgoingPacket wraps an information field in a packet from our chase
+// vehicle's callsign
+func outgoingPacket(s string) (ax25.APRSPacket, error) {
 
 	var path []ax25.APRSAddress
 
-	psource := ax25.APRSAddress{
-		Callsign: "NW5W",
-		SSID:     7,
+	psource, err := parseAddress(chaserCallsign())
+	if err != nil {
+		return ax25.APRSPacket{}, fmt.Errorf("Unable to send from our callsign: %v", err)
 	}
 
 	pdest := ax25.APRSAddress{
@@ -283,11 +577,20 @@ func (a *APRSTNC) SendAPRSPacket(s string) error {
 		SSID:     1,
 	})
 
-	ap := ax25.APRSPacket{
+	return ax25.APRSPacket{
 		Source: psource,
 		Dest:   pdest,
 		Path:   path,
 		Body:   s,
+	}, nil
+}
+
+// SendAPRSPacket sends an APRS packet to the TNC, reconnecting until it goes
+// out or ctx is done
+func (a *APRSTNC) SendAPRSPacket(ctx context.Context, s string) error {
+	ap, err := outgoingPacket(s)
+	if err != nil {
+		return err
 	}
 
 	packet, err := ax25.EncodeAX25Command(ap)
@@ -301,9 +604,10 @@ func (a *APRSTNC) SendAPRSPacket(s string) error {
 			a.Connected(false)
 			log.Printf("Error writing to %v: %v", a.conn.RemoteAddr(), err)
 			log.Println("Attempting to reconnect to TNC")
-			// Reconnect to the TNC and break this inner loop so that a new Decoder
-			// is created over the new connection
-			a.connectToNetworkTNC()
+			// Reconnect to the TNC and try again
+			if !a.connectToNetworkTNC(ctx) {
+				return fmt.Errorf("gave up on sending to the TNC: %v", ctx.Err())
+			}
 		} else {
 			// Write was successful, so we break the loop
 			break
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chrissnell/gophertrak/draw"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+)
+
+const defaultConfigFile = "gophertrak.yaml"
+
+// Config is what can be set in the YAML config file
+type Config struct {
+	// Theme is the name of a built-in theme or one defined under Themes
+	Theme  string                 `yaml:"theme"`
+	Themes map[string]ThemeConfig `yaml:"themes"`
+
+	GPS GPSConfig `yaml:"gps"`
+
+	// Units is imperial (the default), metric, nautical or aviation
+	Units string `yaml:"units"`
+
+	// Coords is how positions are shown: dd (the default), ddm, dms, utm, mgrs or grid
+	Coords string `yaml:"coords"`
+
+	Battery BatteryConfig `yaml:"battery"`
+
+	Waypoints []WaypointConfig `yaml:"waypoints"`
+
+	// Alerts replaces the default alert rules if it's given
+	Alerts []AlertConfig `yaml:"alerts"`
+
+	// Speech is off unless a command is given
+	Speech SpeechConfig `yaml:"speech"`
+
+	Landing LandingConfig `yaml:"landing"`
+}
+
+// BatteryConfig says which of the payload's analog telemetry channels is its
+// battery voltage.  Volts = value * Scale + Offset, and Scale defaults to 1.
+type BatteryConfig struct {
+	Channel int     `yaml:"channel"` // 1-5, or 0 if the payload doesn't report it
+	Scale   float64 `yaml:"scale"`
+	Offset  float64 `yaml:"offset"`
+}
+
+// ThemeConfig is a custom theme.  It starts with the Base theme's styles and
+// replaces any given in Styles, e.g. RedTitle: "red+bold+underline on black"
+type ThemeConfig struct {
+	Base   string            `yaml:"base"`
+	Styles map[string]string `yaml:"styles"`
+}
+
+// loadConfig reads the config file.  It's fine for the default config file to
+// be missing, but not one that was asked for with -config.
+func loadConfig(filename string) (*Config, error) {
+	c := &Config{}
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) && filename == defaultConfigFile {
+			return c, nil
+		}
+		return nil, err
+	}
+
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v: %v", filename, err)
+	}
+
+	return c, nil
+}
+
+// theme returns the theme named in the config, or nil if there isn't one
+func (c *Config) theme() (draw.Theme, error) {
+	if c.Theme == "" {
+		return nil, nil
+	}
+
+	tc, ok := c.Themes[c.Theme]
+	if !ok {
+		t, ok := draw.Themes[c.Theme]
+		if !ok {
+			return nil, fmt.Errorf("unknown theme %q; built-in themes are %v", c.Theme, draw.ThemeNames())
+		}
+		return t, nil
+	}
+
+	base := tc.Base
+	if base == "" {
+		base = "default"
+	}
+	bt, ok := draw.Themes[base]
+	if !ok {
+		return nil, fmt.Errorf("theme %v: unknown base theme %q", c.Theme, base)
+	}
+
+	t := draw.Theme{}
+	for name, s := range bt {
+		t[name] = s
+	}
+	for name, spec := range tc.Styles {
+		s, err := draw.ParseStyle(spec)
+		if err != nil {
+			return nil, fmt.Errorf("theme %v: %v: %v", c.Theme, name, err)
+		}
+		t[name] = s
+	}
+
+	return t, nil
+}
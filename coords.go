@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"math"
+	"sync"
+)
+
+// Coordinate formats, in the order the hot key cycles through them
+const (
+	coordDD   = "dd"   // Decimal degrees
+	coordDDM  = "ddm"  // Degrees and decimal minutes
+	coordDMS  = "dms"  // Degrees, minutes and seconds
+	coordUTM  = "utm"  // Universal Transverse Mercator
+	coordMGRS = "mgrs" // Military Grid Reference System
+	coordGrid = "grid" // Maidenhead grid locator
+)
+
+var coordFormats = []string{coordDD, coordDDM, coordDMS, coordUTM, coordMGRS, coordGrid}
+
+var (
+	coordMu     sync.Mutex
+	coordFormat = coordDD
+)
+
+func currentCoordFormat() string {
+	coordMu.Lock()
+	defer coordMu.Unlock()
+	return coordFormat
+}
+
+// setCoordFormat picks how positions are shown
+func setCoordFormat(f string) error {
+	for _, cf := range coordFormats {
+		if cf == f {
+			coordMu.Lock()
+			coordFormat = f
+			coordMu.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown coordinate format %q: use dd, ddm, dms, utm, mgrs or grid", f)
+}
+
+// cycleCoordFormat switches to the next coordinate format and returns it
+func cycleCoordFormat() string {
+	coordMu.Lock()
+	defer coordMu.Unlock()
+	for i, cf := range coordFormats {
+		if cf == coordFormat {
+			coordFormat = coordFormats[(i+1)%len(coordFormats)]
+			break
+		}
+	}
+	return coordFormat
+}
+
+// coordTitles are the labels for the two lines that coordStrings returns
+func coordTitles(format string) (string, string) {
+	switch format {
+	case coordUTM:
+		return "UTM:", ""
+	case coordMGRS:
+		return "MGRS:", ""
+	case coordGrid:
+		return "GRID:", ""
+	}
+	return "LAT:", "LON:"
+}
+
+// coordStrings formats a position as two lines.  Lat/lon formats give the
+// latitude and longitude; UTM and MGRS give the zone and easting, then the
+// northing; a grid locator is all on the first line.
+func coordStrings(p geospatial.Point, format string) (string, string) {
+	switch format {
+	case coordDDM:
+		return ddmString(p.Lat, 'N', 'S'), ddmString(p.Lon, 'E', 'W')
+	case coordDMS:
+		return dmsString(p.Lat, 'N', 'S'), dmsString(p.Lon, 'E', 'W')
+	case coordUTM:
+		zone, band, e, n, ok := toUTM(p.Lat, p.Lon)
+		if !ok {
+			return "POLAR", ""
+		}
+		return fmt.Sprintf("%d%c %06.0fE", zone, band, math.Floor(e)), fmt.Sprintf("%07.0fN", math.Floor(n))
+	case coordMGRS:
+		ref, ok := toMGRS(p.Lat, p.Lon)
+		if !ok {
+			return "POLAR", ""
+		}
+		return ref[:len(ref)-6], ref[len(ref)-5:]
+	case coordGrid:
+		return maidenhead(p.Lat, p.Lon), ""
+	}
+	return ddString(p.Lat, 'N', 'S'), ddString(p.Lon, 'E', 'W')
+}
+
+// coordString is coordStrings on one line
+func coordString(p geospatial.Point, format string) string {
+	a, b := coordStrings(p, format)
+	switch {
+	case b == "":
+		return a
+	case format == coordUTM || format == coordMGRS:
+		return a + " " + b
+	}
+	return a + " / " + b
+}
+
+func hemisphere(v float64, pos, neg rune) rune {
+	if v < 0 {
+		return neg
+	}
+	return pos
+}
+
+func ddString(v float64, pos, neg rune) string {
+	return fmt.Sprintf("%7.3f° %c", math.Abs(v), hemisphere(v, pos, neg))
+}
+
+func ddmString(v float64, pos, neg rune) string {
+	// Round to hundredths of a minute before splitting so that 59.999' rolls over
+	hm := int(math.Abs(v)*6000 + 0.5)
+	return fmt.Sprintf("%3d°%05.2f' %c", hm/6000, float64(hm%6000)/100, hemisphere(v, pos, neg))
+}
+
+func dmsString(v float64, pos, neg rune) string {
+	s := int(math.Abs(v)*3600 + 0.5)
+	return fmt.Sprintf("%3d°%02d'%02d\" %c", s/3600, s/60%60, s%60, hemisphere(v, pos, neg))
+}
+
+//
+// UTM and MGRS, on the WGS84 ellipsoid
+//
+
+const (
+	wgs84A = 6378137.0
+	wgs84F = 1 / 298.257223563
+	utmK0  = 0.9996
+)
+
+// toUTM converts a position to a UTM zone, latitude band, easting and
+// northing.  UTM doesn't cover the poles, so ok is false there.
+func toUTM(lat, lon float64) (zone int, band byte, easting, northing float64, ok bool) {
+	if lat < -80 || lat >= 84 {
+		return 0, 0, 0, 0, false
+	}
+
+	zone = int((lon+180)/6) + 1
+	if zone > 60 {
+		zone = 60
+	}
+
+	// Southwest Norway and Svalbard have their own zones
+	if lat >= 56 && lat < 64 && lon >= 3 && lon < 12 {
+		zone = 32
+	}
+	if lat >= 72 {
+		switch {
+		case lon >= 0 && lon < 9:
+			zone = 31
+		case lon >= 9 && lon < 21:
+			zone = 33
+		case lon >= 21 && lon < 33:
+			zone = 35
+		case lon >= 33 && lon < 42:
+			zone = 37
+		}
+	}
+
+	bands := "CDEFGHJKLMNPQRSTUVWX"
+	b := int((lat + 80) / 8)
+	if b >= len(bands) {
+		b = len(bands) - 1
+	}
+	band = bands[b]
+
+	rad := math.Pi / 180
+	phi := lat * rad
+	lam := lon * rad
+	lam0 := float64((zone-1)*6-180+3) * rad
+
+	e2 := wgs84F * (2 - wgs84F)
+	e4 := e2 * e2
+	e6 := e4 * e2
+	ep2 := e2 / (1 - e2)
+
+	sinPhi, cosPhi, tanPhi := math.Sin(phi), math.Cos(phi), math.Tan(phi)
+	n := wgs84A / math.Sqrt(1-e2*sinPhi*sinPhi)
+	t := tanPhi * tanPhi
+	c := ep2 * cosPhi * cosPhi
+	a := cosPhi * (lam - lam0)
+
+	m := wgs84A * ((1-e2/4-3*e4/64-5*e6/256)*phi -
+		(3*e2/8+3*e4/32+45*e6/1024)*math.Sin(2*phi) +
+		(15*e4/256+45*e6/1024)*math.Sin(4*phi) -
+		(35*e6/3072)*math.Sin(6*phi))
+
+	easting = utmK0*n*(a+(1-t+c)*math.Pow(a, 3)/6+
+		(5-18*t+t*t+72*c-58*ep2)*math.Pow(a, 5)/120) + 500000
+
+	northing = utmK0 * (m + n*tanPhi*(a*a/2+
+		(5-t+9*c+4*c*c)*math.Pow(a, 4)/24+
+		(61-58*t+t*t+600*c-330*ep2)*math.Pow(a, 6)/720))
+	if lat < 0 {
+		northing += 10000000
+	}
+
+	return zone, band, easting, northing, true
+}
+
+// toMGRS converts a position to a 1 m MGRS reference, e.g. "10T ET 48823 74400"
+func toMGRS(lat, lon float64) (string, bool) {
+	zone, band, e, n, ok := toUTM(lat, lon)
+	if !ok {
+		return "", false
+	}
+
+	// The 100 km square's column letters repeat every three zones and its
+	// row letters are offset in even zones
+	cols := []string{"ABCDEFGH", "JKLMNPQR", "STUVWXYZ"}[(zone-1)%3]
+	rows := "ABCDEFGHJKLMNPQRSTUV"
+
+	col := int(e/100000) - 1
+	if col < 0 || col >= len(cols) {
+		return "", false
+	}
+	row := int(n/100000) % 20
+	if zone%2 == 0 {
+		row = (row + 5) % 20
+	}
+
+	return fmt.Sprintf("%d%c %c%c %05d %05d", zone, band, cols[col], rows[row],
+		int(e)%100000, int(n)%100000), true
+}
+
+// maidenhead converts a position to a six-character grid locator, e.g. "CN87uo"
+func maidenhead(lat, lon float64) string {
+	lon += 180
+	lat += 90
+	if lon >= 360 {
+		lon = 359.9999
+	}
+	if lat >= 180 {
+		lat = 179.9999
+	}
+
+	return string([]byte{
+		'A' + byte(lon/20),
+		'A' + byte(lat/10),
+		'0' + byte(math.Mod(lon, 20)/2),
+		'0' + byte(math.Mod(lat, 10)),
+		'a' + byte(math.Mod(lon, 2)*12),
+		'a' + byte(math.Mod(lat, 1)*24),
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"testing"
+)
+
+func TestToUTM(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		zone     int
+		band     byte
+		e, n     string // As coordStrings shows them
+		ok       bool
+	}{
+		{"Seattle", 47.6062, -122.3321, 10, 'T', "10T 550200E", "5272748N", true},
+		{"Sydney", -33.8688, 151.2093, 56, 'H', "56H 334368E", "6250948N", true},
+		{"equator", 0, 0, 31, 'N', "31N 166021E", "0000000N", true},
+		{"just south of the equator", -0.0001, 0, 31, 'M', "31M 166021E", "9999988N", true},
+
+		// Southwest Norway is in 32V, which is wider than usual
+		{"Norway", 60, 5, 32, 'V', "32V 276979E", "6658157N", true},
+		{"Norway's west edge", 56, 3, 32, 'V', "32V 126049E", "6222336N", true},
+		{"north of Norway's zone", 64, 3, 31, 'W', "31W 500000E", "7097014N", true},
+
+		// Svalbard is in 31X, 33X, 35X and 37X, which are wider still
+		{"Longyearbyen", 78.2232, 15.6267, 33, 'X', "33X 514278E", "8683355N", true},
+		{"Svalbard 31X", 72, 8.9, 31, 'X', "31X 703202E", "7998893N", true},
+		{"Svalbard 33X", 72, 9, 33, 'X', "33X 293363E", "7999233N", true},
+		{"Svalbard 35X", 80, 21, 35, 'X', "35X 383885E", "8887579N", true},
+		{"Svalbard 37X", 83.9, 41.9, 37, 'X', "37X 534390E", "9317795N", true},
+		{"east of Svalbard", 83.9, 42, 38, 'X', "38X 464424E", "9317856N", true},
+
+		{"southern limit", -80, 0, 31, 'C', "31C 441867E", "1116915N", true},
+		{"north pole", 84, 0, 0, 0, "POLAR", "", false},
+		{"south pole", -80.5, 0, 0, 0, "POLAR", "", false},
+	}
+
+	for _, tt := range tests {
+		zone, band, _, _, ok := toUTM(tt.lat, tt.lon)
+		if zone != tt.zone || band != tt.band || ok != tt.ok {
+			t.Errorf("%v: toUTM(%v, %v) = zone %v%c, %v, want %v%c, %v", tt.name, tt.lat, tt.lon, zone, band, ok, tt.zone, tt.band, tt.ok)
+		}
+
+		e, n := coordStrings(geospatial.Point{Lat: tt.lat, Lon: tt.lon}, coordUTM)
+		if e != tt.e || n != tt.n {
+			t.Errorf("%v: UTM %q %q, want %q %q", tt.name, e, n, tt.e, tt.n)
+		}
+	}
+}
+
+func TestToMGRS(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		want     string
+		ok       bool
+	}{
+		{"Seattle", 47.6062, -122.3321, "10T ET 50200 72748", true},
+		{"Sydney", -33.8688, 151.2093, "56H LH 34368 50948", true},
+		{"Norway", 60, 5, "32V KM 76979 58157", true},
+		{"Longyearbyen", 78.2232, 15.6267, "33X WG 14278 83355", true},
+		{"equator", 0, 0, "31N AA 66021 00000", true},
+		{"north pole", 84, 0, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := toMGRS(tt.lat, tt.lon)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%v: toMGRS(%v, %v) = %q, %v, want %q, %v", tt.name, tt.lat, tt.lon, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// coordStrings splits it into the square and the easting, then the northing
+	a, b := coordStrings(geospatial.Point{Lat: 47.6062, Lon: -122.3321}, coordMGRS)
+	if a != "10T ET 50200" || b != "72748" {
+		t.Errorf("MGRS lines = %q, %q, want %q, %q", a, b, "10T ET 50200", "72748")
+	}
+}
+
+func TestMaidenhead(t *testing.T) {
+	tests := []struct {
+		lat, lon float64
+		want     string
+	}{
+		{47.6062, -122.3321, "CN87uo"},
+		{-33.8688, 151.2093, "QF56od"},
+		{60, 5, "JP20ma"},
+		{0, 0, "JJ00aa"},
+		{-90, -180, "AA00aa"},
+		{90, 180, "RR99xx"},
+	}
+
+	for _, tt := range tests {
+		if got := maidenhead(tt.lat, tt.lon); got != tt.want {
+			t.Errorf("maidenhead(%v, %v) = %q, want %q", tt.lat, tt.lon, got, tt.want)
+		}
+	}
+}
+
+func TestLatLonStrings(t *testing.T) {
+	tests := []struct {
+		format string
+		p      geospatial.Point
+		want   string
+	}{
+		{coordDD, geospatial.Point{Lat: 47.6062, Lon: -122.3321}, " 47.606° N / 122.332° W"},
+		{coordDD, geospatial.Point{Lat: -33.8688, Lon: 151.2093}, " 33.869° S / 151.209° E"},
+		{coordDDM, geospatial.Point{Lat: 47.6062, Lon: -122.3321}, " 47°36.37' N / 122°19.93' W"},
+		{coordDMS, geospatial.Point{Lat: 47.6062, Lon: -122.3321}, " 47°36'22\" N / 122°19'56\" W"},
+
+		// Rounding carries into the minutes and degrees
+		{coordDDM, geospatial.Point{Lat: 47.99999, Lon: -122.99999}, " 48°00.00' N / 123°00.00' W"},
+		{coordDMS, geospatial.Point{Lat: 47.99999, Lon: -122.9999999}, " 48°00'00\" N / 123°00'00\" W"},
+
+		{coordUTM, geospatial.Point{Lat: 47.6062, Lon: -122.3321}, "10T 550200E 5272748N"},
+		{coordMGRS, geospatial.Point{Lat: 47.6062, Lon: -122.3321}, "10T ET 50200 72748"},
+		{coordGrid, geospatial.Point{Lat: 47.6062, Lon: -122.3321}, "CN87uo"},
+	}
+
+	for _, tt := range tests {
+		if got := coordString(tt.p, tt.format); got != tt.want {
+			t.Errorf("coordString(%+v, %v) = %q, want %q", tt.p, tt.format, got, tt.want)
+		}
+	}
+}
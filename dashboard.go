@@ -0,0 +1,230 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	dashboardUpdateInterval = time.Second
+	dashboardWriteTimeout   = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+func (w *webServer) handleDashboard(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(rw, r)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.Write([]byte(dashboardHTML))
+}
+
+// handleWebSocket streams a TrackerState to the browser every second until
+// the browser goes away
+func (w *webServer) handleWebSocket(rw http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(rw, r, nil)
+	if err != nil {
+		log.Printf("Error upgrading dashboard connection from %v: %v", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+
+	log.Printf("Dashboard client connected from %v", r.RemoteAddr)
+
+	// We don't expect anything from the browser but we have to read in order
+	// to notice when it hangs up.
+	closed := make(chan bool)
+	go func() {
+		for {
+			_, _, err := conn.ReadMessage()
+			if err != nil {
+				close(closed)
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(dashboardUpdateInterval)
+	defer ticker.Stop()
+
+	for {
+		conn.SetWriteDeadline(time.Now().Add(dashboardWriteTimeout))
+		err = conn.WriteJSON(snapshotState(w.a, w.g))
+		if err != nil {
+			log.Printf("Dashboard client %v went away: %v", r.RemoteAddr, err)
+			return
+		}
+
+		select {
+		case <-closed:
+			log.Printf("Dashboard client %v disconnected", r.RemoteAddr)
+			return
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dashboardHTML is served as-is.  Everything the page needs is inline so
+// that it works in a car with no Internet connection.
+const dashboardHTML = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>GopherTrak</title>
+<style>
+  body { background: #000; color: #fff; font-family: monospace; margin: 0; padding: 1em; }
+  h1 { color: #55f; font-size: 1.1em; border-bottom: 3px double #55f; padding-bottom: .3em; }
+  h2 { color: #f55; font-size: 1em; text-decoration: underline; margin: 1em 0 .5em 0; }
+  th { color: #5ff; text-align: left; text-decoration: underline; padding-right: 2em; }
+  td { padding-right: 2em; white-space: nowrap; }
+  .panels { display: flex; flex-wrap: wrap; gap: 3em; }
+  .label { color: #ccc; text-align: right; }
+  .mine { color: #ff5; }
+  .up { color: #5f5; }
+  .down { color: #f55; }
+  .packets td:last-child { white-space: normal; word-break: break-all; }
+  #status { position: fixed; bottom: 0; left: 0; right: 0; background: #00a; padding: .3em 1em; }
+  #status span { margin-right: 2em; }
+</style>
+</head>
+<body>
+<h1>ʕ◔ϖ◔ʔ GopherTrak</h1>
+<div class="panels">
+  <div>
+    <h2>PAYLOAD</h2>
+    <table>
+      <tr><td class="label">CALLSIGN:</td><td id="p-call">---------</td></tr>
+      <tr><td class="label">LAST:</td><td id="p-last" class="up">---------</td></tr>
+      <tr><td class="label">TELEMETRY:</td><td id="p-tlm">-</td></tr>
+      <tr><td class="label">ALTITUDE:</td><td id="p-alt">---------</td></tr>
+      <tr><td class="label">SPEED:</td><td id="p-spd">---------</td></tr>
+      <tr><td class="label">COURSE:</td><td id="p-crs">---°</td></tr>
+      <tr><td class="label">ELEV Δ:</td><td id="p-rate"></td></tr>
+      <tr><td class="label">POSITION:</td><td id="p-pos">------°- / -------°-</td></tr>
+      <tr><td class="label">LANDING:</td><td id="p-land">-</td></tr>
+    </table>
+  </div>
+  <div>
+    <h2>CHASERS</h2>
+    <table>
+      <tr><th>CALLSIGN</th><th>FROM ME</th><th>FROM PAYLOAD</th></tr>
+      <tbody id="chasers"></tbody>
+    </table>
+  </div>
+</div>
+<h2>RECENT PACKETS</h2>
+<table class="packets">
+  <tr><th>AGE</th><th>SOURCE</th><th>TYPE</th><th>CONTENTS</th></tr>
+  <tbody id="packets"></tbody>
+</table>
+<div id="status">
+  <span id="s-tnc">TNC: -</span>
+  <span id="s-gps">GPS: -</span>
+  <span id="s-ws" class="down">DISCONNECTED</span>
+</div>
+<script>
+(function() {
+  function $(id) { return document.getElementById(id); }
+
+  function text(id, s) { $(id).textContent = s; }
+
+  function latlon(p) {
+    return Math.abs(p.lat).toFixed(3) + "° " + (p.lat > 0 ? "N" : "S") + " / " +
+           Math.abs(p.lon).toFixed(3) + "° " + (p.lon > 0 ? "E" : "W");
+  }
+
+  var units = {altitude: "feet", speed: "mph", distance: "mi", rate: "ft/min"};
+
+  function vector(v) {
+    return v ? v.distance.toFixed(1) + " " + units.distance + " @ " + v.bearing + "°" : "- NOT HEARD -";
+  }
+
+  function row(cells, cls) {
+    var tr = document.createElement("tr");
+    if (cls) { tr.className = cls; }
+    cells.forEach(function(c) {
+      var td = document.createElement("td");
+      td.textContent = c;
+      tr.appendChild(td);
+    });
+    return tr;
+  }
+
+  function link(id, name, l) {
+    var el = $(id);
+    el.textContent = name + ": " + l.address + " " + (l.connected ? "✓" : "✘");
+    el.className = l.connected ? "up" : "down";
+  }
+
+  function render(st) {
+    units = st.units;
+    var p = st.payload;
+    text("p-call", p.callsign);
+    text("p-last", p.age || "---------");
+    text("p-tlm", p.telemetry ? p.telemetry.join(" / ") : "-");
+    if (p.position) {
+      text("p-alt", Math.round(p.position.altitude).toLocaleString() + " " + units.altitude);
+      text("p-spd", Math.round(p.position.speed) + " " + units.speed);
+      text("p-crs", p.position.heading + "°");
+      text("p-pos", latlon(p.position));
+    }
+    if (p.verticalRate !== undefined) {
+      $("p-rate").className = p.verticalRate >= 0 ? "up" : "down";
+      var rate = units.rate === "m/s" ? p.verticalRate.toFixed(1) : Math.round(p.verticalRate);
+      text("p-rate", (p.verticalRate >= 0 ? "+" : "") + rate + " " + units.rate);
+    }
+    if (st.landing && st.landing.position) {
+      text("p-land", latlon(st.landing.position) + " ETA " + new Date(st.landing.eta).toLocaleTimeString());
+    } else {
+      text("p-land", "-");
+    }
+
+    var chasers = $("chasers");
+    chasers.innerHTML = "";
+    chasers.appendChild(row(["* " + st.me.callsign, "N/A", vector(st.me.fromPayload)], "mine"));
+    st.chasers.forEach(function(c) {
+      chasers.appendChild(row([c.callsign, vector(c.fromMe), vector(c.fromPayload)]));
+    });
+
+    var packets = $("packets");
+    packets.innerHTML = "";
+    st.packets.forEach(function(k) {
+      packets.appendChild(row([k.age, k.source, k.type, k.body]));
+    });
+
+    link("s-tnc", "TNC", st.connections.tnc);
+    link("s-gps", "GPS", st.connections.gps);
+  }
+
+  function connect() {
+    var proto = location.protocol === "https:" ? "wss://" : "ws://";
+    // Pass on ?token= from the page's URL when the server has -apitoken set
+    var ws = new WebSocket(proto + location.host + "/ws" + location.search);
+    ws.onopen = function() {
+      text("s-ws", "LIVE");
+      $("s-ws").className = "up";
+    };
+    ws.onmessage = function(ev) { render(JSON.parse(ev.data)); };
+    ws.onclose = function() {
+      text("s-ws", "DISCONNECTED");
+      $("s-ws").className = "down";
+      setTimeout(connect, 2000);
+    };
+  }
+
+  connect();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/ax25"
+	"github.com/chrissnell/gophertrak/draw"
+	"strings"
+)
+
+// APRS packet types, as shown in the TYPE column.  They're classified by the
+// data type identifier, the first character of the information field.
+const (
+	typePosition     = "POS"
+	typePosTelemetry = "POS+TLM"
+	typeMicE         = "MICE"
+	typeStatus       = "STATUS"
+	typeObject       = "OBJECT"
+	typeItem         = "ITEM"
+	typeWeather      = "WX"
+	typeMessage      = "MSG"
+	typeAck          = "ACK"
+	typeBulletin     = "BLN"
+	typeTelemetry    = "TLM"
+	typeTelemDef     = "TLMDEF"
+	typeQuery        = "QUERY"
+	typeCapabilities = "CAPS"
+	typeThirdParty   = "3RDPTY"
+	typeNMEA         = "NMEA"
+	typeGrid         = "GRID"
+	typeDF           = "DF"
+	typeUserDefined  = "USER"
+	typeTest         = "TEST"
+	typeUnknown      = "?"
+)
+
+// packetTypes is every type, in the order the filter cycles through them
+var packetTypes = []string{
+	typePosition, typePosTelemetry, typeMicE, typeStatus, typeObject, typeItem,
+	typeWeather, typeMessage, typeAck, typeBulletin, typeTelemetry, typeTelemDef,
+	typeQuery, typeCapabilities, typeThirdParty, typeNMEA, typeGrid, typeDF,
+	typeUserDefined, typeTest, typeUnknown,
+}
+
+// infoField returns the packet's information field, undecoded
+func infoField(pkt ax25.APRSPacket) string {
+	if pkt.OriginalBody != "" {
+		return pkt.OriginalBody
+	}
+	return pkt.Body
+}
+
+// classifyBody works out a packet's type from its information field
+func classifyBody(body string) string {
+	if body == "" {
+		return typeUnknown
+	}
+
+	switch body[0] {
+	case '!', '=', '/', '@':
+		if _, code, ok := packetSymbol(body); ok && code == '_' {
+			return typeWeather
+		}
+		return typePosition
+	case '`', '\'', 0x1c, 0x1d:
+		return typeMicE
+	case '>':
+		return typeStatus
+	case ';':
+		return typeObject
+	case ')':
+		return typeItem
+	case '_', '#', '*':
+		return typeWeather
+	case ':':
+		return classifyMessage(body)
+	case 'T':
+		if strings.HasPrefix(body, "T#") {
+			return typeTelemetry
+		}
+	case '?':
+		return typeQuery
+	case '<':
+		return typeCapabilities
+	case '}':
+		return typeThirdParty
+	case '$':
+		if strings.HasPrefix(body, "$ULTW") {
+			return typeWeather
+		}
+		return typeNMEA
+	case '[':
+		return typeGrid
+	case '%':
+		return typeDF
+	case '{':
+		return typeUserDefined
+	case ',':
+		return typeTest
+	}
+
+	return typeUnknown
+}
+
+// classifyMessage sorts the : packets into messages, acks, bulletins and
+// telemetry definitions.  The addressee is always padded to nine characters.
+func classifyMessage(body string) string {
+	if len(body) < 11 || body[10] != ':' {
+		return typeMessage
+	}
+
+	addressee := strings.TrimSpace(body[1:10])
+	text := body[11:]
+
+	switch {
+	case strings.HasPrefix(addressee, "BLN"), strings.HasPrefix(addressee, "NWS"):
+		return typeBulletin
+	case strings.HasPrefix(text, "PARM."), strings.HasPrefix(text, "UNIT."),
+		strings.HasPrefix(text, "EQNS."), strings.HasPrefix(text, "BITS."):
+		return typeTelemDef
+	case strings.HasPrefix(text, "ack"), strings.HasPrefix(text, "rej"):
+		return typeAck
+	}
+	return typeMessage
+}
+
+// packetSymbol finds the symbol table and code in a position report, Mic-E
+// report or object
+func packetSymbol(body string) (byte, byte, bool) {
+	if body == "" {
+		return 0, 0, false
+	}
+
+	var p string
+	switch body[0] {
+	case '!', '=':
+		p = body[1:]
+	case '/', '@':
+		// These carry a seven-character timestamp first
+		if len(body) < 8 {
+			return 0, 0, false
+		}
+		p = body[8:]
+	case ';':
+		// Objects have a nine-character name, live/killed flag and timestamp
+		if len(body) < 18 {
+			return 0, 0, false
+		}
+		p = body[18:]
+	case '`', '\'', 0x1c, 0x1d:
+		// Mic-E puts them right after the longitude and speed/course bytes
+		if len(body) < 9 {
+			return 0, 0, false
+		}
+		return body[8], body[7], true
+	default:
+		return 0, 0, false
+	}
+
+	if p == "" {
+		return 0, 0, false
+	}
+
+	// Uncompressed positions start with a digit (or a space, if ambiguous)
+	// and have the table between latitude and longitude and the code after.
+	// Compressed ones start with the table.
+	if p[0] >= '0' && p[0] <= '9' || p[0] == ' ' {
+		if len(p) > 18 {
+			return p[8], p[18], true
+		}
+		return 0, 0, false
+	}
+	if len(p) > 9 {
+		return p[0], p[9], true
+	}
+	return 0, 0, false
+}
+
+// packetType classifies a packet, using what the decoder found to pick out
+// the positions that also carry telemetry
+func packetType(v PayloadPacket) string {
+	t := classifyBody(infoField(v.pkt))
+	if t == typePosition && (v.data.CompressedTelemetry.A1 != 0 || v.data.StandardTelemetry.A1 != 0) {
+		return typePosTelemetry
+	}
+	return t
+}
+
+func packetTypeStyle(t string) draw.Style {
+	switch t {
+	case typePosition, typePosTelemetry, typeMicE:
+		return draw.GreenText
+	case typeMessage, typeAck, typeBulletin:
+		return draw.YellowText
+	case typeTelemetry, typeTelemDef:
+		return draw.CyanText
+	case typeObject, typeItem, typeWeather:
+		return draw.PurpleText
+	case typeStatus:
+		return draw.WhiteText
+	case typeUnknown:
+		return draw.RedText
+	}
+	return draw.GreyText
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestClassifyBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"", typeUnknown},
+		{"!4903.50N/07201.75W-Test 001234", typePosition},
+		{"=4903.50N/07201.75W-", typePosition},
+		{"@092345z4903.50N/07201.75W>088/036", typePosition},
+		{"/092345z4903.50N/07201.75W>", typePosition},
+		{"!/5L!!<*e7>7P[", typePosition},
+		{"!4903.50N/07201.75W_220/004g005t077r000p000P000h50b09900", typeWeather},
+		{"@092345z4903.50N/07201.75W_220/004g005t077", typeWeather},
+		{"_10090556c220s004g005t077r000p000P000h50b09900wRSW", typeWeather},
+		{"$ULTW0000000001FF000427C70002CCD30001026E003A050F00040000", typeWeather},
+		{"`(_fn\"Oj/]=", typeMicE},
+		{"'(_fn\"Oj/", typeMicE},
+		{">Net Control Center", typeStatus},
+		{";LEADER   *092345z4903.50N/07201.75W>088/036", typeObject},
+		{")AID #2!4903.50N/07201.75WA", typeItem},
+		{":WU2Z     :Testing", typeMessage},
+		{":WU2Z     :Testing{003", typeMessage},
+		{":KB2ICI-14:ack003", typeAck},
+		{":KB2ICI-14:rej003", typeAck},
+		{":BLN3     :Snow expected in Tampa RSN", typeBulletin},
+		{":NWS-WARN :092010z,THUNDER_STORM,AR_ASHLEY", typeBulletin},
+		{":N0CALL-11:PARM.Battery,Temp", typeTelemDef},
+		{":N0CALL-11:UNIT.Volts,deg.F", typeTelemDef},
+		{":N0CALL-11:EQNS.0,0.01,0,0,1,0", typeTelemDef},
+		{":N0CALL-11:BITS.11111111,Balloon", typeTelemDef},
+		{":SHORT:text", typeMessage},
+		{"T#005,199,000,255,073,123,01101001", typeTelemetry},
+		{"Test without a hash", typeUnknown},
+		{"?APRS?", typeQuery},
+		{"<IGATE,MSG_CNT=30,LOC_CNT=61", typeCapabilities},
+		{"}N0CALL>APRS,TCPIP,N0CALL*:>status", typeThirdParty},
+		{"$GPRMC,063909,A,3349.4302,N,11700.3721,W,43.022,89.3,291099,13.6,E*52", typeNMEA},
+		{"[IO91SX] 35 miles NNW of London", typeGrid},
+		{"%DF report", typeDF},
+		{"{Q1qwerty", typeUserDefined},
+		{",test packet", typeTest},
+		{"xyzzy", typeUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := classifyBody(tt.body); got != tt.want {
+			t.Errorf("classifyBody(%q) = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestPacketSymbol(t *testing.T) {
+	tests := []struct {
+		body       string
+		table, sym byte
+		ok         bool
+	}{
+		{"!4903.50N/07201.75W-Test", '/', '-', true},
+		{"@092345z4903.50N\\07201.75WO/A=001234", '\\', 'O', true},
+		{"!/5L!!<*e7>7P[", '/', '>', true},
+		{";LEADER   *092345z4903.50N/07201.75W>088/036", '/', '>', true},
+		{"`(_fn\"Oj/]=", '/', 'j', true},
+		{"!4903.50N", 0, 0, false},
+		{"@0923", 0, 0, false},
+		{">status", 0, 0, false},
+		{"", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		table, sym, ok := packetSymbol(tt.body)
+		if table != tt.table || sym != tt.sym || ok != tt.ok {
+			t.Errorf("packetSymbol(%q) = %q, %q, %v, want %q, %q, %v", tt.body, table, sym, ok, tt.table, tt.sym, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/ax25"
+	"sync"
+	"time"
+)
+
+// Copies of a packet heard within this long of the first are duplicates.  This
+// is the same window that digipeaters use.
+const dupWindow = 30 * time.Second
+
+// Arrival is one copy of a packet: the path it came by and when we heard it
+type Arrival struct {
+	Path []ax25.APRSAddress
+	Time time.Time
+}
+
+// arrivals is every copy we've heard of a packet.  Copies of a PayloadPacket
+// share it, so a duplicate heard later shows up wherever the packet went.
+type arrivals struct {
+	mu   sync.Mutex
+	list []Arrival
+}
+
+func (ar *arrivals) add(path []ax25.APRSAddress, ts time.Time) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.list = append(ar.list, Arrival{Path: path, Time: ts})
+}
+
+// All returns every copy of the packet, in the order they arrived
+func (ar *arrivals) All() []Arrival {
+	if ar == nil {
+		return nil
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	all := make([]Arrival, len(ar.list))
+	copy(all, ar.list)
+	return all
+}
+
+// Arrivals returns every copy we heard of this packet, including the first
+func (pp PayloadPacket) Arrivals() []Arrival {
+	if pp.arrivals == nil {
+		return []Arrival{{Path: pp.pkt.Path, Time: pp.ts}}
+	}
+	return pp.arrivals.All()
+}
+
+type dedupEntry struct {
+	first    time.Time
+	arrivals *arrivals
+}
+
+// dedupFilter spots packets we've already heard by another path.  Packets
+// are the same if they have the same source and information field.
+type dedupFilter struct {
+	mu   sync.Mutex
+	seen map[string]dedupEntry
+}
+
+// Check records a packet's arrival.  It returns the arrival list the packet
+// belongs to, and whether it's a duplicate of one we've already heard.
+func (d *dedupFilter) Check(pkt ax25.APRSPacket, ts time.Time) (*arrivals, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.seen == nil {
+		d.seen = make(map[string]dedupEntry)
+	}
+
+	// Forget packets that are too old to be duplicated
+	for k, e := range d.seen {
+		if ts.Sub(e.first) > dupWindow {
+			delete(d.seen, k)
+		}
+	}
+
+	key := pkt.Source.String() + ">" + infoField(pkt)
+	if e, ok := d.seen[key]; ok {
+		e.arrivals.add(pkt.Path, ts)
+		return e.arrivals, true
+	}
+
+	ar := &arrivals{}
+	ar.add(pkt.Path, ts)
+	d.seen[key] = dedupEntry{first: ts, arrivals: ar}
+	return ar, false
+}
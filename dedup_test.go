@@ -0,0 +1,154 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/ax25"
+	"testing"
+	"time"
+)
+
+var (
+	// WIDE1-1,WIDE2-2 untouched: heard straight from the station
+	directPath = []ax25.APRSAddress{{Callsign: "WIDE1", SSID: 1}, {Callsign: "WIDE2", SSID: 2}}
+
+	// Relayed by K7DIG-1, which used up the WIDE1-1 hop
+	digiPath = []ax25.APRSAddress{{Callsign: "K7DIG", SSID: 1}, {Callsign: "WIDE1"}, {Callsign: "WIDE2", SSID: 2}}
+)
+
+func testPacket(call, body string, path []ax25.APRSAddress) ax25.APRSPacket {
+	src, _ := parseAddress(call)
+	return ax25.APRSPacket{Source: src, Path: path, Body: body}
+}
+
+func TestDedupFilter(t *testing.T) {
+	var d dedupFilter
+	t0 := time.Date(2014, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		pkt     ax25.APRSPacket
+		at      time.Duration
+		wantDup bool
+		wantArr int // Arrivals of the packet so far
+	}{
+		{"first copy", testPacket("N0CALL-11", "!4903.50N/07201.75WO", digiPath), 0, false, 1},
+		{"direct copy", testPacket("N0CALL-11", "!4903.50N/07201.75WO", directPath), 2 * time.Second, true, 2},
+		{"another station", testPacket("KF7FVH-1", "!4903.50N/07201.75WO", directPath), 3 * time.Second, false, 1},
+		{"new body", testPacket("N0CALL-11", "!4903.60N/07201.75WO", directPath), 4 * time.Second, false, 1},
+		{"late copy in window", testPacket("N0CALL-11", "!4903.50N/07201.75WO", digiPath), dupWindow, true, 3},
+		{"after the window", testPacket("N0CALL-11", "!4903.50N/07201.75WO", directPath), dupWindow + time.Second, false, 1},
+	}
+
+	for _, tt := range tests {
+		arr, dup := d.Check(tt.pkt, t0.Add(tt.at))
+		if dup != tt.wantDup {
+			t.Errorf("%v: dup = %v, want %v", tt.name, dup, tt.wantDup)
+		}
+		if n := len(arr.All()); n != tt.wantArr {
+			t.Errorf("%v: %v arrivals, want %v", tt.name, n, tt.wantArr)
+		}
+	}
+}
+
+func TestDedupUsesOriginalBody(t *testing.T) {
+	var d dedupFilter
+	now := time.Now()
+
+	// The decoder rewrites Body for some packets, so copies have to be
+	// matched on what was actually sent
+	p1 := testPacket("N0CALL-11", "decoded", directPath)
+	p1.OriginalBody = "`(_fn\"Oj/]="
+	p2 := testPacket("N0CALL-11", "decoded", digiPath)
+	p2.OriginalBody = "`(_fn\"Oj/]>"
+
+	d.Check(p1, now)
+	if _, dup := d.Check(p2, now); dup {
+		t.Error("packets with different original bodies were treated as duplicates")
+	}
+}
+
+// The heard list counts each packet once, by its best path
+func TestHeardFoldsInDuplicates(t *testing.T) {
+	var d dedupFilter
+	var h heardList
+	now := time.Now()
+
+	hearCopy := func(pkt ax25.APRSPacket) {
+		arr, dup := d.Check(pkt, now)
+		if dup {
+			h.Arrived(pkt, arr)
+			return
+		}
+		h.Record(pkt, nil, arr, now)
+	}
+
+	// First heard via a digi, then direct, then via the digi again
+	body := "!4903.50N/07201.75WO"
+	hearCopy(testPacket("N0CALL-11", body, digiPath))
+	hearCopy(testPacket("N0CALL-11", body, directPath))
+	hearCopy(testPacket("N0CALL-11", body, digiPath))
+
+	// A later packet that only came via the digi
+	hearCopy(testPacket("N0CALL-11", "!4903.60N/07201.75WO", digiPath))
+
+	st := h.Stations()
+	if len(st) != 1 {
+		t.Fatalf("%v stations, want 1", len(st))
+	}
+	if st[0].Packets != 2 || st[0].Direct != 1 || st[0].Digipeated != 1 {
+		t.Errorf("packets/direct/digipeated = %v/%v/%v, want 2/1/1", st[0].Packets, st[0].Direct, st[0].Digipeated)
+	}
+	if st[0].HeardDirect() {
+		t.Error("last packet came via a digi but HeardDirect() is true")
+	}
+
+	// A direct copy of the first packet turning up late doesn't change the
+	// last packet's path
+	hearCopy(testPacket("N0CALL-11", body, directPath))
+	if st := h.Stations(); st[0].HeardDirect() || st[0].Direct != 1 {
+		t.Errorf("copy of an older packet changed the last packet: %+v", st[0])
+	}
+}
+
+// Path statistics count each packet once, but credit every digi that relayed
+// any copy of it
+func TestPathsFoldInDuplicates(t *testing.T) {
+	var d dedupFilter
+	var pa pathAnalysis
+	now := time.Now()
+
+	hearCopy := func(pkt ax25.APRSPacket) {
+		arr, _ := d.Check(pkt, now)
+		pa.Record(pkt, arr, now)
+	}
+
+	// Relayed by K7DIG-1 and then by K7DIG-1 and W7ABC-2 in turn
+	twoDigiPath := []ax25.APRSAddress{{Callsign: "K7DIG", SSID: 1}, {Callsign: "W7ABC", SSID: 2}, {Callsign: "WIDE2"}}
+
+	// Heard direct, then by way of both digi paths, then by K7DIG-1 again
+	body := "!4903.50N/07201.75WO"
+	hearCopy(testPacket("N0CALL-11", body, directPath))
+	hearCopy(testPacket("N0CALL-11", body, digiPath))
+	hearCopy(testPacket("N0CALL-11", body, twoDigiPath))
+	hearCopy(testPacket("N0CALL-11", body, digiPath))
+
+	// A later packet that only came via K7DIG-1
+	hearCopy(testPacket("N0CALL-11", "!4903.60N/07201.75WO", digiPath))
+
+	direct, relayed, digis := pa.Summary()
+	if direct != 1 || relayed != 1 {
+		t.Errorf("direct/digipeated = %v/%v, want 1/1", direct, relayed)
+	}
+
+	want := []DigiStats{
+		{Callsign: "K7DIG-1", Packets: 2, LastHop: 2},
+		{Callsign: "W7ABC-2", Packets: 1, LastHop: 1},
+	}
+	if len(digis) != len(want) {
+		t.Fatalf("digis %+v, want %+v", digis, want)
+	}
+	for i, w := range want {
+		if d := digis[i]; d.Callsign != w.Callsign || d.Packets != w.Packets || d.LastHop != w.LastHop {
+			t.Errorf("digi %v = %v %v packets, last hop %v, want %v %v, %v", i, d.Callsign, d.Packets, d.LastHop, w.Callsign, w.Packets, w.LastHop)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// gophertrak
+// canvas.go - An off-screen cell buffer that widgets draw into
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Cell is a single character on the screen and the style it's drawn in
+type Cell struct {
+	Ch    rune
+	Style Style
+}
+
+// Canvas is a grid of cells.  Widgets draw into a Canvas and the render loop
+// copies whatever changed out to the terminal.
+type Canvas struct {
+	w, h  int
+	cells []Cell
+}
+
+func NewCanvas(w, h int) *Canvas {
+	if w < 0 {
+		w = 0
+	}
+	if h < 0 {
+		h = 0
+	}
+
+	c := &Canvas{
+		w:     w,
+		h:     h,
+		cells: make([]Cell, w*h),
+	}
+	for i := range c.cells {
+		c.cells[i] = Cell{Ch: ' ', Style: Black}
+	}
+	return c
+}
+
+func (c *Canvas) Size() (int, int) {
+	return c.w, c.h
+}
+
+func (c *Canvas) Bounds() Rect {
+	return Rect{X: 0, Y: 0, W: c.w, H: c.h}
+}
+
+// Set draws a single cell.  Cells off the edge of the canvas are ignored.
+func (c *Canvas) Set(x, y int, ch rune, s Style) {
+	if x < 0 || y < 0 || x >= c.w || y >= c.h {
+		return
+	}
+	c.cells[y*c.w+x] = Cell{Ch: ch, Style: s}
+}
+
+func (c *Canvas) Get(x, y int) Cell {
+	if x < 0 || y < 0 || x >= c.w || y >= c.h {
+		return Cell{}
+	}
+	return c.cells[y*c.w+x]
+}
+
+// Print draws text at (x, y) relative to r, clipping anything that falls
+// outside of r.  It returns the number of columns the text occupied.
+func (c *Canvas) Print(r Rect, x, y int, s Style, t string) int {
+	n := 0
+	if y < 0 || y >= r.H {
+		return n
+	}
+
+	for _, ch := range t {
+		if x >= r.W {
+			break
+		}
+		if x >= 0 {
+			c.Set(r.X+x, r.Y+y, ch, s)
+		}
+		x++
+		n++
+	}
+	return n
+}
+
+// Fill paints every cell of r with spaces in style s
+func (c *Canvas) Fill(r Rect, s Style) {
+	for y := r.Y; y <= r.Bottom(); y++ {
+		for x := r.X; x <= r.Right(); x++ {
+			c.Set(x, y, ' ', s)
+		}
+	}
+}
+
+func (c *Canvas) HorizLine(leftX, rightX, y int, ls LineStyle, s Style) {
+	horizLine(c.Set, leftX, rightX, y, ls, s)
+}
+
+// TitledBox draws a box around the edge of r with a title in the top border
+func (c *Canvas) TitledBox(r Rect, ls LineStyle, s, ts Style, title string) {
+	if r.W < 2 || r.H < 2 {
+		return
+	}
+	titledBox(c.Set, r.X, r.Y, r.Right(), r.Bottom(), ls, s, ts, title)
+}
+
+// Text returns the characters in r, one line per row with trailing spaces
+// trimmed.  It's handy for comparing a single panel against a golden file.
+func (c *Canvas) Text(r Rect) string {
+	var lines []string
+	for y := r.Y; y <= r.Bottom(); y++ {
+		var b bytes.Buffer
+		for x := r.X; x <= r.Right(); x++ {
+			ch := c.Get(x, y).Ch
+			if ch == 0 {
+				ch = ' '
+			}
+			b.WriteRune(ch)
+		}
+		lines = append(lines, strings.TrimRight(b.String(), " "))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func (c *Canvas) String() string {
+	return c.Text(c.Bounds())
+}
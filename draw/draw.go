@@ -1,12 +1,11 @@
 // gophertrak
-// draw.go - Functions for drawing graphical elements using termbox-go
+// draw.go - Functions for drawing graphical elements on the Screen
 //
 // (c) 2014, Christopher Snell
 
 package draw
 
 import (
-	"github.com/nsf/termbox-go"
 	"log"
 	"sync"
 	"unicode/utf8"
@@ -25,91 +24,126 @@ const (
 )
 
 type Style struct {
-	Fg termbox.Attribute
-	Bg termbox.Attribute
+	Fg Attribute
+	Bg Attribute
 }
 
 var (
 	Mu sync.Mutex
 
 	Black Style = Style{
-		Fg: termbox.ColorBlack,
-		Bg: termbox.ColorBlack,
+		Fg: ColorBlack,
+		Bg: ColorBlack,
 	}
 	CyanText Style = Style{
-		Fg: termbox.ColorCyan | termbox.AttrBold,
-		Bg: termbox.ColorBlack,
+		Fg: ColorCyan | AttrBold,
+		Bg: ColorBlack,
 	}
 	WhiteText Style = Style{
-		Fg: termbox.ColorWhite | termbox.AttrBold,
-		Bg: termbox.ColorBlack,
+		Fg: ColorWhite | AttrBold,
+		Bg: ColorBlack,
 	}
 	BlueText Style = Style{
-		Fg: termbox.ColorBlue,
-		Bg: termbox.ColorBlack,
+		Fg: ColorBlue,
+		Bg: ColorBlack,
 	}
 	GreenText Style = Style{
-		Fg: termbox.ColorGreen | termbox.AttrBold,
-		Bg: termbox.ColorBlack,
+		Fg: ColorGreen | AttrBold,
+		Bg: ColorBlack,
 	}
 	YellowText Style = Style{
-		Fg: termbox.ColorYellow | termbox.AttrBold,
-		Bg: termbox.ColorBlack,
+		Fg: ColorYellow | AttrBold,
+		Bg: ColorBlack,
 	}
 	RedText Style = Style{
-		Fg: termbox.ColorRed | termbox.AttrBold,
-		Bg: termbox.ColorBlack,
+		Fg: ColorRed | AttrBold,
+		Bg: ColorBlack,
 	}
 	GreyText Style = Style{
-		Fg: termbox.ColorWhite,
-		Bg: termbox.ColorBlack,
+		Fg: ColorWhite,
+		Bg: ColorBlack,
 	}
 	WhiteOnBlueText Style = Style{
-		Fg: termbox.ColorWhite | termbox.AttrBold,
-		Bg: termbox.ColorBlue,
+		Fg: ColorWhite | AttrBold,
+		Bg: ColorBlue,
 	}
 	YellowOnBlueText Style = Style{
-		Fg: termbox.ColorYellow | termbox.AttrBold,
-		Bg: termbox.ColorBlue,
+		Fg: ColorYellow | AttrBold,
+		Bg: ColorBlue,
 	}
 	RedOnBlueText Style = Style{
-		Fg: termbox.ColorRed | termbox.AttrBold,
-		Bg: termbox.ColorBlue,
+		Fg: ColorRed | AttrBold,
+		Bg: ColorBlue,
+	}
+	WhiteOnRedText Style = Style{
+		Fg: ColorWhite | AttrBold,
+		Bg: ColorRed,
 	}
 	CyanOnBlueText Style = Style{
-		Fg: termbox.ColorCyan | termbox.AttrBold,
-		Bg: termbox.ColorBlue,
+		Fg: ColorCyan | AttrBold,
+		Bg: ColorBlue,
 	}
 	PurpleText Style = Style{
-		Fg: termbox.ColorMagenta,
-		Bg: termbox.ColorBlack,
+		Fg: ColorMagenta,
+		Bg: ColorBlack,
 	}
 	RedTitle Style = Style{
-		Fg: termbox.ColorRed | termbox.AttrBold | termbox.AttrUnderline,
-		Bg: termbox.ColorBlack,
+		Fg: ColorRed | AttrBold | AttrUnderline,
+		Bg: ColorBlack,
 	}
 	CyanTitle Style = Style{
-		Fg: termbox.ColorCyan | termbox.AttrBold | termbox.AttrUnderline,
-		Bg: termbox.ColorBlack,
+		Fg: ColorCyan | AttrBold | AttrUnderline,
+		Bg: ColorBlack,
 	}
 	YellowTitle Style = Style{
-		Fg: termbox.ColorYellow | termbox.AttrBold | termbox.AttrUnderline,
-		Bg: termbox.ColorBlack,
+		Fg: ColorYellow | AttrBold | AttrUnderline,
+		Bg: ColorBlack,
 	}
 )
 
-func Init() {
-	err := termbox.Init()
+// screen is where everything in this package ends up
+var screen Screen
+
+// Init makes s the Screen we draw on and gets it ready
+func Init(s Screen) {
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	screen = s
+	err := screen.Init()
 	if err != nil {
 		log.Fatalln(err)
 	}
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+	screen.HideCursor()
+	screen.Clear()
+
+	// Nothing's on the new screen yet, so the next Render draws every cell
+	front = nil
+}
+
+// Close shuts down the Screen, returning the terminal to normal
+func Close() {
+	Mu.Lock()
+	defer Mu.Unlock()
+	screen.Close()
+}
+
+// Beep rings the terminal bell
+func Beep() {
+	Mu.Lock()
+	defer Mu.Unlock()
+	screen.Beep()
+}
+
+// PollEvent waits for the next keypress, resize or other event on the Screen
+func PollEvent() Event {
+	return screen.PollEvent()
 }
 
 func Size() (int, int) {
 	Mu.Lock()
 	defer Mu.Unlock()
-	x, y := termbox.Size()
+	x, y := screen.Size()
 	x--
 	y--
 	return x, y
@@ -118,130 +152,109 @@ func Size() (int, int) {
 func SafeFlush() {
 	Mu.Lock()
 	defer Mu.Unlock()
-	termbox.Flush()
+	screen.Flush()
 }
 
 func Blank(leftX, rightX, y int, s Style) {
 	Mu.Lock()
 	defer Mu.Unlock()
 	for x := leftX; x <= rightX; x++ {
-		termbox.SetCell(x, y, ' ', s.Fg, s.Bg)
+		screen.SetCell(x, y, ' ', s)
 	}
 }
 
-func HorizLine(leftX, rightX, y int, ls LineStyle, s Style) {
-	var horizChar rune
+// cellSetter draws a single cell somewhere: straight to the Screen, or into a Canvas
+type cellSetter func(x, y int, ch rune, s Style)
 
-	Mu.Lock()
-	defer Mu.Unlock()
+// screenSetCell draws straight to the Screen.  Callers must hold Mu.
+func screenSetCell(x, y int, ch rune, s Style) {
+	screen.SetCell(x, y, ch, s)
+}
+
+type boxRunes struct {
+	horiz, vert                                rune
+	leftTitle, rightTitle                      rune
+	topLeft, topRight, bottomLeft, bottomRight rune
+}
 
+func boxChars(ls LineStyle) boxRunes {
 	switch ls {
-	case 0:
-		horizChar = '-'
-	case 1:
-		horizChar = '━'
-	case 2:
-		horizChar = '═'
-	case 3:
-		horizChar = '.'
+	case Solid:
+		return boxRunes{'━', '┃', '┫', '┣', '┏', '┓', '┗', '┛'}
+	case DoubleSolid:
+		return boxRunes{'═', '║', '╣', '╠', '╔', '╗', '╚', '╝'}
+	case Dots:
+		return boxRunes{'.', '.', '[', ']', '.', '.', '.', '.'}
+	default:
+		return boxRunes{'-', '|', '[', ']', '+', '+', '+', '+'}
 	}
+}
+
+func HorizLine(leftX, rightX, y int, ls LineStyle, s Style) {
+	Mu.Lock()
+	defer Mu.Unlock()
+	horizLine(screenSetCell, leftX, rightX, y, ls, s)
+}
+
+func horizLine(set cellSetter, leftX, rightX, y int, ls LineStyle, s Style) {
+	horizChar := boxChars(ls).horiz
 
 	for x := leftX; x <= rightX; x++ {
-		termbox.SetCell(x, y, horizChar, s.Fg, s.Bg)
+		set(x, y, horizChar, s)
 	}
 }
 
 func TitledBox(topLeftX, topLeftY, botRightX, botRightY int, ls LineStyle, s, ts Style, title string) {
-	var horizChar, vertChar, leftTitleChar, rightTitleChar rune
-	var topLeftChar, topRightChar, botLeftChar, botRightChar rune
-
 	Mu.Lock()
+	defer Mu.Unlock()
+	titledBox(screenSetCell, topLeftX, topLeftY, botRightX, botRightY, ls, s, ts, title)
+}
 
-	switch ls {
-	case 0:
-		horizChar = '-'
-		vertChar = '|'
-		leftTitleChar = '['
-		rightTitleChar = ']'
-		topLeftChar = '+'
-		topRightChar = '+'
-		botLeftChar = '+'
-		botRightChar = '+'
-	case 1:
-		horizChar = '━'
-		vertChar = '┃'
-		leftTitleChar = '┫'
-		rightTitleChar = '┣'
-		topLeftChar = '┏'
-		topRightChar = '┓'
-		botLeftChar = '┗'
-		botRightChar = '┛'
-	case 2:
-		horizChar = '═'
-		vertChar = '║'
-		leftTitleChar = '╣'
-		rightTitleChar = '╠'
-		topLeftChar = '╔'
-		topRightChar = '╗'
-		botLeftChar = '╚'
-		botRightChar = '╝'
-	case 3:
-		horizChar = '.'
-		vertChar = '.'
-		leftTitleChar = '['
-		rightTitleChar = ']'
-		topLeftChar = '.'
-		topRightChar = '.'
-		botLeftChar = '.'
-		botRightChar = '.'
-	}
+func titledBox(set cellSetter, topLeftX, topLeftY, botRightX, botRightY int, ls LineStyle, s, ts Style, title string) {
+	b := boxChars(ls)
 
 	// Top left
-	termbox.SetCell(topLeftX, topLeftY, topLeftChar, s.Fg, s.Bg)
+	set(topLeftX, topLeftY, b.topLeft, s)
 
 	// Top right
-	termbox.SetCell(botRightX, topLeftY, topRightChar, s.Fg, s.Bg)
+	set(botRightX, topLeftY, b.topRight, s)
 
 	// Bottom left
-	termbox.SetCell(topLeftX, botRightY, botLeftChar, s.Fg, s.Bg)
+	set(topLeftX, botRightY, b.bottomLeft, s)
 
 	// Bottom right
-	termbox.SetCell(botRightX, botRightY, botRightChar, s.Fg, s.Bg)
+	set(botRightX, botRightY, b.bottomRight, s)
 
 	// Title bar
-	termbox.SetCell(topLeftX+1, topLeftY, horizChar, s.Fg, s.Bg)
-	termbox.SetCell(topLeftX+2, topLeftY, leftTitleChar, s.Fg, s.Bg)
-	termbox.SetCell(topLeftX+3, topLeftY, ' ', s.Fg, s.Bg)
-	Mu.Unlock()
+	set(topLeftX+1, topLeftY, b.horiz, s)
+	set(topLeftX+2, topLeftY, b.leftTitle, s)
+	set(topLeftX+3, topLeftY, ' ', s)
 
-	PrintText(topLeftX+4, topLeftY, ts, title)
+	printText(set, topLeftX+4, topLeftY, ts, title)
 	startRestOfLine := topLeftX + 2 + utf8.RuneCount([]byte(title)) + 3
 
-	Mu.Lock()
-	termbox.SetCell(startRestOfLine-1, topLeftY, ' ', s.Fg, s.Bg)
-	termbox.SetCell(startRestOfLine, topLeftY, rightTitleChar, s.Fg, s.Bg)
+	set(startRestOfLine-1, topLeftY, ' ', s)
+	set(startRestOfLine, topLeftY, b.rightTitle, s)
 	for x := startRestOfLine + 1; x <= botRightX-1; x++ {
-		termbox.SetCell(x, topLeftY, horizChar, s.Fg, s.Bg)
-		if ls == 3 {
+		set(x, topLeftY, b.horiz, s)
+		if ls == Dots {
 			x++
 		}
 	}
 
 	// Sides
 	for y := topLeftY + 1; y < botRightY; y++ {
-		termbox.SetCell(topLeftX, y, vertChar, s.Fg, s.Bg)
-		termbox.SetCell(botRightX, y, vertChar, s.Fg, s.Bg)
+		set(topLeftX, y, b.vert, s)
+		set(botRightX, y, b.vert, s)
 	}
 
 	// Bottom
 	for x := topLeftX + 1; x <= botRightX-1; x++ {
-		termbox.SetCell(x, botRightY, horizChar, s.Fg, s.Bg)
-		if ls == 3 {
+		set(x, botRightY, b.horiz, s)
+		if ls == Dots {
 			x++
 		}
 	}
-
-	Mu.Unlock()
 }
 
 func PrintText(x, y int, s Style, t string) {
@@ -249,8 +262,12 @@ func PrintText(x, y int, s Style, t string) {
 	Mu.Lock()
 	defer Mu.Unlock()
 
+	printText(screenSetCell, x, y, s, t)
+}
+
+func printText(set cellSetter, x, y int, s Style, t string) {
 	for _, c := range t {
-		termbox.SetCell(x, y, c, s.Fg, s.Bg)
+		set(x, y, c, s)
 		x++
 	}
 }
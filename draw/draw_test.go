@@ -0,0 +1,153 @@
+// gophertrak
+// draw_test.go - Golden-snapshot tests of widgets rendered into a MemScreen
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got against testdata/name.golden, or rewrites the file
+// with -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		err := os.MkdirAll("testdata", 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(got), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%v doesn't match %v\ngot:\n%v\nwant:\n%s", name, path, got, want)
+	}
+}
+
+// render draws w into a w x h MemScreen through the render loop's path
+func render(t *testing.T, widget Widget, w, h int) *MemScreen {
+	t.Helper()
+	m := NewMemScreen(w, h)
+	Init(m)
+	SetRoot(widget)
+	Render()
+	SetRoot(nil)
+	return m
+}
+
+func TestPanelGolden(t *testing.T) {
+	p := NewTitledPanel("PAYLOAD", RedTitle)
+	p.Place(NewLabel(WhiteText, "ALTITUDE:"), Rect{X: 0, Y: 2})
+	p.Place(NewLabel(YellowText, "32,400 feet"), Rect{X: 11, Y: 2})
+	p.Place(NewLabel(WhiteText, "SPEED:"), Rect{X: 0, Y: 3})
+	p.Place(NewLabel(YellowText, "a label that is far too long to fit"), Rect{X: 11, Y: 3})
+
+	m := render(t, p, 27, 6)
+	golden(t, "panel", m.String())
+
+	if c := m.Cell(11, 2); c.Ch != '3' || c.Style != YellowText {
+		t.Errorf("cell (11, 2) = %q %+v, want '3' in YellowText", c.Ch, c.Style)
+	}
+}
+
+func TestTableGolden(t *testing.T) {
+	tb := NewTable(CyanTitle,
+		Column{Title: "", X: 0, Width: 1},
+		Column{Title: "CALLSIGN", X: 2, Width: 10},
+		Column{Title: "FROM ME", X: 13, Width: 14},
+	)
+	tb.SetRows([][]Span{
+		{{Text: "*", Style: RedText}, {Text: "N0CALL-9", Style: WhiteText}, {Text: "N/A", Style: WhiteText}},
+		{{}, {Text: "KF7FVH-1", Style: WhiteText}, {Text: "- NOT HEARD -", Style: WhiteText}},
+		{{}, {Text: "A7COG-2", Style: WhiteText}, {Text: "a value that overflows its column", Style: WhiteText}},
+	})
+	tb.Select(1)
+
+	m := render(t, tb, 30, 5)
+	golden(t, "table", m.String())
+
+	if tb.Len() != 3 {
+		t.Errorf("Len() = %v, want 3", tb.Len())
+	}
+}
+
+func TestStatusBarGolden(t *testing.T) {
+	b := NewStatusBar(WhiteOnBlueText, BlueText)
+	b.SetItems([]StatusItem{
+		{Spans: []Span{{Text: "TNC: 10.50.0.25:6700 ", Style: WhiteOnBlueText}, {Text: "✓", Style: YellowOnBlueText}},
+			Short: []Span{{Text: "TNC: ", Style: WhiteOnBlueText}, {Text: "✓", Style: YellowOnBlueText}}},
+		{Spans: []Span{{Text: "[F1]", Style: YellowOnBlueText}, {Text: " Send Message", Style: CyanOnBlueText}}, Key: KeyF1},
+		{Spans: []Span{{Text: "[ESC]", Style: YellowOnBlueText}, {Text: " Exit", Style: CyanOnBlueText}}, Key: KeyEsc},
+	})
+
+	golden(t, "statusbar_wide", render(t, b, 70, 1).String())
+	golden(t, "statusbar_narrow", render(t, b, 20, 1).String())
+}
+
+// A new Screen starts out blank, so the first Render after Init has to draw
+// every cell rather than just the ones that changed
+func TestRenderAfterInit(t *testing.T) {
+	l := NewLabel(WhiteText, "GOPHERTRAK")
+	first := render(t, l, 12, 1).String()
+	second := render(t, l, 12, 1).String()
+	if first != second || first != "GOPHERTRAK\n" {
+		t.Errorf("renders = %q then %q, want %q both times", first, second, "GOPHERTRAK\n")
+	}
+}
+
+func TestModalChoices(t *testing.T) {
+	m := NewModal(WhiteText, WhiteText, WhiteText)
+	m.ShowChoices("PICK", []string{"one", "two", "three", "", "Help text"}, 3)
+
+	moves := []struct{ n, want int }{{0, 0}, {1, 1}, {5, 2}, {-1, 1}, {-5, 0}, {1, 1}}
+	for _, mv := range moves {
+		if got := m.MoveSelection(mv.n); got != mv.want {
+			t.Errorf("MoveSelection(%v) = %v, want %v", mv.n, got, mv.want)
+		}
+	}
+
+	// Only the selected line is in reverse video
+	s := render(t, m, 40, 10)
+	found := 0
+	for y, line := range strings.Split(s.String(), "\n") {
+		for _, choice := range []string{"one", "two", "three"} {
+			i := strings.Index(line, choice+" ")
+			if i < 0 {
+				continue
+			}
+			found++
+			x := utf8.RuneCountInString(line[:i])
+			reversed := s.Cell(x, y).Style.Fg&AttrReverse != 0
+			if reversed != (choice == "two") {
+				t.Errorf("%q reversed = %v", choice, reversed)
+			}
+		}
+	}
+	if found != 3 {
+		t.Errorf("found %v of the 3 choices on screen:\n%v", found, s)
+	}
+
+	m.Show("NOTICE", []string{"text"}, nil)
+	if m.Selected() != -1 || m.MoveSelection(1) != -1 {
+		t.Error("a plain Show has a selection")
+	}
+}
@@ -0,0 +1,84 @@
+// gophertrak
+// layout.go - Screen regions that widgets are laid out in
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+// Rect is a rectangular region of the screen.  X and Y are the top-left cell.
+type Rect struct {
+	X, Y, W, H int
+}
+
+func (r Rect) Right() int {
+	return r.X + r.W - 1
+}
+
+func (r Rect) Bottom() int {
+	return r.Y + r.H - 1
+}
+
+func (r Rect) Empty() bool {
+	return r.W <= 0 || r.H <= 0
+}
+
+func (r Rect) Contains(x, y int) bool {
+	return x >= r.X && x <= r.Right() && y >= r.Y && y <= r.Bottom()
+}
+
+// Intersect returns the part of r that's also inside o
+func (r Rect) Intersect(o Rect) Rect {
+	x1, y1 := r.X, r.Y
+	if o.X > x1 {
+		x1 = o.X
+	}
+	if o.Y > y1 {
+		y1 = o.Y
+	}
+	x2, y2 := r.Right(), r.Bottom()
+	if o.Right() < x2 {
+		x2 = o.Right()
+	}
+	if o.Bottom() < y2 {
+		y2 = o.Bottom()
+	}
+	return clampRect(Rect{X: x1, Y: y1, W: x2 - x1 + 1, H: y2 - y1 + 1})
+}
+
+// Inset shrinks the rect by dx columns on the left and right and dy rows on the
+// top and bottom
+func (r Rect) Inset(dx, dy int) Rect {
+	return clampRect(Rect{X: r.X + dx, Y: r.Y + dy, W: r.W - 2*dx, H: r.H - 2*dy})
+}
+
+// SplitLeft cuts a column w cells wide off the left of the rect.  The remainder,
+// less gap columns, is returned as the right side.
+func (r Rect) SplitLeft(w, gap int) (Rect, Rect) {
+	if w > r.W {
+		w = r.W
+	}
+	left := Rect{X: r.X, Y: r.Y, W: w, H: r.H}
+	right := clampRect(Rect{X: r.X + w + gap, Y: r.Y, W: r.W - w - gap, H: r.H})
+	return left, right
+}
+
+// SplitTop cuts h rows off the top of the rect.  The remainder, less gap rows,
+// is returned as the bottom.
+func (r Rect) SplitTop(h, gap int) (Rect, Rect) {
+	if h > r.H {
+		h = r.H
+	}
+	top := Rect{X: r.X, Y: r.Y, W: r.W, H: h}
+	bottom := clampRect(Rect{X: r.X, Y: r.Y + h + gap, W: r.W, H: r.H - h - gap})
+	return top, bottom
+}
+
+func clampRect(r Rect) Rect {
+	if r.W < 0 {
+		r.W = 0
+	}
+	if r.H < 0 {
+		r.H = 0
+	}
+	return r
+}
@@ -0,0 +1,125 @@
+// gophertrak
+// memscreen.go - A Screen that lives entirely in memory, for rendering the UI
+// without a terminal
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"sync"
+)
+
+// MemScreen is a Screen backed by a cell buffer.  Nothing is shown anywhere;
+// instead you can read back exactly what would have been on the terminal as of
+// the last Flush, and feed it events with Inject.
+type MemScreen struct {
+	mu      sync.Mutex
+	w, h    int
+	pending *Canvas
+	flushed *Canvas
+	events  chan Event
+	beeps   int
+}
+
+func NewMemScreen(w, h int) *MemScreen {
+	return &MemScreen{
+		w:       w,
+		h:       h,
+		pending: NewCanvas(w, h),
+		flushed: NewCanvas(w, h),
+		events:  make(chan Event, 16),
+	}
+}
+
+func (m *MemScreen) Init() error {
+	return nil
+}
+
+func (m *MemScreen) Close() {}
+
+func (m *MemScreen) Size() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.w, m.h
+}
+
+func (m *MemScreen) SetCell(x, y int, ch rune, s Style) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending.Set(x, y, ch, s)
+}
+
+func (m *MemScreen) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pending = NewCanvas(m.w, m.h)
+}
+
+func (m *MemScreen) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushed = NewCanvas(m.w, m.h)
+	copy(m.flushed.cells, m.pending.cells)
+	return nil
+}
+
+func (m *MemScreen) Sync() error {
+	return m.Flush()
+}
+
+func (m *MemScreen) HideCursor() {}
+
+func (m *MemScreen) Beep() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.beeps++
+}
+
+// Beeps returns the number of times the bell has been rung
+func (m *MemScreen) Beeps() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.beeps
+}
+
+func (m *MemScreen) PollEvent() Event {
+	return <-m.events
+}
+
+// Inject queues an event for PollEvent to return
+func (m *MemScreen) Inject(ev Event) {
+	m.events <- ev
+}
+
+// Resize changes the screen's size and queues the EventResize that a terminal
+// would have sent
+func (m *MemScreen) Resize(w, h int) {
+	m.mu.Lock()
+	m.w, m.h = w, h
+	m.pending = NewCanvas(w, h)
+	m.mu.Unlock()
+	m.Inject(Event{Type: EventResize, Width: w, Height: h})
+}
+
+// Cell returns what was at (x, y) as of the last Flush
+func (m *MemScreen) Cell(x, y int) Cell {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flushed.Get(x, y)
+}
+
+// Text returns the text in r as of the last Flush, e.g. to compare one panel
+// against a golden file
+func (m *MemScreen) Text(r Rect) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flushed.Text(r)
+}
+
+// String returns the text on the screen as of the last Flush, one line per row
+func (m *MemScreen) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.flushed.String()
+}
@@ -0,0 +1,97 @@
+// gophertrak
+// render.go - The render loop that draws the widget tree to the Screen
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"sync"
+)
+
+var (
+	rootMu sync.Mutex
+	root   Widget
+
+	// front is what we last flushed to the Screen
+	front *Canvas
+
+	dirty = make(chan bool, 1)
+)
+
+// SetRoot sets the widget tree that Run draws
+func SetRoot(w Widget) {
+	rootMu.Lock()
+	root = w
+	rootMu.Unlock()
+	Invalidate()
+}
+
+// Invalidate tells the render loop that a widget has changed.  It never blocks,
+// so any goroutine can call it as often as it likes; changes made in quick
+// succession are drawn together.
+func Invalidate() {
+	select {
+	case dirty <- true:
+	default:
+	}
+}
+
+// Run redraws the widget tree every time it's invalidated, until quit is closed.
+// This is the only place that should be writing to the Screen.
+func Run(quit <-chan struct{}) {
+	for {
+		select {
+		case <-quit:
+			return
+		case <-dirty:
+			Render()
+		}
+	}
+}
+
+// Redraw forgets what's on the terminal and repaints all of it, e.g. after a resize
+func Redraw() {
+	Mu.Lock()
+	screen.Clear()
+	front = nil
+	Mu.Unlock()
+	Invalidate()
+}
+
+// Sync forces the Screen to repaint every cell
+func Sync() {
+	Mu.Lock()
+	defer Mu.Unlock()
+	screen.Sync()
+}
+
+// Render draws the widget tree to the Screen right now.  Run calls it whenever
+// something changes; calling it directly is useful when there's no render loop,
+// e.g. drawing into a MemScreen.
+func Render() {
+	rootMu.Lock()
+	w := root
+	rootMu.Unlock()
+
+	if w == nil {
+		return
+	}
+
+	Mu.Lock()
+	defer Mu.Unlock()
+
+	back := NewCanvas(screen.Size())
+	w.Draw(back, back.Bounds())
+
+	// Only touch the cells that changed since the last flush
+	full := front == nil || front.w != back.w || front.h != back.h
+	for i, cell := range back.cells {
+		if full || front.cells[i] != cell {
+			screen.SetCell(i%back.w, i/back.w, cell.Ch, cell.Style)
+		}
+	}
+	screen.Flush()
+
+	front = back
+}
@@ -0,0 +1,121 @@
+// gophertrak
+// screen.go - The Screen interface that draw renders into, and the colors,
+// attributes and events that go with it
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+// Screen is a terminal, or something pretending to be one.  Everything in this
+// package draws through the current Screen, so the UI can be rendered into
+// memory as easily as onto a real terminal.
+type Screen interface {
+	Init() error
+	Close()
+
+	// Size returns the number of columns and rows
+	Size() (int, int)
+
+	SetCell(x, y int, ch rune, s Style)
+	Clear()
+	Flush() error
+
+	// Sync repaints every cell, in case the terminal got scribbled on
+	Sync() error
+	HideCursor()
+
+	// Beep rings the terminal bell
+	Beep()
+
+	// PollEvent blocks until there's a keypress, resize or other event
+	PollEvent() Event
+}
+
+// Attribute is a color, optionally OR'd with AttrBold, AttrUnderline and AttrReverse
+type Attribute uint16
+
+const (
+	ColorDefault Attribute = iota
+	ColorBlack
+	ColorRed
+	ColorGreen
+	ColorYellow
+	ColorBlue
+	ColorMagenta
+	ColorCyan
+	ColorWhite
+)
+
+const (
+	AttrBold Attribute = 1 << (iota + 9)
+	AttrUnderline
+	AttrReverse
+)
+
+const colorMask Attribute = 0x1FF
+
+// Color returns just the color part of an attribute
+func (a Attribute) Color() Attribute {
+	return a & colorMask
+}
+
+type EventType uint8
+
+const (
+	EventKey EventType = iota
+	EventResize
+	EventMouse
+	EventError
+	EventInterrupt // The Screen was interrupted or shut down, so no more events are coming
+)
+
+type Key uint16
+
+// Keys that don't produce a character.  Printable keys come through as Ch.
+const (
+	KeyNone Key = iota
+	KeyF1
+	KeyF2
+	KeyF3
+	KeyF4
+	KeyF5
+	KeyF6
+	KeyF7
+	KeyF8
+	KeyF9
+	KeyF10
+	KeyF11
+	KeyF12
+	KeyInsert
+	KeyDelete
+	KeyHome
+	KeyEnd
+	KeyPgup
+	KeyPgdn
+	KeyArrowUp
+	KeyArrowDown
+	KeyArrowLeft
+	KeyArrowRight
+	KeyEnter
+	KeyEsc
+	KeyTab
+	KeySpace
+	KeyBackspace
+	KeyCtrlC
+	KeyCtrlL
+	KeyCtrlS
+)
+
+// Event is something that happened on the Screen.  Width and Height are set
+// for EventResize, and MouseX and MouseY for EventMouse, which is a click of
+// the left button.
+type Event struct {
+	Type   EventType
+	Key    Key
+	Ch     rune
+	Width  int
+	Height int
+	MouseX int
+	MouseY int
+	Err    error
+}
@@ -0,0 +1,157 @@
+// gophertrak
+// tcell.go - A Screen backed by tcell, with mouse support
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+type tcellScreen struct {
+	s tcell.Screen
+
+	// Whether the left button was down at the last mouse event, so that we
+	// only report the click once
+	button1 bool
+}
+
+// NewTcellScreen returns a Screen that draws on the real terminal via tcell.
+// Unlike termbox, it reports left-button clicks as EventMouse.
+func NewTcellScreen() Screen {
+	return &tcellScreen{}
+}
+
+var tcellKeys = map[tcell.Key]Key{
+	tcell.KeyF1:         KeyF1,
+	tcell.KeyF2:         KeyF2,
+	tcell.KeyF3:         KeyF3,
+	tcell.KeyF4:         KeyF4,
+	tcell.KeyF5:         KeyF5,
+	tcell.KeyF6:         KeyF6,
+	tcell.KeyF7:         KeyF7,
+	tcell.KeyF8:         KeyF8,
+	tcell.KeyF9:         KeyF9,
+	tcell.KeyF10:        KeyF10,
+	tcell.KeyF11:        KeyF11,
+	tcell.KeyF12:        KeyF12,
+	tcell.KeyInsert:     KeyInsert,
+	tcell.KeyDelete:     KeyDelete,
+	tcell.KeyHome:       KeyHome,
+	tcell.KeyEnd:        KeyEnd,
+	tcell.KeyPgUp:       KeyPgup,
+	tcell.KeyPgDn:       KeyPgdn,
+	tcell.KeyUp:         KeyArrowUp,
+	tcell.KeyDown:       KeyArrowDown,
+	tcell.KeyLeft:       KeyArrowLeft,
+	tcell.KeyRight:      KeyArrowRight,
+	tcell.KeyEnter:      KeyEnter,
+	tcell.KeyEscape:     KeyEsc,
+	tcell.KeyTab:        KeyTab,
+	tcell.KeyBackspace:  KeyBackspace,
+	tcell.KeyBackspace2: KeyBackspace,
+	tcell.KeyCtrlC:      KeyCtrlC,
+	tcell.KeyCtrlL:      KeyCtrlL,
+	tcell.KeyCtrlS:      KeyCtrlS,
+}
+
+// Our eight colors are the terminal's basic ANSI palette, which tcell names
+// after their dim variants.  Bold brightens them just like it does on termbox.
+var tcellColors = map[Attribute]tcell.Color{
+	ColorDefault: tcell.ColorDefault,
+	ColorBlack:   tcell.ColorBlack,
+	ColorRed:     tcell.ColorMaroon,
+	ColorGreen:   tcell.ColorGreen,
+	ColorYellow:  tcell.ColorOlive,
+	ColorBlue:    tcell.ColorNavy,
+	ColorMagenta: tcell.ColorPurple,
+	ColorCyan:    tcell.ColorTeal,
+	ColorWhite:   tcell.ColorSilver,
+}
+
+func tcellStyle(s Style) tcell.Style {
+	return tcell.StyleDefault.
+		Foreground(tcellColors[s.Fg.Color()]).
+		Background(tcellColors[s.Bg.Color()]).
+		Bold(s.Fg&AttrBold != 0).
+		Underline(s.Fg&AttrUnderline != 0).
+		Reverse(s.Fg&AttrReverse != 0)
+}
+
+func (t *tcellScreen) Init() error {
+	s, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	err = s.Init()
+	if err != nil {
+		return err
+	}
+	s.EnableMouse()
+	t.s = s
+	return nil
+}
+
+func (t *tcellScreen) Close() {
+	t.s.Fini()
+}
+
+func (t *tcellScreen) Size() (int, int) {
+	return t.s.Size()
+}
+
+func (t *tcellScreen) SetCell(x, y int, ch rune, s Style) {
+	t.s.SetContent(x, y, ch, nil, tcellStyle(s))
+}
+
+func (t *tcellScreen) Clear() {
+	t.s.Clear()
+}
+
+func (t *tcellScreen) Flush() error {
+	t.s.Show()
+	return nil
+}
+
+func (t *tcellScreen) Sync() error {
+	t.s.Sync()
+	return nil
+}
+
+func (t *tcellScreen) HideCursor() {
+	t.s.HideCursor()
+}
+
+func (t *tcellScreen) Beep() {
+	t.s.Beep()
+}
+
+func (t *tcellScreen) PollEvent() Event {
+	for {
+		switch tev := t.s.PollEvent().(type) {
+		case *tcell.EventKey:
+			if tev.Key() == tcell.KeyRune {
+				return Event{Type: EventKey, Ch: tev.Rune()}
+			}
+			return Event{Type: EventKey, Key: tcellKeys[tev.Key()]}
+		case *tcell.EventResize:
+			w, h := tev.Size()
+			return Event{Type: EventResize, Width: w, Height: h}
+		case *tcell.EventMouse:
+			down := tev.Buttons()&tcell.Button1 != 0
+			click := down && !t.button1
+			t.button1 = down
+			if click {
+				x, y := tev.Position()
+				return Event{Type: EventMouse, MouseX: x, MouseY: y}
+			}
+			// Ignore motion, releases and the other buttons
+		case *tcell.EventError:
+			return Event{Type: EventError, Err: tev}
+		case nil:
+			// The screen has been shut down
+			return Event{Type: EventInterrupt}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// gophertrak
+// termbox.go - A Screen backed by termbox-go
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"fmt"
+	"github.com/nsf/termbox-go"
+	"os"
+)
+
+type termboxScreen struct{}
+
+// NewTermboxScreen returns a Screen that draws on the real terminal via termbox
+func NewTermboxScreen() Screen {
+	return termboxScreen{}
+}
+
+var termboxKeys = map[termbox.Key]Key{
+	termbox.KeyF1:         KeyF1,
+	termbox.KeyF2:         KeyF2,
+	termbox.KeyF3:         KeyF3,
+	termbox.KeyF4:         KeyF4,
+	termbox.KeyF5:         KeyF5,
+	termbox.KeyF6:         KeyF6,
+	termbox.KeyF7:         KeyF7,
+	termbox.KeyF8:         KeyF8,
+	termbox.KeyF9:         KeyF9,
+	termbox.KeyF10:        KeyF10,
+	termbox.KeyF11:        KeyF11,
+	termbox.KeyF12:        KeyF12,
+	termbox.KeyInsert:     KeyInsert,
+	termbox.KeyDelete:     KeyDelete,
+	termbox.KeyHome:       KeyHome,
+	termbox.KeyEnd:        KeyEnd,
+	termbox.KeyPgup:       KeyPgup,
+	termbox.KeyPgdn:       KeyPgdn,
+	termbox.KeyArrowUp:    KeyArrowUp,
+	termbox.KeyArrowDown:  KeyArrowDown,
+	termbox.KeyArrowLeft:  KeyArrowLeft,
+	termbox.KeyArrowRight: KeyArrowRight,
+	termbox.KeyEnter:      KeyEnter,
+	termbox.KeyEsc:        KeyEsc,
+	termbox.KeyTab:        KeyTab,
+	termbox.KeySpace:      KeySpace,
+	termbox.KeyBackspace:  KeyBackspace,
+	termbox.KeyBackspace2: KeyBackspace,
+	termbox.KeyCtrlC:      KeyCtrlC,
+	termbox.KeyCtrlL:      KeyCtrlL,
+	termbox.KeyCtrlS:      KeyCtrlS,
+}
+
+func termboxAttribute(a Attribute) termbox.Attribute {
+	tb := termbox.Attribute(a.Color())
+	if a&AttrBold != 0 {
+		tb |= termbox.AttrBold
+	}
+	if a&AttrUnderline != 0 {
+		tb |= termbox.AttrUnderline
+	}
+	if a&AttrReverse != 0 {
+		tb |= termbox.AttrReverse
+	}
+	return tb
+}
+
+func (termboxScreen) Init() error {
+	return termbox.Init()
+}
+
+func (termboxScreen) Close() {
+	termbox.Close()
+}
+
+func (termboxScreen) Size() (int, int) {
+	return termbox.Size()
+}
+
+func (termboxScreen) SetCell(x, y int, ch rune, s Style) {
+	termbox.SetCell(x, y, ch, termboxAttribute(s.Fg), termboxAttribute(s.Bg))
+}
+
+func (termboxScreen) Clear() {
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+}
+
+func (termboxScreen) Flush() error {
+	return termbox.Flush()
+}
+
+func (termboxScreen) Sync() error {
+	return termbox.Sync()
+}
+
+func (termboxScreen) HideCursor() {
+	termbox.HideCursor()
+}
+
+// Beep writes a BEL straight to the terminal, since termbox has no bell of its own
+func (termboxScreen) Beep() {
+	fmt.Fprint(os.Stdout, "\a")
+}
+
+func (termboxScreen) PollEvent() Event {
+	for {
+		tev := termbox.PollEvent()
+
+		switch tev.Type {
+		case termbox.EventKey:
+			ev := Event{Type: EventKey, Ch: tev.Ch}
+			if tev.Ch == 0 {
+				ev.Key = termboxKeys[tev.Key]
+			}
+			return ev
+		case termbox.EventResize:
+			return Event{Type: EventResize, Width: tev.Width, Height: tev.Height}
+		case termbox.EventError:
+			return Event{Type: EventError, Err: tev.Err}
+		case termbox.EventInterrupt:
+			return Event{Type: EventInterrupt}
+		}
+		// We don't turn on termbox's mouse mode, and have no use for raw or
+		// empty events, so the rest are dropped
+	}
+}
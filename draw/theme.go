@@ -0,0 +1,181 @@
+// gophertrak
+// theme.go - Themes that replace the colors of our named Styles
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Theme gives a Style for some or all of the named Styles in draw.go, keyed by
+// variable name, e.g. "RedTitle".  Styles a theme doesn't mention are left alone.
+type Theme map[string]Style
+
+func palette() map[string]*Style {
+	return map[string]*Style{
+		"Black":            &Black,
+		"CyanText":         &CyanText,
+		"WhiteText":        &WhiteText,
+		"BlueText":         &BlueText,
+		"GreenText":        &GreenText,
+		"YellowText":       &YellowText,
+		"RedText":          &RedText,
+		"GreyText":         &GreyText,
+		"WhiteOnBlueText":  &WhiteOnBlueText,
+		"YellowOnBlueText": &YellowOnBlueText,
+		"RedOnBlueText":    &RedOnBlueText,
+		"CyanOnBlueText":   &CyanOnBlueText,
+		"WhiteOnRedText":   &WhiteOnRedText,
+		"PurpleText":       &PurpleText,
+		"RedTitle":         &RedTitle,
+		"CyanTitle":        &CyanTitle,
+		"YellowTitle":      &YellowTitle,
+	}
+}
+
+// Themes are the built-in themes
+var Themes = map[string]Theme{}
+
+func init() {
+	def := Theme{}
+	for name, s := range palette() {
+		def[name] = *s
+	}
+
+	Themes["default"] = def
+
+	// Red on black only, to keep our night vision while driving after dark
+	Themes["night"] = def.Map(func(s Style) Style {
+		if s.Bg.Color() == ColorBlue {
+			return Style{Fg: ColorBlack | s.Fg.attrs(), Bg: ColorRed}
+		}
+		return Style{Fg: ColorRed | s.Fg.attrs(), Bg: ColorBlack}
+	})
+
+	// Dark text on a white background for reading in direct sunlight.  Colors
+	// that wash out against white are darkened to black.
+	Themes["daylight"] = def.Map(func(s Style) Style {
+		if s.Bg.Color() == ColorBlue {
+			return Style{Fg: ColorWhite | s.Fg.attrs() | AttrBold, Bg: ColorBlue}
+		}
+		fg := s.Fg.Color()
+		switch fg {
+		case ColorWhite, ColorYellow, ColorCyan, ColorGreen:
+			fg = ColorBlack
+		}
+		return Style{Fg: fg | s.Fg.attrs(), Bg: ColorWhite}
+	})
+
+	// The terminal's own colors, for terminals that don't do color well.  The
+	// status bar is drawn in reverse video instead of blue.
+	Themes["mono"] = def.Map(func(s Style) Style {
+		if s.Bg.Color() == ColorBlue {
+			return Style{Fg: ColorDefault | s.Fg.attrs() | AttrReverse, Bg: ColorDefault}
+		}
+		return Style{Fg: ColorDefault | s.Fg.attrs(), Bg: ColorDefault}
+	})
+}
+
+func (a Attribute) attrs() Attribute {
+	return a &^ colorMask
+}
+
+// Map returns a copy of the theme with f applied to every Style
+func (t Theme) Map(f func(Style) Style) Theme {
+	m := Theme{}
+	for name, s := range t {
+		m[name] = f(s)
+	}
+	return m
+}
+
+// SetTheme replaces the named Styles with the theme's.  Widgets copy their
+// Styles when they're created, so set the theme before building any.
+func SetTheme(t Theme) error {
+	p := palette()
+	for name := range t {
+		if _, ok := p[name]; !ok {
+			return fmt.Errorf("unknown style %q", name)
+		}
+	}
+
+	Mu.Lock()
+	defer Mu.Unlock()
+	for name, s := range t {
+		*p[name] = s
+	}
+	return nil
+}
+
+// ThemeNames returns the names of the built-in themes, sorted
+func ThemeNames() []string {
+	var names []string
+	for n := range Themes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var colorNames = map[string]Attribute{
+	"default": ColorDefault,
+	"black":   ColorBlack,
+	"red":     ColorRed,
+	"green":   ColorGreen,
+	"yellow":  ColorYellow,
+	"blue":    ColorBlue,
+	"magenta": ColorMagenta,
+	"cyan":    ColorCyan,
+	"white":   ColorWhite,
+}
+
+var attrNames = map[string]Attribute{
+	"bold":      AttrBold,
+	"underline": AttrUnderline,
+	"reverse":   AttrReverse,
+}
+
+// ParseAttribute parses a color with optional attributes, e.g. "red+bold+underline"
+func ParseAttribute(s string) (Attribute, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(s)), "+")
+
+	a, ok := colorNames[parts[0]]
+	if !ok {
+		return 0, fmt.Errorf("unknown color %q", parts[0])
+	}
+	for _, p := range parts[1:] {
+		attr, ok := attrNames[p]
+		if !ok {
+			return 0, fmt.Errorf("unknown attribute %q", p)
+		}
+		a |= attr
+	}
+	return a, nil
+}
+
+// ParseStyle parses a foreground and optional background, e.g.
+// "yellow+bold on blue".  The background defaults to black.
+func ParseStyle(s string) (Style, error) {
+	st := Style{Bg: ColorBlack}
+
+	parts := strings.SplitN(s, " on ", 2)
+
+	fg, err := ParseAttribute(parts[0])
+	if err != nil {
+		return st, err
+	}
+	st.Fg = fg
+
+	if len(parts) == 2 {
+		bg, err := ParseAttribute(parts[1])
+		if err != nil {
+			return st, err
+		}
+		st.Bg = bg
+	}
+	return st, nil
+}
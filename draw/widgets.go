@@ -0,0 +1,806 @@
+// gophertrak
+// widgets.go - Retained-mode widgets.  Goroutines update a widget's model and
+// the render loop takes care of drawing it.
+//
+// (c) 2014, Christopher Snell
+
+package draw
+
+import (
+	"sync"
+	"unicode/utf8"
+)
+
+// Widget is anything that can draw itself into a region of a Canvas.  Draw is
+// only ever called from the render loop; widgets guard their own models.
+type Widget interface {
+	Draw(c *Canvas, r Rect)
+}
+
+// Span is a run of text in a single style
+type Span struct {
+	Text  string
+	Style Style
+}
+
+func spansEqual(a, b []Span) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func spansWidth(spans []Span) int {
+	w := 0
+	for _, s := range spans {
+		w += utf8.RuneCountInString(s.Text)
+	}
+	return w
+}
+
+func printSpans(c *Canvas, r Rect, x, y int, spans []Span) int {
+	for _, s := range spans {
+		x += c.Print(r, x, y, s.Style, s.Text)
+	}
+	return x
+}
+
+//
+// Label
+//
+
+// Label is a single line of text, made up of one or more spans
+type Label struct {
+	mu    sync.Mutex
+	spans []Span
+}
+
+func NewLabel(s Style, t string) *Label {
+	return &Label{spans: []Span{{Text: t, Style: s}}}
+}
+
+func (l *Label) Set(s Style, t string) {
+	l.SetSpans(Span{Text: t, Style: s})
+}
+
+func (l *Label) SetSpans(spans ...Span) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if spansEqual(l.spans, spans) {
+		return
+	}
+	l.spans = spans
+	Invalidate()
+}
+
+func (l *Label) Draw(c *Canvas, r Rect) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	printSpans(c, r, 0, 0, l.spans)
+}
+
+//
+// Table
+//
+
+// Column is a table column starting X cells from the table's left edge.  The
+// header is padded out to Width so that its underline spans the column.
+type Column struct {
+	Title string
+	X     int
+	Width int
+}
+
+// Table is a header row followed by rows of cells, one Span per column.  One
+// row can be selected, which draws it in reverse video.  If there are more rows
+// than fit, the table scrolls to keep the selected row in view.
+type Table struct {
+	mu          sync.Mutex
+	columns     []Column
+	rows        [][]Span
+	selected    int
+	offset      int
+	drawn       Rect
+	HeaderStyle Style
+}
+
+func NewTable(headerStyle Style, columns ...Column) *Table {
+	return &Table{
+		columns:     columns,
+		selected:    -1,
+		HeaderStyle: headerStyle,
+	}
+}
+
+func (t *Table) SetRows(rows [][]Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rows = rows
+	Invalidate()
+}
+
+// Select highlights row i.  Pass -1 to clear the selection.
+func (t *Table) Select(i int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.selected != i {
+		t.selected = i
+		Invalidate()
+	}
+}
+
+func (t *Table) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.rows)
+}
+
+func (t *Table) Selected() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.selected
+}
+
+// MoveSelection moves the selection n rows down (or up, if n is negative),
+// stopping at the first and last rows.  With nothing selected, it starts from
+// the top.
+func (t *Table) MoveSelection(n int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.rows) == 0 {
+		return -1
+	}
+
+	i := t.selected + n
+	if t.selected < 0 {
+		i = 0
+	}
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(t.rows) {
+		i = len(t.rows) - 1
+	}
+	if i != t.selected {
+		t.selected = i
+		Invalidate()
+	}
+	return i
+}
+
+// PageSize is the number of rows that fit in the table as it was last drawn
+func (t *Table) PageSize() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.drawn.H < 2 {
+		return 1
+	}
+	return t.drawn.H - 1
+}
+
+// RowAt returns the index of the row drawn at screen cell (x, y), or -1 if
+// there isn't one there
+func (t *Table) RowAt(x, y int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.drawn.Contains(x, y) {
+		return -1
+	}
+	i := y - t.drawn.Y - 1
+	if i < 0 {
+		return -1
+	}
+	i += t.offset
+	if i >= len(t.rows) {
+		return -1
+	}
+	return i
+}
+
+func (t *Table) Draw(c *Canvas, r Rect) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.drawn = r
+
+	for _, col := range t.columns {
+		title := col.Title
+		for utf8.RuneCountInString(title) < col.Width {
+			title += " "
+		}
+		c.Print(r, col.X, 0, t.HeaderStyle, title)
+	}
+
+	// Scroll just far enough to show the selected row
+	page := r.H - 1
+	if t.selected < 0 || page < 1 {
+		t.offset = 0
+	} else if t.selected < t.offset {
+		t.offset = t.selected
+	} else if t.selected >= t.offset+page {
+		t.offset = t.selected - page + 1
+	}
+	if t.offset > len(t.rows) {
+		t.offset = 0
+	}
+
+	for i, row := range t.rows[t.offset:] {
+		y := i + 1
+		if y >= r.H {
+			break
+		}
+		i += t.offset
+		for j, cell := range row {
+			if j >= len(t.columns) {
+				break
+			}
+			st := cell.Style
+			if i == t.selected {
+				st.Fg |= AttrReverse
+			}
+			// Clip each cell at the start of the next column
+			cr := Rect{X: r.X, Y: r.Y, W: r.W, H: r.H}
+			if j+1 < len(t.columns) && t.columns[j+1].X < r.W {
+				cr.W = t.columns[j+1].X - 1
+			}
+			c.Print(cr, t.columns[j].X, y, st, cell.Text)
+		}
+	}
+}
+
+//
+// Panel
+//
+
+type placement struct {
+	w Widget
+	r Rect
+}
+
+// Panel groups child widgets, each placed at a rect relative to the panel's
+// top-left corner.  A child with no width or height extends to the panel's
+// right or bottom edge, and children are clipped to the panel.  Bordered
+// panels draw a titled box around their edge.
+type Panel struct {
+	mu          sync.Mutex
+	children    []placement
+	Title       string
+	Border      bool
+	LineStyle   LineStyle
+	BorderStyle Style
+	TitleStyle  Style
+
+	// Arrange, if set, is called with the panel's rect before every draw so
+	// that children can be re-placed to suit the panel's current size.
+	Arrange func(r Rect)
+}
+
+func NewPanel() *Panel {
+	return &Panel{}
+}
+
+// NewTitledPanel makes a borderless panel with a title in its top row
+func NewTitledPanel(title string, s Style) *Panel {
+	return &Panel{Title: title, TitleStyle: s}
+}
+
+// NewBorderedPanel makes a panel with a titled box around its edge
+func NewBorderedPanel(title string, ls LineStyle, border, ts Style) *Panel {
+	return &Panel{Title: title, Border: true, LineStyle: ls, BorderStyle: border, TitleStyle: ts}
+}
+
+// Place adds a child to the panel at rect r, or moves it there if it's already
+// in the panel.  Children are drawn in the order they were first placed.
+func (p *Panel) Place(w Widget, r Rect) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.children {
+		if p.children[i].w == w {
+			if p.children[i].r != r {
+				p.children[i].r = r
+				Invalidate()
+			}
+			return
+		}
+	}
+	p.children = append(p.children, placement{w: w, r: r})
+	Invalidate()
+}
+
+func (p *Panel) SetTitle(t string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.Title != t {
+		p.Title = t
+		Invalidate()
+	}
+}
+
+// Remove takes a child out of the panel
+func (p *Panel) Remove(w Widget) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.children {
+		if p.children[i].w == w {
+			p.children = append(p.children[:i], p.children[i+1:]...)
+			Invalidate()
+			return
+		}
+	}
+}
+
+func (p *Panel) Draw(c *Canvas, r Rect) {
+	if r.Empty() {
+		return
+	}
+
+	if p.Arrange != nil {
+		p.Arrange(r)
+	}
+
+	p.mu.Lock()
+	children := make([]placement, len(p.children))
+	copy(children, p.children)
+	title := p.Title
+	p.mu.Unlock()
+
+	if p.Border {
+		c.TitledBox(r, p.LineStyle, p.BorderStyle, p.TitleStyle, title)
+	} else if title != "" {
+		c.Print(r, 0, 0, p.TitleStyle, title)
+	}
+
+	for _, ch := range children {
+		cr := Rect{X: r.X + ch.r.X, Y: r.Y + ch.r.Y, W: ch.r.W, H: ch.r.H}
+		if cr.W <= 0 {
+			cr.W = r.Right() - cr.X + 1
+		}
+		if cr.H <= 0 {
+			cr.H = r.Bottom() - cr.Y + 1
+		}
+		cr = cr.Intersect(r)
+		if cr.Empty() {
+			continue
+		}
+		ch.w.Draw(c, cr)
+	}
+}
+
+//
+// StatusBar
+//
+
+// StatusItem is one entry in the status bar.  If there isn't room for Spans,
+// the bar tries Short instead, and leaves the item off if that won't fit either.
+// Clicking an item with a Key is the same as pressing that key.
+type StatusItem struct {
+	Spans []Span
+	Short []Span
+	Key   Key
+}
+
+type statusHit struct {
+	r   Rect
+	key Key
+}
+
+// StatusBar is a single colored row of items, capped on each end so that it
+// sits neatly on the bottom edge of a box
+type StatusBar struct {
+	mu       sync.Mutex
+	items    []StatusItem
+	hits     []statusHit
+	Style    Style
+	CapStyle Style
+	Gap      int
+}
+
+func NewStatusBar(s, capStyle Style) *StatusBar {
+	return &StatusBar{Style: s, CapStyle: capStyle, Gap: 2}
+}
+
+func (b *StatusBar) SetItems(items []StatusItem) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.items = items
+	Invalidate()
+}
+
+func (b *StatusBar) Draw(c *Canvas, r Rect) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if r.W < 3 {
+		return
+	}
+
+	c.Set(r.X, r.Y, '╡', b.CapStyle)
+	c.Set(r.Right(), r.Y, '╞', b.CapStyle)
+
+	inner := Rect{X: r.X + 1, Y: r.Y, W: r.W - 2, H: 1}
+	c.Fill(inner, b.Style)
+
+	b.hits = b.hits[:0]
+
+	x := 1
+	for _, it := range b.items {
+		spans := it.Spans
+		if x+spansWidth(spans) > inner.W {
+			spans = it.Short
+		}
+		if len(spans) == 0 || x+spansWidth(spans) > inner.W {
+			continue
+		}
+		if it.Key != KeyNone {
+			b.hits = append(b.hits, statusHit{Rect{X: inner.X + x, Y: inner.Y, W: spansWidth(spans), H: 1}, it.Key})
+		}
+		x = printSpans(c, inner, x, 0, spans) + b.Gap
+	}
+}
+
+// KeyAt returns the hot key of the item drawn at screen cell (x, y), if any
+func (b *StatusBar) KeyAt(x, y int) (Key, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, h := range b.hits {
+		if h.r.Contains(x, y) {
+			return h.key, true
+		}
+	}
+	return KeyNone, false
+}
+
+//
+// Modal
+//
+
+// Modal is a box drawn over the middle of everything else, with some lines of
+// text and an optional widget (e.g. a TextInput) at the bottom.  If there are
+// more lines than fit on the screen, they can be scrolled.  Shown with
+// ShowChoices, the first few lines can be selected instead.
+type Modal struct {
+	mu          sync.Mutex
+	visible     bool
+	title       string
+	lines       []string
+	offset      int
+	page        int
+	content     Widget
+	choices     int // How many of the lines can be selected
+	selected    int
+	BorderStyle Style
+	TitleStyle  Style
+	TextStyle   Style
+	MinWidth    int
+}
+
+func NewModal(border, title, text Style) *Modal {
+	return &Modal{BorderStyle: border, TitleStyle: title, TextStyle: text, MinWidth: 40}
+}
+
+func (m *Modal) Show(title string, lines []string, content Widget) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visible = true
+	m.title = title
+	m.lines = lines
+	m.offset = 0
+	m.content = content
+	m.choices = 0
+	m.selected = -1
+	Invalidate()
+}
+
+// ShowChoices shows lines with the first choices of them selectable, starting
+// with the first
+func (m *Modal) ShowChoices(title string, lines []string, choices int) {
+	m.Show(title, lines, nil)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if choices > len(lines) {
+		choices = len(lines)
+	}
+	m.choices = choices
+	if choices > 0 {
+		m.selected = 0
+	}
+}
+
+// Selected returns the index of the selected line, or -1 if there isn't one
+func (m *Modal) Selected() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.selected
+}
+
+// MoveSelection moves the selection n lines down (or up, if n is negative),
+// stopping at the first and last choices
+func (m *Modal) MoveSelection(n int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.choices == 0 {
+		return -1
+	}
+
+	i := m.selected + n
+	if i < 0 {
+		i = 0
+	}
+	if i >= m.choices {
+		i = m.choices - 1
+	}
+	if i != m.selected {
+		m.selected = i
+		Invalidate()
+	}
+	return i
+}
+
+func (m *Modal) Hide() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.visible = false
+	m.content = nil
+	Invalidate()
+}
+
+func (m *Modal) Visible() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.visible
+}
+
+// Scroll moves the text n lines down, or up if n is negative
+func (m *Modal) Scroll(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	o := m.offset + n
+	if max := len(m.lines) - m.page; o > max {
+		o = max
+	}
+	if o < 0 {
+		o = 0
+	}
+	if o != m.offset {
+		m.offset = o
+		Invalidate()
+	}
+}
+
+// PageSize is the number of lines that fit in the modal as it was last drawn
+func (m *Modal) PageSize() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.page < 1 {
+		return 1
+	}
+	return m.page
+}
+
+func (m *Modal) Draw(c *Canvas, r Rect) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.visible {
+		return
+	}
+
+	w := m.MinWidth
+	if tw := utf8.RuneCountInString(m.title) + 8; tw > w {
+		w = tw
+	}
+	for _, l := range m.lines {
+		if lw := utf8.RuneCountInString(l) + 4; lw > w {
+			w = lw
+		}
+	}
+	if w > r.W {
+		w = r.W
+	}
+
+	h := len(m.lines) + 4
+	if m.content != nil {
+		h += 2
+	}
+	if h > r.H {
+		h = r.H
+	}
+
+	box := Rect{X: r.X + (r.W-w)/2, Y: r.Y + (r.H-h)/2, W: w, H: h}
+	c.Fill(box, Black)
+	c.TitledBox(box, Solid, m.BorderStyle, m.TitleStyle, m.title)
+
+	inner := box.Inset(2, 2)
+	m.page = inner.H
+	if m.content != nil {
+		m.page -= 2
+	}
+	// Keep the selected line on screen
+	if m.selected >= 0 {
+		if m.selected < m.offset {
+			m.offset = m.selected
+		} else if m.selected >= m.offset+m.page {
+			m.offset = m.selected - m.page + 1
+		}
+	}
+	if m.offset > len(m.lines)-m.page {
+		m.offset = len(m.lines) - m.page
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+
+	for i, l := range m.lines[m.offset:] {
+		if i >= m.page {
+			break
+		}
+		st := m.TextStyle
+		if i+m.offset == m.selected {
+			st.Fg |= AttrReverse
+		}
+		c.Print(inner, 0, i, st, l)
+	}
+
+	// Show which way there's more to scroll to
+	if m.offset > 0 {
+		c.Set(box.Right()-2, box.Y, '▲', m.TitleStyle)
+	}
+	if m.offset+m.page < len(m.lines) {
+		c.Set(box.Right()-2, box.Bottom(), '▼', m.TitleStyle)
+	}
+
+	if m.content != nil {
+		y := len(m.lines)
+		if y > m.page {
+			y = m.page
+		}
+		m.content.Draw(c, Rect{X: inner.X, Y: inner.Y + y + 1, W: inner.W, H: 1})
+	}
+}
+
+//
+// TextInput
+//
+
+type InputResult int
+
+const (
+	InputPending InputResult = iota
+	InputSubmitted
+	InputCancelled
+)
+
+// TextInput is a one-line editable text field with a prompt
+type TextInput struct {
+	mu          sync.Mutex
+	prompt      string
+	value       []rune
+	cursor      int
+	MaxLen      int
+	PromptStyle Style
+	TextStyle   Style
+}
+
+func NewTextInput(prompt string, maxLen int) *TextInput {
+	return &TextInput{
+		prompt:      prompt,
+		MaxLen:      maxLen,
+		PromptStyle: CyanText,
+		TextStyle:   WhiteText,
+	}
+}
+
+func (t *TextInput) Value() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.value)
+}
+
+func (t *TextInput) SetValue(v string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.value = []rune(v)
+	t.cursor = len(t.value)
+	Invalidate()
+}
+
+func (t *TextInput) SetPrompt(p string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prompt = p
+	Invalidate()
+}
+
+// HandleKey edits the field according to a keypress and reports whether the
+// user has submitted or cancelled it
+func (t *TextInput) HandleKey(ev Event) InputResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	defer Invalidate()
+
+	switch ev.Key {
+	case KeyEnter:
+		return InputSubmitted
+	case KeyEsc:
+		return InputCancelled
+	case KeyBackspace:
+		if t.cursor > 0 {
+			t.value = append(t.value[:t.cursor-1], t.value[t.cursor:]...)
+			t.cursor--
+		}
+	case KeyDelete:
+		if t.cursor < len(t.value) {
+			t.value = append(t.value[:t.cursor], t.value[t.cursor+1:]...)
+		}
+	case KeyArrowLeft:
+		if t.cursor > 0 {
+			t.cursor--
+		}
+	case KeyArrowRight:
+		if t.cursor < len(t.value) {
+			t.cursor++
+		}
+	case KeyHome:
+		t.cursor = 0
+	case KeyEnd:
+		t.cursor = len(t.value)
+	case KeySpace:
+		t.insert(' ')
+	default:
+		if ev.Ch != 0 {
+			t.insert(ev.Ch)
+		}
+	}
+
+	return InputPending
+}
+
+func (t *TextInput) insert(ch rune) {
+	if t.MaxLen > 0 && len(t.value) >= t.MaxLen {
+		return
+	}
+	t.value = append(t.value, 0)
+	copy(t.value[t.cursor+1:], t.value[t.cursor:])
+	t.value[t.cursor] = ch
+	t.cursor++
+}
+
+func (t *TextInput) Draw(c *Canvas, r Rect) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	x := c.Print(r, 0, 0, t.PromptStyle, t.prompt) + 1
+
+	// Scroll the text so that the cursor is always visible
+	room := r.W - x - 1
+	start := 0
+	if room > 0 && t.cursor > room {
+		start = t.cursor - room
+	}
+
+	for i := start; i <= len(t.value); i++ {
+		ch := ' '
+		if i < len(t.value) {
+			ch = t.value[i]
+		}
+		s := t.TextStyle
+		if i == t.cursor {
+			s = Style{Fg: t.TextStyle.Fg | AttrReverse, Bg: t.TextStyle.Bg}
+		}
+		c.Print(r, x, 0, s, string(ch))
+		x++
+	}
+}
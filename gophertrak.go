@@ -1,18 +1,17 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/chrissnell/GoBalloon/geospatial"
-	"github.com/chrissnell/GoBalloon/gps"
 	"github.com/chrissnell/gophertrak/draw"
-	"github.com/dustin/go-humanize"
-	"github.com/nsf/termbox-go"
 	"log"
 	"math"
 	"os"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 )
 
@@ -27,17 +26,19 @@ var (
 	chasercall   *string
 	chaserssid   *string
 	debug        *bool
-	shutdown     = make(chan bool)
+	httpaddr     *string
+	apitoken     *string
+	remotegps    *string
+	display      *string
+	configfile   *string
+	config       *Config
 	chasers      = make(map[string]bool)
 )
 
 func main() {
 
-	// Set up a new GPS
-	g := new(gps.GPS)
-
 	// Set up a new TNC with our APRS symbol
-	a := new(APRSTNC)
+	a := newAPRSTNC()
 	a.symbolTable = '/'
 	a.symbolCode = 'O'
 
@@ -47,7 +48,7 @@ func main() {
 	chasers["KF7YVN-1"] = true
 	chasers["A7COG-2"] = true
 
-	g.Remotegps = flag.String("remotegps", "10.50.0.21:2947", "Remote gpsd server")
+	remotegps = flag.String("remotegps", "10.50.0.21:2947", "Remote gpsd server")
 	a.remotetnc = flag.String("remotetnc", "10.50.0.25:6700", "Remote TNC server")
 	localtncport = flag.String("localtncport", "", "Local serial port for TNC, e.g. /dev/ttyUSB0")
 	ballooncall = flag.String("ballooncall", "", "Balloon Callsign")
@@ -55,10 +56,82 @@ func main() {
 	chasercall = flag.String("chasercall", "", "Chaser Callsign")
 	chaserssid = flag.String("chaserssid", "", "Chaser SSID")
 	a.beaconint = flag.String("beaconint", "60", "APRS position beacon interval (secs)  Default: 60")
+	a.cutdowncmd = flag.String("cutdowncmd", "CUTDOWN", "Message text that triggers the payload's cutdown")
 	debug = flag.Bool("debug", false, "Enable debugging information")
+	httpaddr = flag.String("httpaddr", "", "Serve the web dashboard and live KML/GeoJSON on this address, e.g. :8080  Default: disabled")
+	apitoken = flag.String("apitoken", "", "Token required by the REST API.  Commands are disabled without one.")
+	display = flag.String("display", "termbox", "Terminal backend: termbox or tcell.  tcell adds mouse support.")
+	configfile = flag.String("config", defaultConfigFile, "YAML config file")
 	flag.Parse()
 
-	g.Debug = debug
+	err := checkCallsigns()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	config, err = loadConfig(*configfile)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	g, err := newPositionSource(config.GPS)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	if config.Units != "" {
+		err = setUnits(config.Units)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+	}
+
+	if config.Coords != "" {
+		err = setCoordFormat(config.Coords)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+	}
+
+	err = waypoints.Load(config.Waypoints)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	theme, err := config.theme()
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	if theme != nil {
+		err = draw.SetTheme(theme)
+		if err != nil {
+			log.Fatalf("Error loading theme %v: %v", config.Theme, err)
+		}
+	}
+
+	alerts, err := newAlertEngine(config.Alerts, config.Battery, a, g)
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+
+	var an *announcer
+	if config.Speech.Command != "" {
+		an, err = newAnnouncer(config.Speech)
+		if err != nil {
+			log.Fatalf("Error loading config: %v", err)
+		}
+		alerts.Subscribe(an.Alert)
+	}
+
+	var screen draw.Screen
+	switch *display {
+	case "termbox":
+		screen = draw.NewTermboxScreen()
+	case "tcell":
+		screen = draw.NewTcellScreen()
+	default:
+		log.Fatalf("Unknown -display %q: use termbox or tcell", *display)
+	}
 
 	// Log to a file instead of stdout
 	f, err := os.OpenFile("gophertrak.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
@@ -68,341 +141,659 @@ func main() {
 	defer f.Close()
 	log.SetOutput(f)
 
-	// Set up termbox
-	draw.Init()
-	x_size, y_size := draw.Size()
+	// Make sure the flight log is on disk before we go
+	defer f.Sync()
+
+	// Leave a summary of how the payload's packets reached us in the flight log
+	defer a.paths.LogSummary()
 
-	// Set up our interface
-	DrawOuterFrame(x_size, y_size)
-	DrawPayloadTracker()
-	DrawChaseConsole()
-	DrawStatusBar(x_size, y_size)
-	DrawRecentPacketsTable()
-	termbox.HideCursor()
-	draw.SafeFlush()
+	// Everything below runs until ESC, SIGINT or SIGTERM
+	l := newLifecycle()
+
+	// Set up the terminal and our widgets
+	draw.Init(screen)
+
+	u := newTrackerUI()
+	u.alerts = alerts
+	u.g = g
+	draw.SetRoot(u)
+	l.Go("draw", func(ctx context.Context) { draw.Run(ctx.Done()) })
 
 	// Start backend data gatherers
-	go g.StartGPS()
-	go a.StartAPRS()
+	l.Go("gps", g.Start)
+	l.Go("aprs", a.StartAPRS)
+	l.Go("alerts", alerts.Run)
 
-	// Launch goroutines that update our interface with current data
-	go DrawMyChaseVehicleReadings(&g.Reading, a)
-	go DrawPayloadReadings(a)
-	go DrawRecentPackets(a, x_size)
-	go monitorConnections(a, g, x_size, y_size)
+	if an != nil {
+		l.Go("announcer", an.Run)
+		l.Go("callouts", func(ctx context.Context) { an.Routine(ctx, a, g) })
+	}
 
-	for {
-		switch ev := termbox.PollEvent(); ev.Type {
-		case termbox.EventKey:
-			if ev.Key == termbox.KeyCtrlS {
-				draw.Mu.Lock()
-				termbox.Sync()
-				draw.Mu.Unlock()
-			}
-			if ev.Key == termbox.KeyEsc {
-				draw.Mu.Lock()
-				termbox.Close()
-				draw.Mu.Unlock()
+	if *httpaddr != "" {
+		l.Go("http", func(ctx context.Context) { startHTTPServer(ctx, *httpaddr, a, g, alerts) })
+	}
+
+	// Launch goroutines that update our interface with current data
+	l.Go("chase", func(ctx context.Context) { u.UpdateMyChaseVehicleReadings(ctx, g, a) })
+	l.Go("payload", func(ctx context.Context) { u.UpdatePayloadReadings(ctx, a) })
+	l.Go("packets", func(ctx context.Context) { u.UpdateRecentPackets(ctx, a) })
+	l.Go("heard", func(ctx context.Context) { u.UpdateHeardStations(ctx, g, a) })
+	l.Go("paths", func(ctx context.Context) { u.UpdatePayloadPaths(ctx, a) })
+	l.Go("navigation", func(ctx context.Context) { u.UpdateNavigation(ctx, g, a) })
+	l.Go("waypoints", func(ctx context.Context) { u.UpdateWaypoints(ctx, g) })
+	l.Go("waypoint objects", func(ctx context.Context) { TransmitWaypoints(ctx, a) })
+	// The TNC holds off hanging up until the landing object has been killed
+	a.lastWords.Add(1)
+	l.Go("landing object", func(ctx context.Context) { TransmitLandingPrediction(ctx, a, g, config.Landing) })
+	l.Go("status", func(ctx context.Context) { u.monitorConnections(ctx, a, g) })
+	l.Go("banner", u.UpdateAlerts)
+
+	// PollEvent can't be interrupted, so this goroutine isn't waited for
+	go func() {
+		for {
+			switch ev := draw.PollEvent(); ev.Type {
+			case draw.EventKey:
+				if !u.HandleKey(ev, a) {
+					l.Stop()
+					return
+				}
+			case draw.EventMouse:
+				if !u.HandleMouse(ev, a) {
+					l.Stop()
+					return
+				}
+			case draw.EventResize:
+				draw.Redraw()
+			case draw.EventInterrupt:
 				return
 			}
 		}
-	}
+	}()
 
+	<-l.Done()
+	log.Println("Shutting down")
+	l.Wait(shutdownTimeout)
+	draw.Close()
 }
 
-func DrawOuterFrame(x_size, y_size int) {
-	draw.TitledBox(0, 0, x_size, y_size, draw.DoubleSolid, draw.BlueText, draw.WhiteText, vers)
+// fixString is the fix mode, quality and satellites used/visible, e.g.
+// "3D DGPS 9/12 SATS"
+func fixString(f Fix) string {
+	if f.Quality == fixQualityManual {
+		return f.String()
+	}
+
+	sats := fmt.Sprintf("%d SATS", f.Satellites)
+	if f.Visible > 0 {
+		sats = fmt.Sprintf("%d/%d SATS", f.Satellites, f.Visible)
+	}
+
+	if !f.HasFix() {
+		return "NO FIX " + sats
+	}
+	if m := f.ModeString(); m != "" {
+		return fmt.Sprintf("%v %v %v", m, f, sats)
+	}
+	return fmt.Sprintf("%v %v", f, sats)
 }
 
-func DrawPayloadTracker() {
-	payloadcall := fmt.Sprintf("%v-%v", *ballooncall, *balloonssid)
+// fixDetail is the HDOP and age of the fix, e.g. "HDOP 0.9  AGE 2s"
+func fixDetail(f Fix, now time.Time) string {
+	if f.Quality == fixQualityManual {
+		return ""
+	}
+
+	hdop := "HDOP --"
+	if f.HDOP > 0 {
+		hdop = fmt.Sprintf("HDOP %.1f", f.HDOP)
+	}
+	age := "--"
+	if !f.Time.IsZero() {
+		age = shortDuration(now.Sub(f.Time))
+	}
+	return fmt.Sprintf("%v  AGE %v", hdop, age)
+}
 
-	draw.PrintText(3, 2, draw.RedTitle, "PAYLOAD")
-	draw.PrintText(3, 4, draw.WhiteText, "CALLSIGN:")
-	draw.PrintText(14, 4, draw.WhiteText, payloadcall)
-	draw.PrintText(3, 5, draw.WhiteText, "    LAST:")
-	draw.PrintText(14, 5, draw.WhiteText, "---------")
-	draw.PrintText(3, 6, draw.WhiteText, " BATTERY:")
-	draw.PrintText(14, 6, draw.YellowText, "-.-- V")
-	draw.PrintText(3, 8, draw.WhiteText, "ALTITUDE:")
-	draw.PrintText(14, 8, draw.WhiteText, "---------")
-	draw.PrintText(6, 9, draw.WhiteText, "SPEED:")
-	draw.PrintText(14, 9, draw.WhiteText, "---------")
-	draw.PrintText(5, 10, draw.WhiteText, "COURSE:")
-	draw.PrintText(14, 10, draw.WhiteText, "---°")
-	draw.PrintText(19, 10, draw.CyanText, "•")
+func fixStyle(f Fix) draw.Style {
+	switch {
+	case !f.HasFix():
+		return draw.RedText
+	case f.Mode == fixMode2D:
+		return draw.YellowText
+	}
+	return draw.GreenText
+}
 
-	draw.PrintText(5, 12, draw.WhiteText, "ELEV Δ:")
+// posSpans is a position on one line in the current coordinate format
+func posSpans(p geospatial.Point, style draw.Style) []draw.Span {
+	format := currentCoordFormat()
+	first, second := coordStrings(p, format)
 
-	draw.PrintText(3, 14, draw.WhiteText, "------°-")
-	draw.PrintText(12, 14, draw.PurpleText, "/")
-	draw.PrintText(14, 14, draw.WhiteText, "-------°-")
+	switch {
+	case second == "":
+		return []draw.Span{{Text: first, Style: style}}
+	case format == coordUTM || format == coordMGRS:
+		return []draw.Span{{Text: first + " " + second, Style: style}}
+	}
+	return []draw.Span{
+		{Text: first, Style: style},
+		{Text: " / ", Style: draw.PurpleText},
+		{Text: second, Style: style},
+	}
 }
 
-func DrawPayloadReadings(a *APRSTNC) {
-	var latHemisphere, lonHemisphere rune
+// shortLatLon is a compact position for tables, e.g. "47.612N 122.335W"
+func shortLatLon(p geospatial.Point) string {
+	ns, ew := 'N', 'E'
+	if p.Lat < 0 {
+		ns = 'S'
+	}
+	if p.Lon < 0 {
+		ew = 'W'
+	}
+	return fmt.Sprintf("%.3f%c %.3f%c", math.Abs(p.Lat), ns, math.Abs(p.Lon), ew)
+}
 
+func (u *trackerUI) UpdatePayloadReadings(ctx context.Context, a *APRSTNC) {
 	for {
+		u.refreshPayload(a)
+		if !sleep(ctx, time.Second*1) {
+			return
+		}
+	}
+}
 
-		recent := a.RingAsSlice()
+// refreshPayload fills the PAYLOAD panel from what we've heard from the balloon
+func (u *trackerUI) refreshPayload(a *APRSTNC) {
+	recent := a.RingAsSlice()
 
-		if len(recent) > 0 {
-			lastHeard := recent[0]
+	if len(recent) > 0 {
+		lastHeard := recent[0]
+		u.payloadLast.Set(draw.GreenText, shortDuration(time.Since(lastHeard.ts)))
+	}
 
-			tr := regexp.MustCompile(`([\dhm]*)\.?\d*([ms]{1,2})$`)
-			matches := tr.FindStringSubmatch(time.Since(lastHeard.ts).String())
-			lastHeardTime := fmt.Sprintf("%s", matches[1]+matches[2])
-			draw.Blank(14, 24, 5, draw.Black)
-			draw.PrintText(14, 5, draw.GreenText, lastHeardTime)
-		}
+	if rate, ok := verticalRate(a.TrackAsSlice()); ok {
+		u.payloadRate.SetSpans(rateSpans(rate)...)
+	}
 
-		if len(recent) >= 3 {
-			if recent[0].data.Position.Altitude != 0 && recent[1].data.Position.Altitude != 0 && recent[2].data.Position.Altitude != 0 {
-				d1 := int64(recent[0].data.Position.Altitude - recent[1].data.Position.Altitude)
-				d2 := int64(recent[1].data.Position.Altitude - recent[2].data.Position.Altitude)
-				rate := (d1 + d2) * 60 / (recent[0].ts.Unix() - recent[2].ts.Unix())
-				drawRate(int(rate))
-			}
-		}
+	if v, ok := batteryVoltage(a, config.Battery); ok {
+		u.payloadBattery.Set(draw.YellowText, fmt.Sprintf("%.2f V", v))
+	}
 
-		p := a.pos.Get()
+	p := a.pos.Get()
 
-		if p.Lat != 0 && p.Lon != 0 {
+	if p.Lat != 0 && p.Lon != 0 {
+		us := units()
+		u.payloadAlt.Set(draw.WhiteText, us.Altitude.Format(p.Altitude))
+		u.payloadSpeed.Set(draw.WhiteText, us.Speed.Format(p.Speed))
+		u.payloadCourse.Set(draw.WhiteText, fmt.Sprintf("%v°", p.Heading))
+		u.payloadArrow.Set(draw.CyanText, directionalArrow(int(p.Heading)))
+		u.payloadPos.SetSpans(posSpans(p, draw.WhiteText)...)
+	}
+}
 
-			if p.Lat > 0 {
-				latHemisphere = 'N'
-			} else {
-				latHemisphere = 'S'
-			}
+func (u *trackerUI) UpdateMyChaseVehicleReadings(ctx context.Context, g PositionSource, a *APRSTNC) {
+	for {
+		u.refreshChase(g, a)
+		if !sleep(ctx, time.Second*1) {
+			return
+		}
+	}
+}
 
-			if p.Lon > 0 {
-				lonHemisphere = 'E'
-			} else {
-				lonHemisphere = 'W'
-			}
+// refreshChase fills the MY CHASE VEHICLE panel and the chaser table
+func (u *trackerUI) refreshChase(g PositionSource, a *APRSTNC) {
+	sortedChasers := sortedChaserCallsigns()
 
-			lat := fmt.Sprintf("%7.3f° %c", math.Abs(p.Lat), latHemisphere)
-			lon := fmt.Sprintf("%7.3f° %c", math.Abs(p.Lon), lonHemisphere)
-			alt := fmt.Sprintf("%s feet", humanize.Comma(int64(p.Altitude)))
-			spd := fmt.Sprintf("%.0f mph", p.Speed)
-			crs := fmt.Sprintf("%v°", p.Heading)
+	p := g.Position()
+	//log.Printf("Received new GPS point: %+v\n", p)
 
-			draw.Blank(14, 26, 8, draw.Black)
-			draw.PrintText(14, 8, draw.WhiteText, alt)
+	// Anything worked out from a stale fix is grayed out
+	fix := g.Fix()
+	now := time.Now()
+	myStyle, fromMeStyle := draw.YellowText, draw.WhiteText
+	if fix.Stale(now) {
+		myStyle, fromMeStyle = draw.GreyText, draw.GreyText
+	}
+
+	u.myFix.Set(fixStyle(fix), fixString(fix))
+	u.myFixDetail.Set(draw.GreyText, fixDetail(fix, now))
+
+	if p.Lat != 0 && p.Lon != 0 {
+		format := currentCoordFormat()
+		lat, lon := coordStrings(p, format)
+		latTitle, lonTitle := coordTitles(format)
+
+		u.myLatTitle.Set(draw.WhiteText, latTitle)
+		u.myLonTitle.Set(draw.WhiteText, lonTitle)
+		u.myLat.Set(myStyle, lat)
+		u.myLon.Set(myStyle, lon)
+		us := units()
+		u.myAlt.Set(myStyle, us.Altitude.Format(p.Altitude))
+		u.mySpeed.Set(myStyle, us.Speed.Format(p.Speed))
+		u.myCourse.Set(myStyle, fmt.Sprintf("%v°", p.Heading))
+	}
 
-			draw.Blank(14, 22, 9, draw.Black)
-			draw.PrintText(14, 9, draw.WhiteText, spd)
+	me := []draw.Span{
+		{Text: "*", Style: draw.RedText},
+		{Text: chaserCallsign(), Style: draw.WhiteText},
+		{Text: "N/A", Style: draw.WhiteText},
+		{},
+	}
+	rows := [][]draw.Span{me}
+	calls := []string{chaserCallsign()}
+
+	bl := balloonCallsign()
 
-			draw.Blank(14, 19, 10, draw.Black)
-			draw.PrintText(14, 10, draw.WhiteText, crs)
-			draw.PrintText(19, 10, draw.CyanText, directionalArrow(int(p.Heading)))
+	var balloonPos geospatial.Point
 
-			draw.Blank(3, 27, 14, draw.Black)
-			draw.PrintText(3, 14, draw.WhiteText, lat)
-			draw.PrintText(3+len(lat), 14, draw.PurpleText, "/")
-			draw.PrintText(3+2+len(lat), 14, draw.WhiteText, lon)
+	// Fetch the current balloon payload position, if we've had one
+	if lp, exists := a.LastPosition(bl); exists {
+		balloonPos = lp.data.Position
+	}
 
-			draw.SafeFlush()
+	if balloonPos.Lat != 0 {
+		myPos := g.Position()
+		meDistToBalloon := myPos.GreatCircleDistanceTo(balloonPos)
+		meBearToBalloon := myPos.BearingTo(balloonPos)
+		me[3] = draw.Span{Text: vectorString(meDistToBalloon, meBearToBalloon), Style: fromMeStyle}
+
+		for _, v := range sortedChasers {
+			if lp, exists := a.LastPosition(v); exists {
+				meDistToChaser := myPos.GreatCircleDistanceTo(lp.data.Position)
+				meBearToChaser := myPos.BearingTo(lp.data.Position)
+				chaserDistToBln := lp.data.Position.GreatCircleDistanceTo(balloonPos)
+				chaserBearToBln := lp.data.Position.BearingTo(balloonPos)
+				calls = append(calls, v)
+				rows = append(rows, []draw.Span{
+					{},
+					{Text: lp.pkt.Source.String(), Style: draw.WhiteText},
+					{Text: vectorString(meDistToChaser, meBearToChaser), Style: fromMeStyle},
+					{Text: vectorString(chaserDistToBln, chaserBearToBln), Style: draw.WhiteText},
+				})
+			} else if _, exists := a.LastPacket(v); exists {
+				calls = append(calls, v)
+				rows = append(rows, []draw.Span{
+					{},
+					{Text: v, Style: draw.WhiteText},
+					{Text: "- NO POSITION -", Style: draw.WhiteText},
+					{Text: "- NO POSITION -", Style: draw.WhiteText},
+				})
+			} else {
+				calls = append(calls, v)
+				rows = append(rows, []draw.Span{
+					{},
+					{Text: v, Style: draw.WhiteText},
+					{Text: "- NOT HEARD -", Style: draw.WhiteText},
+					{Text: "- NOT HEARD -", Style: draw.WhiteText},
+				})
+			}
 		}
-		time.Sleep(time.Second * 1)
 	}
 
+	u.setChaserRows(rows, calls)
 }
 
-func DrawChaseConsole() {
-	draw.PrintText(32, 2, draw.RedTitle, "CHASERS")
-	draw.PrintText(32, 4, draw.CyanTitle, "MY CHASE VEHICLE")
-	draw.PrintText(32, 5, draw.WhiteText, "LAT:")
-	draw.PrintText(32, 6, draw.WhiteText, "LON:")
-	draw.PrintText(32, 7, draw.WhiteText, "ALT:")
-	draw.PrintText(55, 5, draw.WhiteText, "SPEED:")
-	draw.PrintText(54, 6, draw.WhiteText, "COURSE:")
-	draw.PrintText(63, 5, draw.YellowText, "-----------")
-	draw.PrintText(63, 6, draw.YellowText, "-----------")
-	draw.PrintText(38, 5, draw.YellowText, "-----------")
-	draw.PrintText(38, 6, draw.YellowText, "-----------")
-	draw.PrintText(38, 7, draw.YellowText, "-----------")
-
-	draw.PrintText(32, 10, draw.CyanTitle, "CALLSIGN")
-	draw.PrintText(45, 10, draw.CyanTitle, "FROM ME         ")
-	draw.PrintText(65, 10, draw.CyanTitle, "FROM PAYLOAD    ")
+func (u *trackerUI) UpdateRecentPackets(ctx context.Context, a *APRSTNC) {
+	for {
+		u.refreshPackets(a)
+		if !sleep(ctx, 1*time.Second) {
+			return
+		}
+	}
 }
 
-func DrawMyChaseVehicleReadings(g *gps.GPSReading, a *APRSTNC) {
-	var latHemisphere, lonHemisphere rune
+// refreshPackets fills the packet table from the history, leaving out any
+// packets that don't match the type filter
+func (u *trackerUI) refreshPackets(a *APRSTNC) {
+	var rows [][]draw.Span
+	var shown []PayloadPacket
 
-	var sortedChasers []string
+	filter := u.PacketFilter()
 
-	for ck := range chasers {
-		sortedChasers = append(sortedChasers, ck)
+	for _, v := range a.HistoryAsSlice() {
+		t := packetType(v)
+		if filter != "" && t != filter {
+			continue
+		}
+		shown = append(shown, v)
+		rows = append(rows, []draw.Span{
+			{Text: fmt.Sprintf("%7s", shortDuration(time.Since(v.ts))), Style: draw.WhiteText},
+			{Text: t, Style: packetTypeStyle(t)},
+			{Text: v.pkt.OriginalBody, Style: draw.WhiteText},
+		})
 	}
 
-	sort.Strings(sortedChasers)
+	u.setPacketRows(rows, shown)
+}
 
+// UpdateHeardStations fills the heard stations table with everyone we've heard on RF
+func (u *trackerUI) UpdateHeardStations(ctx context.Context, g PositionSource, a *APRSTNC) {
 	for {
-		p := g.Get()
-		//log.Printf("Received new GPS point: %+v\n", p)
-		if p.Lat != 0 && p.Lon != 0 {
+		var rows [][]draw.Span
 
-			if p.Lat > 0 {
-				latHemisphere = 'N'
-			} else {
-				latHemisphere = 'S'
+		me := g.Position()
+		fromMeStyle := draw.WhiteText
+		if g.Fix().Stale(time.Now()) {
+			fromMeStyle = draw.GreyText
+		}
+
+		for _, st := range a.HeardStations() {
+			via := "DIRECT"
+			viaStyle := draw.GreenText
+			if !st.HeardDirect() {
+				via = "DIGI"
+				viaStyle = draw.YellowText
 			}
 
-			if p.Lon > 0 {
-				lonHemisphere = 'E'
-			} else {
-				lonHemisphere = 'W'
+			pos := draw.Span{Text: "---", Style: draw.GreyText}
+			fromMe := draw.Span{}
+			if st.Position.Lat != 0 || st.Position.Lon != 0 {
+				pos = draw.Span{Text: shortLatLon(st.Position), Style: draw.WhiteText}
+				if me.Lat != 0 && me.Lon != 0 {
+					fromMe = draw.Span{
+						Text:  vectorString(me.GreatCircleDistanceTo(st.Position), me.BearingTo(st.Position)),
+						Style: fromMeStyle,
+					}
+				}
 			}
 
-			lat := fmt.Sprintf("%7.3f° %c", math.Abs(p.Lat), latHemisphere)
-			lon := fmt.Sprintf("%7.3f° %c", math.Abs(p.Lon), lonHemisphere)
-			alt := fmt.Sprintf("%s feet", humanize.Comma(int64(p.Altitude)))
-			spd := fmt.Sprintf("%.0f mph", p.Speed)
-			crs := fmt.Sprintf("%v°", p.Heading)
-
-			draw.Blank(38, 51, 5, draw.Black)
-			draw.Blank(38, 51, 6, draw.Black)
-			draw.Blank(38, 51, 7, draw.Black)
-			draw.Blank(63, 76, 5, draw.Black)
-			draw.Blank(63, 76, 6, draw.Black)
-			draw.PrintText(38, 5, draw.YellowText, lat)
-			draw.PrintText(38, 6, draw.YellowText, lon)
-			draw.PrintText(38, 7, draw.YellowText, alt)
-			draw.PrintText(63, 5, draw.YellowText, spd)
-			draw.PrintText(63, 6, draw.YellowText, crs)
-			draw.SafeFlush()
+			rows = append(rows, []draw.Span{
+				{Text: st.Callsign, Style: draw.WhiteText},
+				{Text: fmt.Sprintf("%5d", st.Packets), Style: draw.WhiteText},
+				{Text: via, Style: viaStyle},
+				{Text: fmt.Sprintf("%7s", shortDuration(time.Since(st.LastHeard))), Style: draw.WhiteText},
+				{Text: symbolName(st.SymbolTable, st.SymbolCode), Style: draw.CyanText},
+				pos,
+				fromMe,
+			})
 		}
 
-		ch := fmt.Sprintf("%v-%v", *chasercall, *chaserssid)
-		draw.PrintText(31, 11, draw.RedText, "*")
-		draw.PrintText(32, 11, draw.WhiteText, ch)
-		draw.PrintText(45, 11, draw.WhiteText, "N/A")
-
-		bl := fmt.Sprintf("%v-%v", *ballooncall, *balloonssid)
+		u.heard.SetRows(rows)
+		if !sleep(ctx, 1*time.Second) {
+			return
+		}
+	}
+}
 
-		var balloonPos geospatial.Point
+// UpdatePayloadPaths fills the payload paths screen with which digipeaters are
+// relaying the balloon and how its recent packets got to us
+func (u *trackerUI) UpdatePayloadPaths(ctx context.Context, a *APRSTNC) {
+	for {
+		direct, relayed, digis := a.PathSummary()
+		if direct+relayed > 0 {
+			u.pathsSummary.SetSpans(
+				draw.Span{Text: fmt.Sprintf("%v", direct), Style: draw.GreenText},
+				draw.Span{Text: " packets heard direct, ", Style: draw.WhiteText},
+				draw.Span{Text: fmt.Sprintf("%v", relayed), Style: draw.YellowText},
+				draw.Span{Text: fmt.Sprintf(" digipeated by %v digis", len(digis)), Style: draw.WhiteText},
+			)
+		}
 
-		// Fetch the current balloon payload position, if it's not nil
-		a.lastPacketMu.Lock()
-		if _, exists := a.lastPacket[bl]; exists {
-			if a.lastPacket[bl].data.Position.Lat != 0 {
-				balloonPos = a.lastPacket[bl].data.Position
-			}
+		var digiRows [][]draw.Span
+		for _, d := range digis {
+			digiRows = append(digiRows, []draw.Span{
+				{Text: d.Callsign, Style: draw.WhiteText},
+				{Text: fmt.Sprintf("%7d", d.Packets), Style: draw.WhiteText},
+				{Text: fmt.Sprintf("%8d", d.LastHop), Style: draw.WhiteText},
+				{Text: d.FirstHeard.Format("15:04:05"), Style: draw.WhiteText},
+				{Text: d.LastHeard.Format("15:04:05"), Style: draw.WhiteText},
+			})
 		}
-		a.lastPacketMu.Unlock()
-
-		if balloonPos.Lat != 0 {
-			myPos := g.Get()
-			meDistToBalloon := myPos.GreatCircleDistanceTo(balloonPos)
-			meBearToBalloon := myPos.BearingTo(balloonPos)
-			draw.PrintText(65, 11, draw.WhiteText, fmt.Sprintf("%0.1f mi @ %v°", meDistToBalloon, meBearToBalloon))
-			i := 0
-			for _, v := range sortedChasers {
-				draw.PrintText(32, 12+i, draw.WhiteText, v)
-				if lp, exists := a.lastPacket[v]; exists {
-					if lp.data.Position.Lat != 0 {
-						meDistToChaser := myPos.GreatCircleDistanceTo(lp.data.Position)
-						meBearToChaser := myPos.BearingTo(lp.data.Position)
-						chaserDistToBln := lp.data.Position.GreatCircleDistanceTo(balloonPos)
-						chaserBearToBln := lp.data.Position.BearingTo(balloonPos)
-						draw.PrintText(32, 12+i, draw.WhiteText, lp.pkt.Source.String())
-						draw.PrintText(45, 12+i, draw.WhiteText, fmt.Sprintf("%0.1f mi @ %v°", meDistToChaser, meBearToChaser))
-						draw.PrintText(65, 12+i, draw.WhiteText, fmt.Sprintf("%0.1f mi @ %v°", chaserDistToBln, chaserBearToBln))
-						i++
-					}
-				} else {
-					draw.PrintText(45, 12+i, draw.WhiteText, "- NOT HEARD -")
-					draw.PrintText(65, 12+i, draw.WhiteText, "- NOT HEARD -")
-					i++
-				}
+		u.digis.SetRows(digiRows)
+
+		var pathRows [][]draw.Span
+		for _, v := range a.TrackAsSlice() {
+			via := draw.Span{Text: "DIRECT", Style: draw.GreenText}
+			if digipeated(v.pkt.Path) {
+				via = draw.Span{Text: "DIGI", Style: draw.YellowText}
 			}
+			pathRows = append(pathRows, []draw.Span{
+				{Text: fmt.Sprintf("%7s", shortDuration(time.Since(v.ts))), Style: draw.WhiteText},
+				via,
+				{Text: markedPath(v.pkt.Path), Style: draw.WhiteText},
+			})
 		}
+		u.payloadPaths.SetRows(pathRows)
 
-		time.Sleep(time.Second * 1)
+		if !sleep(ctx, 1*time.Second) {
+			return
+		}
 	}
 }
 
-func DrawStatusBar(x_size, y_size int) {
-	draw.PrintText(2, y_size, draw.BlueText, "╡")
-	draw.PrintText(x_size-2, y_size, draw.BlueText, "╞")
-
-	draw.Mu.Lock()
+func statusHotKey(key, label string, k draw.Key) draw.StatusItem {
+	return draw.StatusItem{
+		Spans: []draw.Span{
+			{Text: key, Style: draw.YellowOnBlueText},
+			{Text: " " + label, Style: draw.CyanOnBlueText},
+		},
+		Key: k,
+	}
+}
 
-	termbox.SetCell(3, y_size, ' ', termbox.ColorBlack, termbox.ColorBlack)
-	termbox.SetCell(x_size-3, y_size, ' ', termbox.ColorBlack, termbox.ColorBlack)
+func statusLink(name, addr string, ok bool) draw.StatusItem {
+	mark := draw.Span{Text: "✓", Style: draw.YellowOnBlueText}
+	if !ok {
+		mark = draw.Span{Text: "✘", Style: draw.RedOnBlueText}
+	}
+	return statusMark(name, addr, mark)
+}
 
-	for x := 3; x < x_size-2; x++ {
-		termbox.SetCell(x, y_size, ' ', termbox.ColorWhite|termbox.AttrBold, termbox.ColorBlue)
+// statusGPS tells a GPS that's connected but has no fix apart from one that
+// isn't connected at all
+func statusGPS(g PositionSource) draw.StatusItem {
+	if g.IsReady() && g.Fix().Stale(time.Now()) {
+		return statusMark("GPS", g.Address(), draw.Span{Text: "NO FIX", Style: draw.RedOnBlueText})
 	}
+	return statusLink("GPS", g.Address(), g.IsReady())
+}
 
-	draw.Mu.Unlock()
+func statusMark(name, addr string, mark draw.Span) draw.StatusItem {
+	return draw.StatusItem{
+		Spans: []draw.Span{{Text: fmt.Sprintf("%v: %v ", name, addr), Style: draw.WhiteOnBlueText}, mark},
+		Short: []draw.Span{{Text: name + ": ", Style: draw.WhiteOnBlueText}, mark},
+	}
+}
 
-	draw.PrintText(4, y_size, draw.WhiteOnBlueText, "TNC: 127.0.0.1:6700")
+// UpdateAlerts flashes the banner while any alert is unacknowledged
+func (u *trackerUI) UpdateAlerts(ctx context.Context) {
+	flash := false
+	for {
+		unacked := u.alerts.Unacked()
+		if len(unacked) == 0 {
+			u.banner.Set(draw.WhiteOnRedText, "")
+		} else {
+			text := " ALERT: " + unacked[0].Text
+			if len(unacked) > 1 {
+				text += fmt.Sprintf(" (+%d more)", len(unacked)-1)
+			}
+			text += "  [F5] to acknowledge "
 
-	draw.PrintText(27, y_size, draw.WhiteOnBlueText, "GPS: 127.0.0.1:2947")
+			// Flash in reverse video, which shows up in every theme
+			style := draw.WhiteOnRedText
+			if flash {
+				style.Fg ^= draw.AttrReverse
+			}
+			u.banner.Set(style, text)
+			flash = !flash
+		}
+		if !sleep(ctx, 500*time.Millisecond) {
+			return
+		}
+	}
+}
 
-	draw.PrintText(52, y_size, draw.YellowOnBlueText, "[F1]")
-	draw.PrintText(57, y_size, draw.CyanOnBlueText, "Send Message")
+// UpdateWaypoints fills the waypoint table with how far away each waypoint is
+func (u *trackerUI) UpdateWaypoints(ctx context.Context, g PositionSource) {
+	for {
+		var rows [][]draw.Span
+		var names []string
 
-	draw.PrintText(71, y_size, draw.YellowOnBlueText, "[F7]")
-	draw.PrintText(76, y_size, draw.CyanOnBlueText, "Cutdown")
+		me := g.Position()
+		fromMeStyle := draw.WhiteText
+		if g.Fix().Stale(time.Now()) {
+			fromMeStyle = draw.GreyText
+		}
 
-	draw.PrintText(85, y_size, draw.YellowOnBlueText, "[ESC]")
-	draw.PrintText(91, y_size, draw.CyanOnBlueText, "Exit")
-}
+		for _, w := range waypoints.List() {
+			fromMe := draw.Span{}
+			if me.Lat != 0 && me.Lon != 0 {
+				fromMe = draw.Span{Text: vectorString(me.GreatCircleDistanceTo(w.Pos), me.BearingTo(w.Pos)), Style: fromMeStyle}
+			}
 
-func DrawRecentPacketsTable() {
-	draw.PrintText(3, 16, draw.RedTitle, "RECENT PACKETS")
-	draw.PrintText(3, 18, draw.CyanTitle, "AGE    ")
-	draw.PrintText(12, 18, draw.CyanTitle, "TYPE   ")
-	draw.PrintText(21, 18, draw.CyanTitle, "CONTENTS                                                    ")
-}
+			tx := draw.Span{Text: "-", Style: draw.GreyText}
+			if w.Transmit {
+				tx = draw.Span{Text: "YES", Style: draw.GreenText}
+			}
 
-func DrawRecentPackets(a *APRSTNC, width int) {
-	for {
+			note := draw.Span{}
+			if w.Inside(me) {
+				note = draw.Span{Text: "YOU'RE INSIDE", Style: draw.RedText}
+			}
 
-		recent := a.RingAsSlice()
-
-		i := 19
-		for k, v := range recent {
-			tr := regexp.MustCompile(`([\dhm]*)\.?\d*([ms]{1,2})$`)
-			matches := tr.FindStringSubmatch(time.Since(v.ts).String())
-			timePadded := fmt.Sprintf("%7s", matches[1]+matches[2])
-			var pktType string
-			if v.data.Position.Lat != 0 && ((v.data.CompressedTelemetry.A1 != 0) || (v.data.StandardTelemetry.A1 != 0)) {
-				pktType = "POS+TLM"
-			} else if v.data.Position.Lat != 0 {
-				pktType = "POS"
-			} else if v.data.Message.Recipient.Callsign != "" {
-				pktType = "MSG"
+			kindStyle := draw.CyanText
+			if w.Kind == waypointNoGo {
+				kindStyle = draw.RedText
 			}
 
-			draw.Blank(3, width-2, i+k, draw.Black)
-			draw.PrintText(3, i+k, draw.WhiteText, timePadded)
-			draw.PrintText(12, i+k, draw.WhiteText, pktType)
-			draw.PrintText(21, i+k, draw.WhiteText, v.pkt.OriginalBody)
+			names = append(names, w.Name)
+			rows = append(rows, []draw.Span{
+				{Text: w.Name, Style: draw.WhiteText},
+				{Text: strings.ToUpper(w.Kind), Style: kindStyle},
+				{Text: shortLatLon(w.Pos), Style: draw.WhiteText},
+				fromMe,
+				tx,
+				note,
+			})
+		}
+
+		u.setWaypointRows(rows, names)
+		if !sleep(ctx, 1*time.Second) {
+			return
 		}
-		time.Sleep(1 * time.Second)
 	}
 }
 
-func monitorConnections(a *APRSTNC, g *gps.GPS, x_size, y_size int) {
+func (u *trackerUI) monitorConnections(ctx context.Context, a *APRSTNC, g PositionSource) {
 	for {
-		if a.IsConnected() {
-			draw.PrintText(24, y_size, draw.YellowOnBlueText, "✓")
-		} else {
-			draw.PrintText(24, y_size, draw.RedOnBlueText, "✘")
+		u.refreshStatus(a, g)
+		if !sleep(ctx, 1*time.Second) {
+			return
 		}
-		if g.IsReady() {
-			draw.PrintText(47, y_size, draw.YellowOnBlueText, "✓")
-		} else {
-			draw.PrintText(47, y_size, draw.RedOnBlueText, "✘")
+	}
+}
+
+// hotKey is a key listed in the status bar and on the help screen
+type hotKey struct {
+	key       string
+	label     string
+	help      string
+	k         draw.Key
+	essential bool // Goes at the front of the status bar, so it's always there
+}
+
+var hotKeys = []hotKey{
+	{"[F1]", "Send Message", "Send a message to the payload or a chaser", draw.KeyF1, false},
+	{"[F2]", "Heard", "Show every station heard on RF", draw.KeyF2, false},
+	{"[F3]", "Filter", "Filter the packet list by type", draw.KeyF3, false},
+	{"[F4]", "Paths", "Show how the payload's packets reached us", draw.KeyF4, false},
+	{"[F5]", "Alerts", "List and acknowledge alerts", draw.KeyF5, false},
+	{"[F6]", "Units", "Switch units", draw.KeyF6, false},
+	{"[F7]", "Cutdown", "Arm the cutdown, then press again to send it", draw.KeyF7, true},
+	{"[F8]", "Coords", "Switch coordinate format", draw.KeyF8, false},
+	{"[F9]", "Navigate", "Navigate to the payload, landing or a chaser", draw.KeyF9, false},
+	{"[F10]", "Waypoints", "Manage waypoints", draw.KeyF10, false},
+	{"[↑↓↵]", "Inspect", "Select a packet and show its details", draw.KeyEnter, false},
+	{"[ESC]", "Exit", "Go back, or exit from the main screen", draw.KeyEsc, true},
+	{"[?]", "Help", "Show this list", draw.KeyNone, true},
+}
+
+// refreshStatus shows the TNC and GPS connections and our hot keys in the
+// status bar.  The bar leaves off whatever doesn't fit, so cutdown, exit and
+// help go first and the rest are on the help screen.
+func (u *trackerUI) refreshStatus(a *APRSTNC, g PositionSource) {
+	items := []draw.StatusItem{
+		statusLink("TNC", *a.remotetnc, a.IsConnected()),
+		statusGPS(g),
+	}
+	for _, essential := range []bool{true, false} {
+		for _, hk := range hotKeys {
+			if hk.essential == essential {
+				items = append(items, statusHotKey(hk.key, hk.label, hk.k))
+			}
 		}
-		draw.SafeFlush()
-		time.Sleep(1 * time.Second)
 	}
+	u.status.SetItems(items)
+}
+
+// shortDuration trims a duration down to whole seconds, e.g. "1h2m3s"
+func shortDuration(d time.Duration) string {
+	tr := regexp.MustCompile(`([\dhm]*)\.?\d*([ms]{1,2})$`)
+	matches := tr.FindStringSubmatch(d.String())
+	if matches == nil {
+		return d.String()
+	}
+	return matches[1] + matches[2]
+}
+
+// verticalRate averages the balloon's climb/descent rate (ft/min) over the
+// last three packets that carried an altitude
+func verticalRate(recent []PayloadPacket) (int, bool) {
+	if len(recent) < 3 {
+		return 0, false
+	}
+	if recent[0].data.Position.Altitude == 0 || recent[1].data.Position.Altitude == 0 || recent[2].data.Position.Altitude == 0 {
+		return 0, false
+	}
+	secs := recent[0].ts.Unix() - recent[2].ts.Unix()
+	if secs == 0 {
+		return 0, false
+	}
+	d1 := int64(recent[0].data.Position.Altitude - recent[1].data.Position.Altitude)
+	d2 := int64(recent[1].data.Position.Altitude - recent[2].data.Position.Altitude)
+	return int((d1 + d2) * 60 / secs), true
+}
+
+func balloonCallsign() string {
+	return fullCallsign(*ballooncall, *balloonssid)
+}
+
+func chaserCallsign() string {
+	return fullCallsign(*chasercall, *chaserssid)
+}
+
+// fullCallsign joins a callsign and SSID the way they come over the air, e.g.
+// N0CALL-9.  SSID 0 is never sent, so an empty or zero SSID leaves just the
+// callsign.
+func fullCallsign(call, ssid string) string {
+	call = strings.ToUpper(strings.TrimSpace(call))
+	ssid = strings.TrimSpace(ssid)
+	if ssid == "" || ssid == "0" {
+		return call
+	}
+	return fmt.Sprintf("%v-%v", call, ssid)
+}
+
+// checkCallsigns makes sure that the balloon and chaser callsigns given on the
+// command line are ones we can send from and match against
+func checkCallsigns() error {
+	if _, err := parseAddress(balloonCallsign()); err != nil {
+		return fmt.Errorf("bad -ballooncall/-balloonssid: %v", err)
+	}
+	if _, err := parseAddress(chaserCallsign()); err != nil {
+		return fmt.Errorf("bad -chasercall/-chaserssid: %v", err)
+	}
+	return nil
+}
+
+func sortedChaserCallsigns() []string {
+	var sortedChasers []string
+	for ck := range chasers {
+		sortedChasers = append(sortedChasers, ck)
+	}
+	sort.Strings(sortedChasers)
+	return sortedChasers
 }
 
 func directionalArrow(h int) string {
@@ -427,16 +818,22 @@ func directionalArrow(h int) string {
 	}
 }
 
-func drawRate(r int) {
-	draw.Blank(14, 31, 12, draw.Black)
-	rate := fmt.Sprintf("%v", r)
+// vectorString is a distance (miles) and bearing, e.g. "12.3 mi @ 45°"
+func vectorString(dist float64, bearing uint16) string {
+	return fmt.Sprintf("%v @ %v°", units().Distance.Format(dist), bearing)
+}
+
+func rateSpans(r int) []draw.Span {
+	ru := units().Rate
+	rate := ru.Number(float64(r))
 	if r >= 0 {
-		draw.PrintText(14, 12, draw.GreenText, "+")
-		draw.PrintText(15, 12, draw.GreenText, rate)
-		draw.PrintText(16+len(rate), 12, draw.WhiteText, "ft/min")
-	} else if r < 0 {
-		r = 0 - r
-		draw.PrintText(15, 12, draw.RedText, rate)
-		draw.PrintText(16+len(rate), 12, draw.WhiteText, "ft/min")
+		return []draw.Span{
+			{Text: "+" + rate, Style: draw.GreenText},
+			{Text: " " + ru.Label, Style: draw.WhiteText},
+		}
+	}
+	return []draw.Span{
+		{Text: " " + rate, Style: draw.RedText},
+		{Text: " " + ru.Label, Style: draw.WhiteText},
 	}
 }
@@ -0,0 +1,558 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metersPerSecToMph = 2.23694
+
+	// A fix older than this is stale
+	staleFixAge = 10 * time.Second
+
+	// NMEA 0183's standard serial speed
+	defaultNMEABaud = 4800
+)
+
+// Fix modes, as in gpsd's TPV reports and NMEA's GSA sentence.  NMEA GPSes
+// that don't send GSA leave the mode unknown.
+const (
+	fixModeUnknown = iota
+	fixModeNone
+	fixMode2D
+	fixMode3D
+)
+
+// fixQualityManual is the GGA fix quality of a position that was entered by hand
+const fixQualityManual = 7
+
+// GPSConfig says where our own position comes from
+type GPSConfig struct {
+	Source  string `yaml:"source"`  // gpsd (the default), nmea, replay or fixed
+	Address string `yaml:"address"` // gpsd's host:port.  Defaults to -remotegps.
+	Device  string `yaml:"device"`  // The NMEA serial device or pty, or the file to replay
+	Baud    int    `yaml:"baud"`    // The NMEA serial device's speed.  Defaults to 4800.
+
+	// Where a fixed ground station is.  Altitude is in feet.
+	Lat      float64 `yaml:"lat"`
+	Lon      float64 `yaml:"lon"`
+	Altitude float64 `yaml:"altitude"`
+}
+
+// PositionSource is anything that can tell us where we are
+type PositionSource interface {
+	// Start reads positions until ctx is done, reconnecting as needed
+	Start(ctx context.Context)
+	Position() geospatial.Point
+	Fix() Fix
+	// IsReady reports whether we're connected to the source
+	IsReady() bool
+	// Address is where the source is, for the status bar
+	Address() string
+}
+
+// Fix describes the quality of the last position we were given
+type Fix struct {
+	Quality    int       // As in NMEA's GGA sentence: 0 is no fix, 1 GPS, 2 DGPS, 7 manual, etc.
+	Mode       int       // fixModeNone, fixMode2D, etc.
+	HDOP       float64   // Horizontal dilution of precision, or 0 if we don't know it
+	Satellites int       // Satellites used in the fix
+	Visible    int       // Satellites in view, or 0 if we don't know
+	Time       time.Time // When we last had a fix
+}
+
+// HasFix reports whether the GPS has a position at all, however old
+func (f Fix) HasFix() bool {
+	return f.Quality != 0 && f.Mode != fixModeNone
+}
+
+// Stale reports whether we've gone too long without a fix to trust our position
+func (f Fix) Stale(now time.Time) bool {
+	if f.Quality == fixQualityManual {
+		return false
+	}
+	return !f.HasFix() || now.Sub(f.Time) > staleFixAge
+}
+
+// ModeString is "2D" or "3D", or empty if we don't know the fix mode
+func (f Fix) ModeString() string {
+	switch f.Mode {
+	case fixMode2D:
+		return "2D"
+	case fixMode3D:
+		return "3D"
+	}
+	return ""
+}
+
+var fixQualities = []string{"NO FIX", "GPS", "DGPS", "PPS", "RTK", "FLOAT RTK", "DEAD RECKONING", "MANUAL", "SIMULATED"}
+
+func (f Fix) String() string {
+	if f.Quality < 0 || f.Quality >= len(fixQualities) {
+		return fmt.Sprintf("FIX %d", f.Quality)
+	}
+	return fixQualities[f.Quality]
+}
+
+func newPositionSource(c GPSConfig) (PositionSource, error) {
+	switch c.Source {
+	case "", "gpsd":
+		addr := c.Address
+		if addr == "" {
+			addr = *remotegps
+		}
+		return &gpsdSource{addr: addr}, nil
+	case "nmea", "replay":
+		if c.Device == "" {
+			return nil, fmt.Errorf("gps source %v needs a device", c.Source)
+		}
+		baud := c.Baud
+		if baud == 0 {
+			baud = defaultNMEABaud
+		}
+		return &nmeaSource{device: c.Device, baud: baud, replay: c.Source == "replay"}, nil
+	case "fixed":
+		if c.Lat == 0 && c.Lon == 0 {
+			return nil, fmt.Errorf("gps source fixed needs a lat and lon")
+		}
+		s := &fixedSource{}
+		s.set(geospatial.Point{Lat: c.Lat, Lon: c.Lon, Altitude: c.Altitude}, Fix{Quality: fixQualityManual, Mode: fixMode3D})
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown gps source %q: use gpsd, nmea, replay or fixed", c.Source)
+	}
+}
+
+// sourceState is the position, fix and connection state every source keeps
+type sourceState struct {
+	mu    sync.Mutex
+	pos   geospatial.Point
+	fix   Fix
+	ready bool
+}
+
+func (s *sourceState) Position() geospatial.Point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pos
+}
+
+func (s *sourceState) Fix() Fix {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fix
+}
+
+func (s *sourceState) IsReady() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ready
+}
+
+func (s *sourceState) set(p geospatial.Point, f Fix) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pos = p
+	s.fix = f
+}
+
+func (s *sourceState) setReady(r bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = r
+}
+
+//
+// gpsd
+//
+
+// gpsdSource watches gpsd's JSON reports
+type gpsdSource struct {
+	sourceState
+	addr string
+}
+
+// gpsdReport is the parts of gpsd's TPV and SKY reports that we use
+type gpsdReport struct {
+	Class      string  `json:"class"`
+	Mode       int     `json:"mode"`
+	Status     int     `json:"status"`
+	Lat        float64 `json:"lat"`
+	Lon        float64 `json:"lon"`
+	Alt        float64 `json:"alt"`
+	Speed      float64 `json:"speed"`
+	Track      float64 `json:"track"`
+	HDOP       float64 `json:"hdop"`
+	NSat       *int    `json:"nSat"`
+	USat       *int    `json:"uSat"`
+	Satellites []struct {
+		Used bool `json:"used"`
+	} `json:"satellites"`
+}
+
+func (s *gpsdSource) Address() string {
+	return s.addr
+}
+
+func (s *gpsdSource) Start(ctx context.Context) {
+	for {
+		err := s.watch(ctx)
+		s.setReady(false)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("Lost gpsd %v: %v", s.addr, err)
+		log.Println("Sleeping 5 seconds and trying again")
+		if !sleep(ctx, 5*time.Second) {
+			return
+		}
+	}
+}
+
+func (s *gpsdSource) watch(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	_, err = io.WriteString(conn, `?WATCH={"enable":true,"json":true};`+"\n")
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Connection to gpsd %v successful", s.addr)
+	s.setReady(true)
+
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		var r gpsdReport
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			continue
+		}
+		s.report(r)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+func (s *gpsdSource) report(r gpsdReport) {
+	p, f := s.Position(), s.Fix()
+
+	switch r.Class {
+	case "TPV":
+		f.Mode = r.Mode
+		if r.Mode < fixMode2D {
+			f.Quality = 0
+			break
+		}
+		f.Quality = 1
+		if r.Status == 2 {
+			f.Quality = 2
+		}
+		f.Time = time.Now()
+		p = geospatial.Point{
+			Lat:      r.Lat,
+			Lon:      r.Lon,
+			Altitude: r.Alt * metersToFeet,
+			Speed:    r.Speed * metersPerSecToMph,
+			Heading:  uint16(r.Track),
+		}
+	case "SKY":
+		if r.HDOP != 0 {
+			f.HDOP = r.HDOP
+		}
+		if r.USat != nil && r.NSat != nil {
+			f.Satellites, f.Visible = *r.USat, *r.NSat
+			break
+		}
+		if r.Satellites == nil {
+			return
+		}
+		f.Satellites, f.Visible = 0, len(r.Satellites)
+		for _, sat := range r.Satellites {
+			if sat.Used {
+				f.Satellites++
+			}
+		}
+	default:
+		return
+	}
+
+	s.set(p, f)
+}
+
+//
+// NMEA
+//
+
+// nmeaSource reads NMEA 0183 sentences from a serial GPS, a pty or, when
+// replaying, a file.  Serial ports and ptys are set to the baud rate, raw
+// and without echo before we read them.
+type nmeaSource struct {
+	sourceState
+	device string
+	baud   int
+	replay bool
+}
+
+func (s *nmeaSource) Address() string {
+	return s.device
+}
+
+func (s *nmeaSource) Start(ctx context.Context) {
+	for {
+		fixes, err := s.read(ctx)
+		s.setReady(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == io.EOF && s.replay && fixes > 0 {
+			// Start the file over.  If it had nothing in it we could use,
+			// fall through and back off rather than spinning on it.
+			continue
+		}
+		log.Printf("Lost GPS %v: %v", s.device, err)
+		log.Println("Sleeping 5 seconds and trying again")
+		if !sleep(ctx, 5*time.Second) {
+			return
+		}
+	}
+}
+
+// read reads sentences from the device until it fails, returning how many
+// fixes it got first
+func (s *nmeaSource) read(ctx context.Context) (int, error) {
+	if !s.replay {
+		if err := setupTTY(ctx, s.device, s.baud); err != nil {
+			return 0, err
+		}
+	}
+
+	f, err := os.Open(s.device)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	defer closeOnDone(ctx, f)()
+
+	s.setReady(true)
+
+	var np nmeaParser
+	fixes := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		if !np.Parse(sc.Text()) {
+			continue
+		}
+		s.set(np.pos, np.fix)
+		if np.fix.HasFix() {
+			fixes++
+		}
+
+		// A replayed file goes at the rate it was recorded, one fix a second
+		if s.replay && np.epoch && !sleep(ctx, 1*time.Second) {
+			return fixes, ctx.Err()
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return fixes, err
+	}
+	return fixes, io.EOF
+}
+
+// setupTTY puts a serial device or pty in raw mode at the given baud rate,
+// with echo off so nothing we're sent goes back to the GPS.  Anything that
+// isn't a terminal, like a FIFO, is left alone.
+func setupTTY(ctx context.Context, device string, baud int) error {
+	fi, err := os.Stat(device)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+
+	out, err := exec.CommandContext(ctx, "stty", sttyArgs(runtime.GOOS, device, baud)...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("setting up %v: %v: %s", device, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// sttyArgs are the stty arguments that set up device on the given OS.  The
+// BSDs and macOS name the device with -f where GNU stty uses -F.
+func sttyArgs(goos, device string, baud int) []string {
+	opt := "-F"
+	if goos != "linux" {
+		opt = "-f"
+	}
+	args := []string{opt, device, "raw", "-echo"}
+	if baud > 0 {
+		args = append(args, strconv.Itoa(baud))
+	}
+	return args
+}
+
+// nmeaParser builds up a position from GGA, RMC, GSA and GSV sentences
+type nmeaParser struct {
+	pos   geospatial.Point
+	fix   Fix
+	epoch bool // The last sentence was a GGA, which starts a new fix
+
+	// Satellites in view of each constellation, e.g. "GP" and "GL"
+	inView map[string]int
+}
+
+// Parse reads a sentence and reports whether it was one that we use
+func (np *nmeaParser) Parse(line string) bool {
+	np.epoch = false
+
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "$") {
+		return false
+	}
+	line = line[1:]
+
+	if i := strings.LastIndex(line, "*"); i >= 0 {
+		sum, err := strconv.ParseUint(line[i+1:], 16, 8)
+		if err != nil || byte(sum) != nmeaChecksum(line[:i]) {
+			return false
+		}
+		line = line[:i]
+	}
+
+	f := strings.Split(line, ",")
+	if len(f[0]) < 5 {
+		return false
+	}
+
+	talker := f[0][:len(f[0])-3]
+
+	switch f[0][len(f[0])-3:] {
+	case "GGA":
+		if len(f) < 10 {
+			return false
+		}
+		np.fix.Quality, _ = strconv.Atoi(f[6])
+		np.fix.Satellites, _ = strconv.Atoi(f[7])
+		np.fix.HDOP, _ = strconv.ParseFloat(f[8], 64)
+		np.epoch = true
+		if np.fix.Quality == 0 {
+			return true
+		}
+		np.fix.Time = time.Now()
+		lat, lok := nmeaCoord(f[2], f[3])
+		lon, nok := nmeaCoord(f[4], f[5])
+		if !lok || !nok {
+			return false
+		}
+		np.pos.Lat, np.pos.Lon = lat, lon
+		if alt, err := strconv.ParseFloat(f[9], 64); err == nil {
+			np.pos.Altitude = alt * metersToFeet
+		}
+		return true
+
+	case "RMC":
+		if len(f) < 9 || f[2] != "A" {
+			return false
+		}
+		if spd, err := strconv.ParseFloat(f[7], 64); err == nil {
+			np.pos.Speed = spd * knotsToMph
+		}
+		if crs, err := strconv.ParseFloat(f[8], 64); err == nil {
+			np.pos.Heading = uint16(crs)
+		}
+		return true
+
+	case "GSA":
+		if len(f) < 3 {
+			return false
+		}
+		np.fix.Mode, _ = strconv.Atoi(f[2])
+		return true
+
+	case "GSV":
+		if len(f) < 4 {
+			return false
+		}
+		n, err := strconv.Atoi(f[3])
+		if err != nil {
+			return false
+		}
+		if np.inView == nil {
+			np.inView = make(map[string]int)
+		}
+		np.inView[talker] = n
+		np.fix.Visible = 0
+		for _, v := range np.inView {
+			np.fix.Visible += v
+		}
+		return true
+	}
+
+	return false
+}
+
+func nmeaChecksum(s string) byte {
+	var sum byte
+	for i := 0; i < len(s); i++ {
+		sum ^= s[i]
+	}
+	return sum
+}
+
+// nmeaCoord converts NMEA's ddmm.mmmm and hemisphere to decimal degrees
+func nmeaCoord(v, hemi string) (float64, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	deg := float64(int(f / 100))
+	deg += (f - deg*100) / 60
+
+	switch hemi {
+	case "N", "E":
+		return deg, true
+	case "S", "W":
+		return -deg, true
+	}
+	return 0, false
+}
+
+//
+// Fixed
+//
+
+// fixedSource is a ground station that doesn't move
+type fixedSource struct {
+	sourceState
+}
+
+func (s *fixedSource) Address() string {
+	return "fixed"
+}
+
+func (s *fixedSource) Start(ctx context.Context) {
+	s.setReady(true)
+}
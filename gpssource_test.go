@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	ggaSample = "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47"
+	gsaSample = "$GPGSA,A,3,04,05,,09,12,,,24,,,,,2.5,1.3,2.1*39"
+	rmcSample = "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A"
+)
+
+func TestNMEAParse(t *testing.T) {
+	tests := []struct {
+		line string
+		ok   bool
+	}{
+		{ggaSample, true},
+		{gsaSample, true},
+		{rmcSample, true},
+		{"$GPGSV,2,1,08,01,40,083,46,02,17,308,41,12,07,344,39,14,22,228,45*75", true},
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*48", false}, // Bad checksum
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*ZZ", false}, // Unreadable checksum
+		{"$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", true},     // No checksum
+		{"$GPGGA,123519,4807.038,X,01131.000,E,1,08,0.9,545.4,M,46.9,M,,", false},    // Bad hemisphere
+		{"$GPRMC,123519,V,,,,,,,230394,,*33", false},                                 // No fix
+		{"$GPVTG,054.7,T,034.4,M,005.5,N,010.2,K*48", false},                         // Not one we use
+		{"GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47", false},  // No $
+		{"$GPGGA,123519", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		var np nmeaParser
+		if ok := np.Parse(tt.line); ok != tt.ok {
+			t.Errorf("Parse(%q) = %v, want %v", tt.line, ok, tt.ok)
+		}
+	}
+}
+
+// A GPS's sentences build up to one position and fix
+func TestNMEAFix(t *testing.T) {
+	var np nmeaParser
+	for _, line := range []string{
+		gsaSample,
+		rmcSample,
+		"$GPGSV,2,1,08,01,40,083,46,02,17,308,41,12,07,344,39,14,22,228,45*75",
+		"$GLGSV,1,1,03,65,20,050,30,66,45,120,35,72,10,300,20*50",
+		ggaSample,
+	} {
+		if !np.Parse(line) {
+			t.Fatalf("Parse(%q) = false", line)
+		}
+	}
+
+	p := np.pos
+	if math.Abs(p.Lat-48.1173) > 1e-4 || math.Abs(p.Lon-11.5167) > 1e-4 {
+		t.Errorf("position = %.4f, %.4f, want 48.1173, 11.5167", p.Lat, p.Lon)
+	}
+	if math.Abs(p.Altitude-545.4*metersToFeet) > 0.1 {
+		t.Errorf("altitude = %v, want %v", p.Altitude, 545.4*metersToFeet)
+	}
+	if math.Abs(p.Speed-22.4*knotsToMph) > 0.1 || p.Heading != 84 {
+		t.Errorf("speed, heading = %v, %v, want %v, 84", p.Speed, p.Heading, 22.4*knotsToMph)
+	}
+
+	f := np.fix
+	if f.Quality != 1 || f.Mode != fixMode3D || f.Satellites != 8 || f.Visible != 11 || f.HDOP != 0.9 {
+		t.Errorf("fix = %+v, want quality 1, mode 3D, 8 of 11 satellites, HDOP 0.9", f)
+	}
+	if !f.HasFix() || !np.epoch {
+		t.Errorf("HasFix() = %v, epoch = %v after a GGA", f.HasFix(), np.epoch)
+	}
+}
+
+func TestNMEASouthernHemisphere(t *testing.T) {
+	var np nmeaParser
+	if !np.Parse("$GPGGA,000000,3351.900,S,15112.600,E,2,10,1.0,-5.0,M,,M,,*67") {
+		t.Fatal("Parse failed")
+	}
+	if math.Abs(np.pos.Lat+33.865) > 1e-6 || math.Abs(np.pos.Lon-151.21) > 1e-6 {
+		t.Errorf("position = %v, %v, want -33.865, 151.21", np.pos.Lat, np.pos.Lon)
+	}
+}
+
+// A GGA without a fix leaves the last position alone
+func TestNMEALostFix(t *testing.T) {
+	var np nmeaParser
+	np.Parse(ggaSample)
+	if !np.Parse("$GPGGA,123520,,,,,0,00,,,M,,M,,*61") {
+		t.Fatal("Parse of a no-fix GGA failed")
+	}
+	if np.fix.HasFix() || np.pos.Lat == 0 {
+		t.Errorf("after losing the fix: fix %+v, position %+v", np.fix, np.pos)
+	}
+}
+
+// read reports how many fixes it got, so that replaying a file with none in
+// it backs off instead of spinning
+func TestNMEAReadFixes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gophertrak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  int
+	}{
+		{"empty", nil, 0},
+		{"garbage", []string{"not NMEA", "$GPGGA,123519*00"}, 0},
+		{"fix", []string{gsaSample, ggaSample, rmcSample}, 2},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name+".nmea")
+		err := ioutil.WriteFile(path, []byte(strings.Join(tt.lines, "\r\n")), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := &nmeaSource{device: path}
+		fixes, err := s.read(context.Background())
+		if fixes != tt.want || err != io.EOF {
+			t.Errorf("%v: read() = %v, %v, want %v, EOF", tt.name, fixes, err, tt.want)
+		}
+	}
+}
+
+func TestSttyArgs(t *testing.T) {
+	tests := []struct {
+		goos string
+		baud int
+		want string
+	}{
+		{"linux", 4800, "-F /dev/ttyUSB1 raw -echo 4800"},
+		{"darwin", 9600, "-f /dev/ttyUSB1 raw -echo 9600"},
+		{"linux", 0, "-F /dev/ttyUSB1 raw -echo"},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(sttyArgs(tt.goos, "/dev/ttyUSB1", tt.baud), " ")
+		if got != tt.want {
+			t.Errorf("sttyArgs(%v, %v) = %q, want %q", tt.goos, tt.baud, got, tt.want)
+		}
+	}
+
+	s, err := newPositionSource(GPSConfig{Source: "nmea", Device: "/dev/ttyUSB1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baud := s.(*nmeaSource).baud; baud != defaultNMEABaud {
+		t.Errorf("nmea source with no baud set runs at %v, want %v", baud, defaultNMEABaud)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/aprs"
+	"github.com/chrissnell/GoBalloon/ax25"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HeardStation is what we know about a station we've heard on RF, whether
+// or not it's one we're concerned with
+type HeardStation struct {
+	Callsign     string
+	Packets      int
+	Direct       int // Packets heard straight from the station
+	Digipeated   int // Packets heard via at least one digipeater
+	FirstHeard   time.Time
+	LastHeard    time.Time
+	LastPath     []ax25.APRSAddress
+	Position     geospatial.Point // Zero if it hasn't sent one
+	PositionTime time.Time
+	SymbolTable  byte
+	SymbolCode   byte
+
+	last *arrivals // Every copy of the last packet, from the dedup filter
+}
+
+// HeardDirect reports whether we heard any copy of the last packet straight
+// from the station
+func (h HeardStation) HeardDirect() bool {
+	return !digipeated(h.LastPath)
+}
+
+type heardList struct {
+	mu       sync.Mutex
+	stations map[string]*HeardStation
+}
+
+// Record notes the first copy of a packet from a station.  ad is nil if the
+// packet couldn't be parsed.  arr is the packet's arrival list from the dedup
+// filter; later copies are folded in with Arrived.
+func (h *heardList) Record(pkt ax25.APRSPacket, ad *aprs.APRSData, arr *arrivals, ts time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.stations == nil {
+		h.stations = make(map[string]*HeardStation)
+	}
+
+	call := pkt.Source.String()
+	st, ok := h.stations[call]
+	if !ok {
+		st = &HeardStation{Callsign: call, FirstHeard: ts}
+		h.stations[call] = st
+	}
+
+	st.Packets++
+	st.LastHeard = ts
+	st.LastPath = pkt.Path
+	st.last = arr
+	if st.HeardDirect() {
+		st.Direct++
+	} else {
+		st.Digipeated++
+	}
+
+	if ad != nil && (ad.Position.Lat != 0 || ad.Position.Lon != 0) {
+		st.Position = ad.Position
+		st.PositionTime = ts
+	}
+
+	if table, code, ok := packetSymbol(infoField(pkt)); ok {
+		st.SymbolTable, st.SymbolCode = table, code
+	}
+}
+
+// Arrived notes another copy of a packet we've already recorded.  If the first
+// copy came through a digipeater but this one came direct, the station was
+// heard direct after all.
+func (h *heardList) Arrived(pkt ax25.APRSPacket, arr *arrivals) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	st, ok := h.stations[pkt.Source.String()]
+	if !ok || st.last != arr {
+		// A copy of an older packet, or one we never recorded
+		return
+	}
+
+	if !st.HeardDirect() && !digipeated(pkt.Path) {
+		st.LastPath = pkt.Path
+		st.Digipeated--
+		st.Direct++
+	}
+}
+
+// Stations returns every station we've heard, most recently heard first
+func (h *heardList) Stations() []HeardStation {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var list []HeardStation
+	for _, st := range h.stations {
+		list = append(list, *st)
+	}
+	sort.Sort(byLastHeard(list))
+	return list
+}
+
+type byLastHeard []HeardStation
+
+func (b byLastHeard) Len() int           { return len(b) }
+func (b byLastHeard) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byLastHeard) Less(i, j int) bool { return b[i].LastHeard.After(b[j].LastHeard) }
+
+// HeardStations returns every station heard on RF, most recently heard first
+func (a *APRSTNC) HeardStations() []HeardStation {
+	return a.heard.Stations()
+}
+
+// Names for the symbols we're most likely to see on a chase.  Digipeaters and
+// iGates are the ones to look out for.
+var symbolNames = map[string]string{
+	"/!":  "police",
+	"/#":  "digi",
+	"\\#": "digi",
+	"/&":  "igate",
+	"\\&": "igate",
+	"/-":  "house",
+	"/>":  "car",
+	"/<":  "motorcycle",
+	"/O":  "balloon",
+	"/[":  "jogger",
+	"/_":  "weather",
+	"\\_": "weather",
+	"/a":  "ambulance",
+	"/b":  "bicycle",
+	"/f":  "fire truck",
+	"/j":  "jeep",
+	"/k":  "truck",
+	"/r":  "repeater",
+	"/s":  "boat",
+	"/u":  "truck",
+	"/v":  "van",
+	"/y":  "yagi",
+	"/'":  "aircraft",
+	"/^":  "aircraft",
+	"/X":  "helicopter",
+}
+
+// symbolName describes a station's symbol, e.g. "/# digi"
+func symbolName(table, code byte) string {
+	if table == 0 {
+		return ""
+	}
+
+	sym := string([]byte{table, code})
+
+	// Overlaid symbols use a letter or digit in place of the alternate table
+	lookup := sym
+	if table != '/' && table != '\\' {
+		lookup = "\\" + string(code)
+	}
+
+	if n, ok := symbolNames[lookup]; ok {
+		return sym + " " + n
+	}
+	return sym
+}
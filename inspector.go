@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chrissnell/GoBalloon/ax25"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Width we wrap long lines to in the packet inspector
+const inspectorWidth = 66
+
+// genericHop reports whether a path hop is a generic alias like WIDE2 rather
+// than a digipeater's own callsign, and the number of hops it asks for
+func genericHop(call string) (int, bool) {
+	for _, g := range []string{"WIDE", "TRACE", "RELAY"} {
+		if strings.HasPrefix(call, g) {
+			n, err := strconv.Atoi(strings.TrimPrefix(call, g))
+			if err != nil {
+				return 0, true
+			}
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// usedHops guesses which hops of a path have been used.  We don't get the
+// AX.25 has-been-repeated bits from the decoder, so we look for the last hop
+// that shows signs of digipeating: a digipeater's own callsign inserted into
+// the path, or a WIDEn-N whose N has been decremented.  Everything before it
+// has been used too.
+func usedHops(path []ax25.APRSAddress) []bool {
+	used := make([]bool, len(path))
+
+	last := -1
+	for i, h := range path {
+		n, generic := genericHop(h.Callsign)
+		if !generic || int(h.SSID) < n {
+			last = i
+		}
+	}
+
+	for i := range path {
+		if i < last {
+			used[i] = true
+		} else if i == last {
+			// A partly-used WIDEn-N still has hops left in it
+			_, generic := genericHop(path[i].Callsign)
+			used[i] = !generic || path[i].SSID == 0
+		}
+	}
+
+	return used
+}
+
+// markedPath writes out a path with used hops marked with a *, as APRS
+// software traditionally does
+func markedPath(path []ax25.APRSAddress) string {
+	if len(path) == 0 {
+		return "(direct)"
+	}
+
+	used := usedHops(path)
+	var hops []string
+	for i := range path {
+		h := path[i].String()
+		if used[i] {
+			h += "*"
+		}
+		hops = append(hops, h)
+	}
+	return strings.Join(hops, ",")
+}
+
+// hexDump formats b 16 bytes to a line, with offsets and printable characters
+func hexDump(b []byte) []string {
+	var lines []string
+	for off := 0; off < len(b); off += 16 {
+		end := off + 16
+		if end > len(b) {
+			end = len(b)
+		}
+
+		var hex, text string
+		for i := off; i < off+16; i++ {
+			if i < end {
+				hex += fmt.Sprintf("%02x ", b[i])
+				if b[i] >= 0x20 && b[i] < 0x7f {
+					text += string(b[i])
+				} else {
+					text += "."
+				}
+			} else {
+				hex += "   "
+			}
+		}
+		lines = append(lines, fmt.Sprintf("%04x  %v %v", off, hex, text))
+	}
+	return lines
+}
+
+func wrapText(s string, width int) []string {
+	var lines []string
+	r := []rune(s)
+	for len(r) > width {
+		lines = append(lines, string(r[:width]))
+		r = r[width:]
+	}
+	return append(lines, string(r))
+}
+
+// packetDetails is what the packet inspector shows for a packet
+func packetDetails(pp PayloadPacket) []string {
+	lines := []string{
+		fmt.Sprintf("RECEIVED: %v (%v ago)", pp.ts.Format("2006-01-02 15:04:05 MST"), shortDuration(time.Since(pp.ts))),
+		fmt.Sprintf("  SOURCE: %v", pp.pkt.Source.String()),
+		fmt.Sprintf("    DEST: %v", pp.pkt.Dest.String()),
+		fmt.Sprintf("    PATH: %v", markedPath(pp.pkt.Path)),
+	}
+	if t := packetType(pp); t != "" {
+		lines = append(lines, fmt.Sprintf("    TYPE: %v", t))
+	}
+
+	// Duplicates of this packet that came by other paths
+	if dups := pp.Arrivals(); len(dups) > 1 {
+		lines = append(lines, "", fmt.Sprintf("HEARD %v TIMES:", len(dups)))
+		for _, ar := range dups {
+			lines = append(lines, fmt.Sprintf("  +%-5v %v", shortDuration(ar.Time.Sub(pp.ts)), markedPath(ar.Path)))
+		}
+	}
+
+	p := pp.data.Position
+	if p.Lat != 0 || p.Lon != 0 {
+		lines = append(lines,
+			"",
+			fmt.Sprintf("POSITION: %v", coordString(p, currentCoordFormat())),
+			fmt.Sprintf("ALTITUDE: %v", units().Altitude.Format(p.Altitude)),
+			fmt.Sprintf("   SPEED: %v", units().Speed.Format(p.Speed)),
+			fmt.Sprintf("  COURSE: %v°", p.Heading),
+		)
+	}
+
+	st := pp.data.StandardTelemetry
+	ct := pp.data.CompressedTelemetry
+	if st.A1 != 0 || st.A2 != 0 || st.A3 != 0 || st.A4 != 0 || st.A5 != 0 {
+		lines = append(lines, "", fmt.Sprintf("TELEMETRY: A1=%v A2=%v A3=%v A4=%v A5=%v", st.A1, st.A2, st.A3, st.A4, st.A5))
+	} else if ct.A1 != 0 || ct.A2 != 0 || ct.A3 != 0 || ct.A4 != 0 || ct.A5 != 0 {
+		lines = append(lines, "", fmt.Sprintf("TELEMETRY: A1=%v A2=%v A3=%v A4=%v A5=%v (compressed)", ct.A1, ct.A2, ct.A3, ct.A4, ct.A5))
+	}
+
+	m := pp.data.Message
+	if m.Recipient.Callsign != "" {
+		lines = append(lines, "", fmt.Sprintf("MESSAGE TO: %v", m.Recipient.String()))
+		if m.ID != "" {
+			lines = append(lines, fmt.Sprintf("        ID: %v", m.ID))
+		}
+		for i, l := range wrapText(m.Text, inspectorWidth-12) {
+			if i == 0 {
+				lines = append(lines, "      TEXT: "+l)
+			} else {
+				lines = append(lines, "            "+l)
+			}
+		}
+	}
+
+	lines = append(lines, "", "BODY:")
+	lines = append(lines, wrapText(pp.pkt.OriginalBody, inspectorWidth)...)
+
+	// The decoder doesn't keep the frame it was given, so this is the
+	// packet re-encoded, minus the flags and FCS
+	frame, err := ax25.EncodeAX25Command(pp.pkt)
+	if err == nil {
+		lines = append(lines, "", fmt.Sprintf("AX.25 FRAME (%v bytes):", len(frame)))
+		lines = append(lines, hexDump(frame)...)
+	}
+
+	lines = append(lines, "", "Use ↑↓ PgUp PgDn to scroll, any other key to close.")
+
+	for i, l := range lines {
+		if utf8.RuneCountInString(l) > inspectorWidth+4 {
+			lines[i] = string([]rune(l)[:inspectorWidth+4])
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"github.com/chrissnell/gophertrak/draw"
+)
+
+const (
+	// Below this many columns we stack the panels instead of placing them side-by-side
+	narrowWidth = 80
+
+	payloadPanelWidth  = 27
+	payloadPanelHeight = 13
+
+	// Rows in the chase panel above the first chaser in the table
+	chaseHeaderRows = 10
+
+	// Columns needed to show MY CHASE VEHICLE's speed and course beside its position
+	chaseWideWidth = 46
+
+	// Digipeaters shown on the payload paths screen
+	digiRows = 10
+)
+
+// screenLayout is where each panel goes on a terminal of a given size
+type screenLayout struct {
+	Width, Height int // Coordinates of the bottom-right cell
+	Narrow        bool
+	Main          draw.Rect // Everything inside the frame, for full-screen views
+	Banner        draw.Rect // The alert banner, in the margin above the panels
+	Payload       draw.Rect
+	Chase         draw.Rect
+	Packets       draw.Rect
+	StatusBar     draw.Rect
+}
+
+// computeLayout places our panels on a terminal whose bottom-right cell is at
+// (xMax, yMax).  Wide terminals get the payload and chase panels side-by-side
+// with the packet table below; narrow ones get everything stacked.
+//
+// The chase panel's first column is reserved for the marker beside our own
+// callsign, so its contents start one column in.
+func computeLayout(xMax, yMax int) screenLayout {
+	l := screenLayout{
+		Width:  xMax,
+		Height: yMax,
+		Narrow: xMax+1 < narrowWidth,
+	}
+
+	// Leave room for the outer frame plus a margin on each side.  The status
+	// bar sits on the frame's bottom edge.
+	inner := draw.Rect{X: 3, Y: 2, W: xMax - 4, H: yMax - 2}
+	if inner.W < 0 {
+		inner.W = 0
+	}
+	if inner.H < 0 {
+		inner.H = 0
+	}
+
+	l.Main = inner
+	l.Banner = draw.Rect{X: 3, Y: 1, W: xMax - 5, H: 1}
+
+	chaseHeight := chaseHeaderRows + len(chasers)
+
+	if l.Narrow {
+		var rest draw.Rect
+		l.Payload, rest = inner.SplitTop(payloadPanelHeight, 1)
+		l.Chase, l.Packets = rest.SplitTop(chaseHeight, 1)
+	} else {
+		topHeight := payloadPanelHeight
+		if chaseHeight > topHeight {
+			topHeight = chaseHeight
+		}
+		top, rest := inner.SplitTop(topHeight, 1)
+		l.Payload, l.Chase = top.SplitLeft(payloadPanelWidth, 1)
+		l.Packets = rest
+	}
+
+	l.StatusBar = draw.Rect{X: 2, Y: yMax, W: xMax - 3, H: 1}
+
+	return l
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// How long we wait for goroutines to finish up when we're shutting down
+const shutdownTimeout = 5 * time.Second
+
+// lifecycle runs our long-lived goroutines and stops them all together when
+// we quit or get SIGINT or SIGTERM
+type lifecycle struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[string]int // Goroutines that haven't returned yet, by name
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &lifecycle{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(sigs)
+		select {
+		case s := <-sigs:
+			log.Printf("Got %v, shutting down", s)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return l
+}
+
+// Go runs f in a goroutine.  f should return soon after its context is done.
+func (l *lifecycle) Go(name string, f func(ctx context.Context)) {
+	l.mu.Lock()
+	l.running[name]++
+	l.mu.Unlock()
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		f(l.ctx)
+
+		l.mu.Lock()
+		l.running[name]--
+		if l.running[name] == 0 {
+			delete(l.running, name)
+		}
+		l.mu.Unlock()
+	}()
+}
+
+// Done is closed once we start shutting down
+func (l *lifecycle) Done() <-chan struct{} {
+	return l.ctx.Done()
+}
+
+// Stop tells every goroutine to finish up
+func (l *lifecycle) Stop() {
+	l.cancel()
+}
+
+// Wait waits up to timeout for the goroutines to return, and logs the ones
+// that didn't
+func (l *lifecycle) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Println("All goroutines stopped")
+		return true
+	case <-time.After(timeout):
+	}
+
+	l.mu.Lock()
+	var names []string
+	for name := range l.running {
+		names = append(names, name)
+	}
+	l.mu.Unlock()
+	sort.Strings(names)
+
+	log.Printf("Gave up waiting after %v for: %v", timeout, names)
+	return false
+}
+
+// sleep waits for d, or until ctx is done.  It returns false if ctx is done,
+// so that loops can use it as their condition.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// closeOnDone closes c when ctx is done, which unblocks anything reading from
+// it.  Call the returned func once c is finished with.
+func closeOnDone(ctx context.Context, c io.Closer) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Close()
+		case <-stop:
+		}
+	}()
+	return func() { close(stop) }
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	feetToMeters       = 0.3048
+	kmlRefreshInterval = 5 // seconds
+)
+
+// mapFeature is a single point of interest that we plot on external maps
+type mapFeature struct {
+	Name  string
+	Kind  string // balloon, chaser, me, landing or waypoint
+	Point geospatial.Point
+	Heard time.Time
+}
+
+// mapFeatures gathers the balloon, chasers, our own position and the predicted
+// landing, if we know them, and our waypoints.
+func (w *webServer) mapFeatures() []mapFeature {
+	var features []mapFeature
+
+	bl := balloonCallsign()
+	if lp, exists := w.a.LastPosition(bl); exists {
+		features = append(features, mapFeature{Name: bl, Kind: "balloon", Point: lp.data.Position, Heard: lp.ts})
+	}
+
+	for _, v := range sortedChaserCallsigns() {
+		if lp, exists := w.a.LastPosition(v); exists {
+			features = append(features, mapFeature{Name: v, Kind: "chaser", Point: lp.data.Position, Heard: lp.ts})
+		}
+	}
+
+	myPos := w.g.Position()
+	if myPos.Lat != 0 && myPos.Lon != 0 {
+		features = append(features, mapFeature{Name: chaserCallsign(), Kind: "me", Point: myPos, Heard: time.Now()})
+	}
+
+	if pred, ok := w.a.PredictedLanding(myPos.Altitude); ok {
+		features = append(features, mapFeature{Name: "Predicted Landing", Kind: "landing", Point: pred.Point, Heard: pred.ETA})
+	}
+
+	for _, wp := range waypoints.List() {
+		features = append(features, mapFeature{Name: wp.Name, Kind: "waypoint", Point: wp.Pos})
+	}
+
+	return features
+}
+
+// balloonTrack returns the balloon's recent positions, oldest first
+func (w *webServer) balloonTrack() []geospatial.Point {
+	var track []geospatial.Point
+
+	recent := w.a.TrackAsSlice()
+	for i := len(recent) - 1; i >= 0; i-- {
+		if recent[i].data.Position.Lat != 0 {
+			track = append(track, recent[i].data.Position)
+		}
+	}
+
+	return track
+}
+
+func (f mapFeature) description() string {
+	switch f.Kind {
+	case "landing":
+		return fmt.Sprintf("ETA %v", f.Heard.Format("15:04:05"))
+	case "waypoint":
+		return "Waypoint"
+	}
+	return fmt.Sprintf("%v, heard %v ago", units().Altitude.Format(f.Point.Altitude), time.Since(f.Heard).Truncate(time.Second))
+}
+
+//
+// KML
+//
+
+type kmlRoot struct {
+	XMLName     xml.Name        `xml:"kml"`
+	Xmlns       string          `xml:"xmlns,attr"`
+	NetworkLink *kmlNetworkLink `xml:"NetworkLink,omitempty"`
+	Document    *kmlDocument    `xml:"Document,omitempty"`
+}
+
+type kmlNetworkLink struct {
+	Name string  `xml:"name"`
+	Link kmlLink `xml:"Link"`
+}
+
+type kmlLink struct {
+	Href            string `xml:"href"`
+	RefreshMode     string `xml:"refreshMode"`
+	RefreshInterval int    `xml:"refreshInterval"`
+}
+
+type kmlDocument struct {
+	Name       string         `xml:"name"`
+	Styles     []kmlStyle     `xml:"Style"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlStyle struct {
+	ID        string       `xml:"id,attr"`
+	IconStyle kmlIconStyle `xml:"IconStyle"`
+	LineStyle kmlLineStyle `xml:"LineStyle"`
+}
+
+type kmlIconStyle struct {
+	Color string  `xml:"color"`
+	Icon  kmlIcon `xml:"Icon"`
+}
+
+type kmlIcon struct {
+	Href string `xml:"href"`
+}
+
+type kmlLineStyle struct {
+	Color string `xml:"color"`
+	Width int    `xml:"width"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	StyleURL    string         `xml:"styleUrl"`
+	Point       *kmlPoint      `xml:"Point,omitempty"`
+	LineString  *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlPoint struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+// KML colors are aabbggrr
+var kmlStyles = []kmlStyle{
+	{ID: "balloon", IconStyle: kmlIconStyle{Color: "ff0000ff", Icon: kmlIcon{Href: "http://maps.google.com/mapfiles/kml/shapes/airports.png"}}, LineStyle: kmlLineStyle{Color: "ff0000ff", Width: 3}},
+	{ID: "chaser", IconStyle: kmlIconStyle{Color: "ffffff00", Icon: kmlIcon{Href: "http://maps.google.com/mapfiles/kml/shapes/cabs.png"}}},
+	{ID: "me", IconStyle: kmlIconStyle{Color: "ff00ffff", Icon: kmlIcon{Href: "http://maps.google.com/mapfiles/kml/shapes/cabs.png"}}},
+	{ID: "landing", IconStyle: kmlIconStyle{Color: "ffff00ff", Icon: kmlIcon{Href: "http://maps.google.com/mapfiles/kml/shapes/target.png"}}},
+	{ID: "waypoint", IconStyle: kmlIconStyle{Color: "ff00ff00", Icon: kmlIcon{Href: "http://maps.google.com/mapfiles/kml/shapes/flag.png"}}},
+}
+
+// kmlAltitudeMode puts points we don't know the altitude of on the ground
+// rather than at sea level, where they'd be hidden under the terrain
+func kmlAltitudeMode(p geospatial.Point) string {
+	if p.Altitude == 0 {
+		return "clampToGround"
+	}
+	return "absolute"
+}
+
+func kmlCoordinates(p geospatial.Point) string {
+	return fmt.Sprintf("%f,%f,%.0f", p.Lon, p.Lat, p.Altitude*feetToMeters)
+}
+
+// liveKMLURL points back at live.kml on this server, passing on the token
+// that the NetworkLink was fetched with
+func liveKMLURL(r *http.Request) string {
+	u := url.URL{Scheme: "http", Host: r.Host, Path: "/live.kml"}
+	if t := r.URL.Query().Get("token"); t != "" {
+		u.RawQuery = url.Values{"token": {t}}.Encode()
+	}
+	return u.String()
+}
+
+// handleNetworkLink serves a KML file that tells the mapping app to keep
+// reloading live.kml from us
+func (w *webServer) handleNetworkLink(rw http.ResponseWriter, r *http.Request) {
+	k := kmlRoot{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		NetworkLink: &kmlNetworkLink{
+			Name: "GopherTrak",
+			Link: kmlLink{
+				Href:            liveKMLURL(r),
+				RefreshMode:     "onInterval",
+				RefreshInterval: kmlRefreshInterval,
+			},
+		},
+	}
+
+	writeKML(rw, k)
+}
+
+func (w *webServer) handleLiveKML(rw http.ResponseWriter, r *http.Request) {
+	doc := &kmlDocument{
+		Name:   "GopherTrak",
+		Styles: kmlStyles,
+	}
+
+	for _, f := range w.mapFeatures() {
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:        f.Name,
+			Description: f.description(),
+			StyleURL:    "#" + f.Kind,
+			Point:       &kmlPoint{AltitudeMode: kmlAltitudeMode(f.Point), Coordinates: kmlCoordinates(f.Point)},
+		})
+	}
+
+	track := w.balloonTrack()
+	if len(track) > 1 {
+		var coords string
+		for _, p := range track {
+			coords += kmlCoordinates(p) + " "
+		}
+		doc.Placemarks = append(doc.Placemarks, kmlPlacemark{
+			Name:       "Balloon Track",
+			StyleURL:   "#balloon",
+			LineString: &kmlLineString{AltitudeMode: "absolute", Coordinates: coords},
+		})
+	}
+
+	writeKML(rw, kmlRoot{Xmlns: "http://www.opengis.net/kml/2.2", Document: doc})
+}
+
+func writeKML(rw http.ResponseWriter, k kmlRoot) {
+	out, err := xml.MarshalIndent(k, "", "  ")
+	if err != nil {
+		log.Printf("Error marshalling KML: %v", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/vnd.google-earth.kml+xml")
+	rw.Write([]byte(xml.Header))
+	rw.Write(out)
+}
+
+//
+// GeoJSON
+//
+
+type geoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+func geoJSONPosition(p geospatial.Point) []float64 {
+	return []float64{p.Lon, p.Lat, p.Altitude * feetToMeters}
+}
+
+func (w *webServer) handleGeoJSON(rw http.ResponseWriter, r *http.Request) {
+	fc := geoJSONFeatureCollection{
+		Type:     "FeatureCollection",
+		Features: []geoJSONFeature{},
+	}
+
+	for _, f := range w.mapFeatures() {
+		props := map[string]interface{}{
+			"name":        f.Name,
+			"kind":        f.Kind,
+			"altitude_ft": f.Point.Altitude,
+			"speed_mph":   f.Point.Speed,
+			"course":      f.Point.Heading,
+		}
+		// Waypoints were never heard, so they have no time
+		if !f.Heard.IsZero() {
+			props["time"] = f.Heard.UTC().Format(time.RFC3339)
+		}
+
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "Point", Coordinates: geoJSONPosition(f.Point)},
+			Properties: props,
+		})
+	}
+
+	track := w.balloonTrack()
+	if len(track) > 1 {
+		var coords [][]float64
+		for _, p := range track {
+			coords = append(coords, geoJSONPosition(p))
+		}
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type:       "Feature",
+			Geometry:   geoJSONGeometry{Type: "LineString", Coordinates: coords},
+			Properties: map[string]interface{}{"name": "Balloon Track", "kind": "track"},
+		})
+	}
+
+	rw.Header().Set("Content-Type", "application/geo+json")
+	rw.Header().Set("Access-Control-Allow-Origin", "*")
+	err := json.NewEncoder(rw).Encode(fc)
+	if err != nil {
+		log.Printf("Error encoding GeoJSON: %v", err)
+	}
+}
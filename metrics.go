@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+var (
+	packetsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gophertrak",
+		Name:      "packets_received_total",
+		Help:      "APRS packets received from the TNC, by source callsign.",
+	}, []string{"callsign"})
+
+	decodeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gophertrak",
+		Name:      "decode_failures_total",
+		Help:      "Frames that could not be decoded, by stage (kiss or aprs).",
+	}, []string{"stage"})
+
+	packetsDuplicate = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gophertrak",
+		Name:      "packets_duplicate_total",
+		Help:      "Extra copies of packets we'd already heard by another path, by source callsign.",
+	}, []string{"callsign"})
+
+	tncReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "gophertrak",
+		Name:      "tnc_reconnects_total",
+		Help:      "Times we've had to reconnect to the TNC.",
+	})
+
+	packetsTransmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "gophertrak",
+		Name:      "packets_transmitted_total",
+		Help:      "APRS packets sent to the TNC, by type.",
+	}, []string{"type"})
+)
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// registerMetrics registers our counters and the gauges that are computed
+// from live tracker state each time /metrics is scraped
+func registerMetrics(a *APRSTNC, g PositionSource) {
+	prometheus.MustRegister(packetsReceived, decodeFailures, packetsDuplicate, tncReconnects, packetsTransmitted)
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gophertrak",
+		Name:      "tnc_connected",
+		Help:      "1 if we're connected to the TNC.",
+	}, func() float64 {
+		return boolToFloat(a.IsConnected())
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gophertrak",
+		Name:      "gps_connected",
+		Help:      "1 if the GPS is ready.",
+	}, func() float64 {
+		return boolToFloat(g.IsReady())
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gophertrak",
+		Name:      "gps_satellites",
+		Help:      "Satellites used in the GPS fix.",
+	}, func() float64 {
+		return float64(g.Fix().Satellites)
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: "gophertrak",
+		Name:      "payload_last_heard_seconds",
+		Help:      "Seconds since we last heard the payload, or -1 if we haven't heard it yet.",
+	}, func() float64 {
+		lp, exists := a.LastPacket(balloonCallsign())
+		if !exists {
+			return -1
+		}
+		return time.Since(lp.ts).Seconds()
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "gophertrak",
+		Name:        "outgoing_queue_depth",
+		Help:        "Packets waiting to be sent to the TNC.",
+		ConstLabels: prometheus.Labels{"queue": "message"},
+	}, func() float64 {
+		return float64(len(a.aprsMessage))
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "gophertrak",
+		Name:        "outgoing_queue_depth",
+		Help:        "Packets waiting to be sent to the TNC.",
+		ConstLabels: prometheus.Labels{"queue": "position"},
+	}, func() float64 {
+		return float64(len(a.aprsPosition))
+	}))
+
+	prometheus.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace:   "gophertrak",
+		Name:        "outgoing_queue_depth",
+		Help:        "Packets waiting to be sent to the TNC.",
+		ConstLabels: prometheus.Labels{"queue": "object"},
+	}, func() float64 {
+		return float64(len(a.aprsObject))
+	}))
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"github.com/chrissnell/gophertrak/draw"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	// Below this speed (mph) our GPS course is meaningless, so we don't say
+	// which way to turn
+	navMinSpeed = 3
+
+	// Within this many degrees of the target's bearing we're heading straight for it
+	navAheadTolerance = 5
+
+	// Miles either side of the course line at the ends of the cross-track bar
+	navCrossTrackScale = 1.0
+	navCrossTrackWidth = 21
+)
+
+// navTarget is something we can navigate to
+type navTarget struct {
+	Name   string
+	Pos    geospatial.Point
+	Moving bool // Pos.Speed and Pos.Heading are the target's own velocity
+}
+
+// navSolution is how to get from where we are to a target
+type navSolution struct {
+	Distance float64 // Miles
+	Bearing  uint16
+
+	// Degrees to turn to head for the target, negative for left.  Only valid
+	// if HasCourse; we need to be moving to know which way we're pointing.
+	Turn      int
+	HasCourse bool
+
+	Closing float64 // mph, negative if we're getting further away
+	ETA     time.Duration
+	HasETA  bool
+
+	// Miles right (positive) or left of the course line from where we were
+	// when we picked the target
+	CrossTrack    float64
+	HasCrossTrack bool
+}
+
+// navTargets are the things we can navigate to right now, in the order the
+// target key cycles through them
+func navTargets(a *APRSTNC, me geospatial.Point) []navTarget {
+	var targets []navTarget
+
+	bl := balloonCallsign()
+	if lp, ok := a.LastPosition(bl); ok {
+		targets = append(targets, navTarget{Name: "PAYLOAD " + bl, Pos: lp.data.Position, Moving: true})
+	}
+
+	if pred, ok := a.PredictedLanding(me.Altitude); ok {
+		targets = append(targets, navTarget{Name: "PREDICTED LANDING", Pos: pred.Point})
+	}
+
+	for _, c := range sortedChaserCallsigns() {
+		if lp, ok := a.LastPosition(c); ok {
+			targets = append(targets, navTarget{Name: "CHASER " + c, Pos: lp.data.Position, Moving: true})
+		}
+	}
+
+	for _, w := range waypoints.List() {
+		targets = append(targets, navTarget{Name: "WAYPOINT " + w.Name, Pos: w.Pos})
+	}
+
+	return targets
+}
+
+// solveNav works out how to get from me to t.  origin is where the course line
+// starts, or the zero Point if there isn't one.
+func solveNav(me geospatial.Point, t navTarget, origin geospatial.Point) navSolution {
+	var s navSolution
+
+	s.Distance = me.GreatCircleDistanceTo(t.Pos)
+	s.Bearing = me.BearingTo(t.Pos)
+
+	if me.Speed >= navMinSpeed {
+		s.HasCourse = true
+		s.Turn = angleDiff(float64(s.Bearing), float64(me.Heading))
+	}
+
+	// The parts of our velocity and the target's along the line between us
+	rad := math.Pi / 180
+	s.Closing = me.Speed * math.Cos(float64(int(me.Heading)-int(s.Bearing))*rad)
+	if t.Moving {
+		s.Closing -= t.Pos.Speed * math.Cos(float64(int(t.Pos.Heading)-int(s.Bearing))*rad)
+	}
+
+	if s.Closing > 0.5 {
+		s.HasETA = true
+		s.ETA = time.Duration(s.Distance / s.Closing * float64(time.Hour))
+	}
+
+	if origin.Lat != 0 || origin.Lon != 0 {
+		d13 := origin.GreatCircleDistanceTo(me) / earthRadiusMiles
+		b13 := float64(origin.BearingTo(me)) * rad
+		b12 := float64(origin.BearingTo(t.Pos)) * rad
+		s.CrossTrack = math.Asin(math.Sin(d13)*math.Sin(b13-b12)) * earthRadiusMiles
+		s.HasCrossTrack = true
+	}
+
+	return s
+}
+
+// angleDiff is to - from in degrees, between -180 and 180
+func angleDiff(to, from float64) int {
+	d := math.Mod(to-from+540, 360) - 180
+	return int(math.Floor(d + 0.5))
+}
+
+// turnString says which way to turn, e.g. "TURN LEFT 40°"
+func turnString(s navSolution) string {
+	switch {
+	case !s.HasCourse:
+		return fmt.Sprintf("HEAD %v°", s.Bearing)
+	case s.Turn >= -navAheadTolerance && s.Turn <= navAheadTolerance:
+		return "STRAIGHT AHEAD"
+	case s.Turn > 170 || s.Turn < -170:
+		return "TURN AROUND"
+	case s.Turn < 0:
+		return fmt.Sprintf("TURN LEFT %d°", -s.Turn)
+	}
+	return fmt.Sprintf("TURN RIGHT %d°", s.Turn)
+}
+
+// crossTrackBar draws where we are relative to the course line, e.g.
+// "·····◆····|··········" when we're off to the left
+func crossTrackBar(xt float64) string {
+	mid := navCrossTrackWidth / 2
+	pos := mid + int(math.Floor(xt/navCrossTrackScale*float64(mid)+0.5))
+	if pos < 0 {
+		pos = 0
+	}
+	if pos >= navCrossTrackWidth {
+		pos = navCrossTrackWidth - 1
+	}
+
+	bar := []rune(strings.Repeat("·", navCrossTrackWidth))
+	bar[mid] = '|'
+	bar[pos] = '◆'
+	return string(bar)
+}
+
+// UpdateNavigation keeps the navigation screen's guidance current
+func (u *trackerUI) UpdateNavigation(ctx context.Context, g PositionSource, a *APRSTNC) {
+	for {
+		u.refreshNavigation(g, a)
+		if !sleep(ctx, 1*time.Second) {
+			return
+		}
+	}
+}
+
+func (u *trackerUI) refreshNavigation(g PositionSource, a *APRSTNC) {
+	me := g.Position()
+	targets := navTargets(a, me)
+
+	u.mu.Lock()
+	u.navTargets = targets
+	t, ok := u.currentNavTarget()
+	if ok && u.navOrigin.Lat == 0 && u.navOrigin.Lon == 0 {
+		u.navOrigin = me
+	}
+	origin := u.navOrigin
+	u.mu.Unlock()
+
+	if !ok {
+		u.navTarget.Set(draw.GreyText, "- NO TARGETS -")
+		return
+	}
+	u.navTarget.SetSpans(
+		draw.Span{Text: "◄ ", Style: draw.CyanText},
+		draw.Span{Text: t.Name, Style: draw.WhiteText},
+		draw.Span{Text: " ►", Style: draw.CyanText},
+	)
+
+	if me.Lat == 0 && me.Lon == 0 {
+		u.navTurn.Set(draw.RedText, "NO GPS POSITION")
+		return
+	}
+
+	// Guidance from a stale fix is worse than none, but we show it grayed out
+	style, turnStyle := draw.WhiteText, draw.YellowTitle
+	if g.Fix().Stale(time.Now()) {
+		style, turnStyle = draw.GreyText, draw.GreyText
+	}
+
+	us := units()
+	s := solveNav(me, t, origin)
+
+	u.navTurn.Set(turnStyle, turnString(s))
+	u.navDistance.Set(style, vectorString(s.Distance, s.Bearing))
+
+	course := "--- (stopped)"
+	if s.HasCourse {
+		course = fmt.Sprintf("%v° at %v", me.Heading, us.Speed.Format(me.Speed))
+	}
+	u.navCourse.Set(style, course)
+
+	closing := us.Speed.Format(math.Abs(s.Closing))
+	if s.Closing < 0 {
+		closing += " (opening)"
+	}
+	u.navClosing.Set(style, closing)
+
+	eta := "--"
+	if s.HasETA {
+		eta = fmt.Sprintf("%v (%v)", shortDuration(s.ETA), time.Now().Add(s.ETA).Format("15:04"))
+	}
+	u.navETA.Set(style, eta)
+
+	if s.HasCrossTrack {
+		side := "RIGHT"
+		if s.CrossTrack < 0 {
+			side = "LEFT"
+		}
+		u.navCrossTrack.SetSpans(
+			draw.Span{Text: crossTrackBar(s.CrossTrack), Style: draw.CyanText},
+			draw.Span{Text: fmt.Sprintf("  %v %v", us.Distance.Format(math.Abs(s.CrossTrack)), side), Style: style},
+		)
+	}
+}
+
+// currentNavTarget finds the chosen target among u.navTargets, falling back to
+// the first.  u.mu must be held.
+func (u *trackerUI) currentNavTarget() (navTarget, bool) {
+	if len(u.navTargets) == 0 {
+		return navTarget{}, false
+	}
+	for _, t := range u.navTargets {
+		if t.Name == u.navTargetName {
+			return t, true
+		}
+	}
+	u.navTargetName = u.navTargets[0].Name
+	u.navOrigin = geospatial.Point{}
+	return u.navTargets[0], true
+}
+
+// cycleNavTarget picks the next (n = 1) or previous (n = -1) target and
+// starts a new course line to it
+func (u *trackerUI) cycleNavTarget(n int) {
+	u.mu.Lock()
+	if len(u.navTargets) > 0 {
+		i := 0
+		for j, t := range u.navTargets {
+			if t.Name == u.navTargetName {
+				i = j
+			}
+		}
+		i = (i + n + len(u.navTargets)) % len(u.navTargets)
+		u.navTargetName = u.navTargets[i].Name
+	}
+	u.navOrigin = geospatial.Point{}
+	u.mu.Unlock()
+}
+
+// resetCourseLine starts the cross-track course line again from where we are
+func (u *trackerUI) resetCourseLine() {
+	u.mu.Lock()
+	u.navOrigin = geospatial.Point{}
+	u.mu.Unlock()
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSolveNav(t *testing.T) {
+	// The target is a tenth of a degree due north, about 6.9 miles
+	target := geospatial.Point{Lat: 47.1, Lon: -122}
+	dist := 0.1 * math.Pi / 180 * earthRadiusMiles
+
+	tests := []struct {
+		name      string
+		me        geospatial.Point
+		t         navTarget
+		turn      int
+		hasCourse bool
+		closing   float64
+		eta       time.Duration // 0 if there shouldn't be one
+	}{
+		{
+			"stopped", geospatial.Point{Lat: 47, Lon: -122},
+			navTarget{Pos: target}, 0, false, 0, 0,
+		},
+		{
+			"creeping along", geospatial.Point{Lat: 47, Lon: -122, Speed: 2, Heading: 0},
+			navTarget{Pos: target}, 0, false, 2, time.Duration(dist / 2 * float64(time.Hour)),
+		},
+		{
+			"heading straight for it", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 0},
+			navTarget{Pos: target}, 0, true, 30, time.Duration(dist / 30 * float64(time.Hour)),
+		},
+		{
+			"heading east", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 90},
+			navTarget{Pos: target}, -90, true, 0, 0,
+		},
+		{
+			"heading northwest", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 315},
+			navTarget{Pos: target}, 45, true, 30 * math.Cos(math.Pi/4), time.Duration(dist / (30 * math.Cos(math.Pi/4)) * float64(time.Hour)),
+		},
+		{
+			"heading away", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 180},
+			navTarget{Pos: target}, -180, true, -30, 0,
+		},
+		{
+			"chasing a moving target", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 0},
+			navTarget{Pos: geospatial.Point{Lat: 47.1, Lon: -122, Speed: 20, Heading: 0}, Moving: true},
+			0, true, 10, time.Duration(dist / 10 * float64(time.Hour)),
+		},
+		{
+			"target coming towards us", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 0},
+			navTarget{Pos: geospatial.Point{Lat: 47.1, Lon: -122, Speed: 20, Heading: 180}, Moving: true},
+			0, true, 50, time.Duration(dist / 50 * float64(time.Hour)),
+		},
+		{
+			// A waypoint's speed and heading don't count
+			"target that doesn't move", geospatial.Point{Lat: 47, Lon: -122, Speed: 30, Heading: 0},
+			navTarget{Pos: geospatial.Point{Lat: 47.1, Lon: -122, Speed: 20, Heading: 0}},
+			0, true, 30, time.Duration(dist / 30 * float64(time.Hour)),
+		},
+	}
+
+	for _, tt := range tests {
+		s := solveNav(tt.me, tt.t, geospatial.Point{})
+		if math.Abs(s.Distance-dist) > 0.01 || s.Bearing != 0 {
+			t.Errorf("%v: %.3f mi at %v°, want %.3f mi at 0°", tt.name, s.Distance, s.Bearing, dist)
+		}
+		if s.Turn != tt.turn || s.HasCourse != tt.hasCourse {
+			t.Errorf("%v: turn %v (%v), want %v (%v)", tt.name, s.Turn, s.HasCourse, tt.turn, tt.hasCourse)
+		}
+		if math.Abs(s.Closing-tt.closing) > 0.01 {
+			t.Errorf("%v: closing at %.2f mph, want %.2f", tt.name, s.Closing, tt.closing)
+		}
+		if s.HasETA != (tt.eta != 0) || (s.ETA-tt.eta).Seconds() > 1 || (tt.eta-s.ETA).Seconds() > 1 {
+			t.Errorf("%v: ETA %v (%v), want %v", tt.name, s.ETA, s.HasETA, tt.eta)
+		}
+		if s.HasCrossTrack {
+			t.Errorf("%v: cross-track without a course line", tt.name)
+		}
+	}
+}
+
+func TestSolveNavCrossTrack(t *testing.T) {
+	origin := geospatial.Point{Lat: 47, Lon: -122}
+	target := navTarget{Pos: geospatial.Point{Lat: 47.1, Lon: -122}}
+
+	// A hundredth of a degree of longitude here is about 0.47 miles.  Bearings
+	// are whole degrees, so the off-course points are due east and west of
+	// the origin where there's no rounding.
+	off := 0.01 * math.Pi / 180 * earthRadiusMiles * math.Cos(47*math.Pi/180)
+
+	tests := []struct {
+		name string
+		me   geospatial.Point
+		want float64
+	}{
+		{"on the line", geospatial.Point{Lat: 47.05, Lon: -122}, 0},
+		{"right of the line", geospatial.Point{Lat: 47, Lon: -121.99}, off},
+		{"left of the line", geospatial.Point{Lat: 47, Lon: -122.01}, -off},
+	}
+
+	for _, tt := range tests {
+		s := solveNav(tt.me, target, origin)
+		if !s.HasCrossTrack || math.Abs(s.CrossTrack-tt.want) > 0.01 {
+			t.Errorf("%v: cross-track %.3f mi (%v), want %.3f", tt.name, s.CrossTrack, s.HasCrossTrack, tt.want)
+		}
+	}
+}
+
+func TestAngleDiff(t *testing.T) {
+	tests := []struct {
+		to, from float64
+		want     int
+	}{
+		{90, 0, 90},
+		{0, 90, -90},
+		{10, 350, 20},
+		{350, 10, -20},
+		{180, 0, -180},
+		{0, 180, -180},
+		{359.6, 0, 0},
+		{45, 45, 0},
+	}
+
+	for _, tt := range tests {
+		if got := angleDiff(tt.to, tt.from); got != tt.want {
+			t.Errorf("angleDiff(%v, %v) = %v, want %v", tt.to, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestTurnString(t *testing.T) {
+	tests := []struct {
+		s    navSolution
+		want string
+	}{
+		{navSolution{Bearing: 123}, "HEAD 123°"},
+		{navSolution{HasCourse: true, Turn: 0}, "STRAIGHT AHEAD"},
+		{navSolution{HasCourse: true, Turn: -5}, "STRAIGHT AHEAD"},
+		{navSolution{HasCourse: true, Turn: 6}, "TURN RIGHT 6°"},
+		{navSolution{HasCourse: true, Turn: -40}, "TURN LEFT 40°"},
+		{navSolution{HasCourse: true, Turn: 170}, "TURN RIGHT 170°"},
+		{navSolution{HasCourse: true, Turn: 171}, "TURN AROUND"},
+		{navSolution{HasCourse: true, Turn: -180}, "TURN AROUND"},
+	}
+
+	for _, tt := range tests {
+		if got := turnString(tt.s); got != tt.want {
+			t.Errorf("turnString(%+v) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestCrossTrackBar(t *testing.T) {
+	// bar is what the bar should look like, with the marker at i
+	bar := func(i int) string {
+		b := []rune(strings.Repeat("·", navCrossTrackWidth))
+		b[navCrossTrackWidth/2] = '|'
+		b[i] = '◆'
+		return string(b)
+	}
+
+	tests := []struct {
+		xt   float64
+		want string
+	}{
+		{0, bar(10)},
+		{0.04, bar(10)},
+		{0.1, bar(11)},
+		{-0.5, bar(5)},
+		{1, bar(20)},
+		{-1, bar(0)},
+		{5, bar(20)},
+		{-5, bar(0)},
+	}
+
+	for _, tt := range tests {
+		if got := crossTrackBar(tt.xt); got != tt.want {
+			t.Errorf("crossTrackBar(%v) = %q, want %q", tt.xt, got, tt.want)
+		}
+	}
+
+	if n := len([]rune(crossTrackBar(0))); n != navCrossTrackWidth {
+		t.Errorf("bar is %v wide, want %v", n, navCrossTrackWidth)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"math"
+	"time"
+)
+
+// APRSObject is a position we report on behalf of something that isn't a
+// station, like a waypoint or the predicted landing
+type APRSObject struct {
+	Name        string // Up to nine characters
+	Pos         geospatial.Point
+	SymbolTable rune
+	SymbolCode  rune
+	Comment     string
+	Killed      bool // Tells other stations to stop showing the object
+}
+
+// Encode builds the object report's information field, e.g.
+// ;LANDING  *092345z4903.50N/07201.75WX/A=001234 comment
+func (o APRSObject) Encode(ts time.Time) string {
+	state := '*'
+	if o.Killed {
+		state = '_'
+	}
+
+	body := fmt.Sprintf(";%-9.9s%c%vz%v%c%v%c", o.Name, state, ts.UTC().Format("021504"),
+		aprsLat(o.Pos.Lat), o.SymbolTable, aprsLon(o.Pos.Lon), o.SymbolCode)
+
+	if o.Pos.Altitude != 0 {
+		body += fmt.Sprintf("/A=%06d", int(o.Pos.Altitude))
+	}
+	if o.Comment != "" {
+		body += " " + o.Comment
+	}
+	return body
+}
+
+// aprsLat formats a latitude as APRS's DDMM.hhN
+func aprsLat(lat float64) string {
+	hm := int(math.Abs(lat)*6000 + 0.5)
+	return fmt.Sprintf("%02d%05.2f%c", hm/6000, float64(hm%6000)/100, hemisphere(lat, 'N', 'S'))
+}
+
+// aprsLon formats a longitude as APRS's DDDMM.hhW
+func aprsLon(lon float64) string {
+	hm := int(math.Abs(lon)*6000 + 0.5)
+	return fmt.Sprintf("%03d%05.2f%c", hm/6000, float64(hm%6000)/100, hemisphere(lon, 'E', 'W'))
+}
+
+// SendObject queues an object report
+func (a *APRSTNC) SendObject(o APRSObject) error {
+	if o.Pos.Lat == 0 && o.Pos.Lon == 0 {
+		return fmt.Errorf("object %v has no position", o.Name)
+	}
+
+	select {
+	case a.aprsObject <- o:
+		return nil
+	default:
+		return fmt.Errorf("outgoing object queue is full or the TNC is not ready")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/ax25"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"testing"
+	"time"
+)
+
+// Object timestamps are day, hour and minute, so 092345z is the 9th at 23:45
+func TestObjectEncode(t *testing.T) {
+	ts := time.Date(2014, 6, 9, 23, 45, 0, 0, time.UTC)
+	landing := geospatial.Point{Lat: 49.058333, Lon: -72.029167, Altitude: 1234}
+
+	tests := []struct {
+		name string
+		o    APRSObject
+		want string
+	}{
+		{
+			"landing", APRSObject{Name: "LANDING", Pos: landing, SymbolTable: '/', SymbolCode: 'X'},
+			";LANDING  *092345z4903.50N/07201.75WX/A=001234",
+		},
+		{
+			"killed", APRSObject{Name: "LANDING", Pos: landing, SymbolTable: '/', SymbolCode: 'X', Killed: true},
+			";LANDING  _092345z4903.50N/07201.75WX/A=001234",
+		},
+		{
+			"comment, no altitude", APRSObject{Name: "GATE", Pos: geospatial.Point{Lat: 47.64, Lon: -122.3}, SymbolTable: '\\', SymbolCode: 'L', Comment: "Locked after 6pm"},
+			";GATE     *092345z4738.40N\\12218.00WL Locked after 6pm",
+		},
+		{
+			"long name", APRSObject{Name: "TRAILHEAD-2", Pos: geospatial.Point{Lat: 47.64, Lon: -122.3}, SymbolTable: '/', SymbolCode: ';'},
+			";TRAILHEAD*092345z4738.40N/12218.00W;",
+		},
+		{
+			"southern and eastern hemispheres", APRSObject{Name: "SYDNEY", Pos: geospatial.Point{Lat: -33.865, Lon: 151.21}, SymbolTable: '/', SymbolCode: '/'},
+			";SYDNEY   *092345z3351.90S/15112.60E/",
+		},
+		{
+			"minutes round up", APRSObject{Name: "ROUND", Pos: geospatial.Point{Lat: 47.99999, Lon: -8.99999}, SymbolTable: '/', SymbolCode: '/'},
+			";ROUND    *092345z4800.00N/00900.00W/",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.o.Encode(ts); got != tt.want {
+			t.Errorf("%v: Encode() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// The timestamp is always in UTC
+	local := ts.In(time.FixedZone("PDT", -7*60*60))
+	if got := tests[0].o.Encode(local); got != tests[0].want {
+		t.Errorf("Encode() in PDT = %q, want %q", got, tests[0].want)
+	}
+}
+
+func TestLandingObject(t *testing.T) {
+	setupFlight(t)
+	eta := time.Date(2014, 6, 1, 11, 5, 0, 0, time.UTC)
+	o := landingObject(LandingPrediction{Point: geospatial.Point{Lat: 47.64, Lon: -122.3}, ETA: eta})
+
+	want := ";N0CALL-LZ*092345z4738.40N/12218.00W/ Predicted landing of N0CALL-11, ETA 11:05z"
+	if got := o.Encode(time.Date(2014, 6, 9, 23, 45, 0, 0, time.UTC)); got != want {
+		t.Errorf("landing object = %q, want %q", got, want)
+	}
+
+	// An SSID given with the callsign doesn't end up in the name
+	ballooncall, balloonssid = strPtr("NW5W-11"), strPtr("")
+	if o := landingObject(LandingPrediction{}); o.Name != "NW5W-LZ" {
+		t.Errorf("landing object for NW5W-11 is named %q, want %q", o.Name, "NW5W-LZ")
+	}
+}
+
+// Everything we transmit, objects included, comes from our own callsign
+func TestOutgoingPacket(t *testing.T) {
+	setupFlight(t)
+
+	pkt, err := outgoingPacket(";LANDING  *092345z4903.50N/07201.75WX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ax25.APRSAddress{Callsign: "N0CALL", SSID: 9}); pkt.Source != want {
+		t.Errorf("source = %+v, want %+v", pkt.Source, want)
+	}
+	if pkt.Dest.Callsign != "APZ001" || len(pkt.Path) != 2 {
+		t.Errorf("dest %+v, path %+v, want APZ001 via WIDE1-1,WIDE2-1", pkt.Dest, pkt.Path)
+	}
+
+	chasercall = strPtr("TOOLONGCALL")
+	if _, err := outgoingPacket(">status"); err == nil {
+		t.Error("packet built from an invalid callsign")
+	}
+}
+
+// Without an SSID we send from the bare callsign rather than "N0CALL-"
+func TestOutgoingPacketNoSSID(t *testing.T) {
+	setupFlight(t)
+	chaserssid = strPtr("")
+
+	if got := chaserCallsign(); got != "N0CALL" {
+		t.Errorf("chaserCallsign() = %q, want %q", got, "N0CALL")
+	}
+	if chaserssid = strPtr("0"); chaserCallsign() != "N0CALL" {
+		t.Errorf("chaserCallsign() with SSID 0 = %q, want %q", chaserCallsign(), "N0CALL")
+	}
+	pkt, err := outgoingPacket(">status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ax25.APRSAddress{Callsign: "N0CALL"}); pkt.Source != want {
+		t.Errorf("source = %+v, want %+v", pkt.Source, want)
+	}
+}
+
+func TestCheckCallsigns(t *testing.T) {
+	tests := []struct {
+		call, ssid string
+		ok         bool
+	}{
+		{"N0CALL", "9", true},
+		{"N0CALL", "", true},
+		{"N0CALL", "0", true},
+		{"n0call", "9", true},
+		{"", "", false},
+		{"TOOLONGCALL", "9", false},
+		{"N0CALL", "16", false},
+		{"N0CALL", "x", false},
+	}
+
+	for _, tt := range tests {
+		setupFlight(t)
+		chasercall, chaserssid = strPtr(tt.call), strPtr(tt.ssid)
+		if err := checkCallsigns(); (err == nil) != tt.ok {
+			t.Errorf("checkCallsigns() with %q-%q = %v, want ok %v", tt.call, tt.ssid, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/ax25"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigiStats is how much a digipeater has relayed the payload
+type DigiStats struct {
+	Callsign   string
+	Packets    int // Balloon packets it relayed
+	LastHop    int // Times it was the last hop, i.e. the one we heard
+	FirstHeard time.Time
+	LastHeard  time.Time
+}
+
+// pathAnalysis keeps track of how the balloon's packets reach us
+type pathAnalysis struct {
+	mu         sync.Mutex
+	direct     int
+	digipeated int
+	digis      map[string]*DigiStats
+}
+
+// relayedBy returns the digipeaters that have relayed a packet, in order.  Hops
+// used by digis that didn't insert their own callsign can't be attributed to
+// anyone, so they're left out.
+func relayedBy(path []ax25.APRSAddress) []string {
+	var digis []string
+	for i, used := range usedHops(path) {
+		if !used {
+			continue
+		}
+		if _, generic := genericHop(path[i].Callsign); generic {
+			continue
+		}
+		digis = append(digis, path[i].String())
+	}
+	return digis
+}
+
+// digipeated reports whether a packet was relayed by at least one digipeater
+// before we heard it
+func digipeated(path []ax25.APRSAddress) bool {
+	for _, u := range usedHops(path) {
+		if u {
+			return true
+		}
+	}
+	return false
+}
+
+// Record notes the path of a copy of a packet from the balloon, arr being
+// every copy we've heard of it so far, and writes it to the flight log.  Each
+// packet counts once as direct or digipeated, by the path of its first copy.
+// Every digipeater that relayed any copy is credited with the packet once.
+func (pa *pathAnalysis) Record(pkt ax25.APRSPacket, arr *arrivals, ts time.Time) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	if pa.digis == nil {
+		pa.digis = make(map[string]*DigiStats)
+	}
+
+	// What the copies before this one have already been credited with
+	relayed := make(map[string]bool)
+	lastHop := make(map[string]bool)
+	all := arr.All()
+	if len(all) > 0 {
+		all = all[:len(all)-1]
+	}
+	for _, earlier := range all {
+		digis := relayedBy(earlier.Path)
+		for _, call := range digis {
+			relayed[call] = true
+		}
+		if len(digis) > 0 {
+			lastHop[digis[len(digis)-1]] = true
+		}
+	}
+	first := len(all) == 0
+
+	digis := relayedBy(pkt.Path)
+
+	heard := "heard"
+	if !first {
+		heard = "copy heard"
+	}
+	if digipeated(pkt.Path) {
+		if first {
+			pa.digipeated++
+		}
+		log.Printf("PATH: %v %v via %v, path %v", pkt.Source.String(), heard, strings.Join(digis, ","), markedPath(pkt.Path))
+	} else {
+		if first {
+			pa.direct++
+		}
+		log.Printf("PATH: %v %v direct, path %v", pkt.Source.String(), heard, markedPath(pkt.Path))
+	}
+
+	for i, call := range digis {
+		st, ok := pa.digis[call]
+		if !ok {
+			st = &DigiStats{Callsign: call, FirstHeard: ts}
+			pa.digis[call] = st
+			log.Printf("PATH: %v relayed the payload for the first time", call)
+		}
+		st.LastHeard = ts
+		if !relayed[call] {
+			st.Packets++
+		}
+		if i == len(digis)-1 && !lastHop[call] {
+			st.LastHop++
+		}
+	}
+}
+
+// Summary returns the number of balloon packets heard direct and digipeated,
+// and every digipeater that's relayed them, busiest first
+func (pa *pathAnalysis) Summary() (int, int, []DigiStats) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	var digis []DigiStats
+	for _, st := range pa.digis {
+		digis = append(digis, *st)
+	}
+	sort.Sort(byPackets(digis))
+	return pa.direct, pa.digipeated, digis
+}
+
+// LogSummary writes the path summary to the flight log
+func (pa *pathAnalysis) LogSummary() {
+	direct, relayed, digis := pa.Summary()
+	log.Printf("PATH SUMMARY: %v balloon packets heard direct, %v digipeated", direct, relayed)
+	for _, d := range digis {
+		log.Printf("PATH SUMMARY: %v relayed %v packets (last hop for %v) between %v and %v",
+			d.Callsign, d.Packets, d.LastHop, d.FirstHeard.Format("15:04:05"), d.LastHeard.Format("15:04:05"))
+	}
+}
+
+type byPackets []DigiStats
+
+func (b byPackets) Len() int      { return len(b) }
+func (b byPackets) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byPackets) Less(i, j int) bool {
+	if b[i].Packets != b[j].Packets {
+		return b[i].Packets > b[j].Packets
+	}
+	return b[i].Callsign < b[j].Callsign
+}
+
+// PathSummary returns the digipeater analysis of the balloon's packets
+func (a *APRSTNC) PathSummary() (int, int, []DigiStats) {
+	return a.paths.Summary()
+}
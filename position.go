@@ -0,0 +1,307 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/aprs"
+	"github.com/chrissnell/GoBalloon/ax25"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Our own position decoding.  The APRS library doesn't handle every format
+// the chase vehicles' radios send, so we decode the position formats
+// ourselves and fill in whatever the library missed.  Positions are
+// normalized to degrees, feet, mph and degrees true.
+
+const (
+	knotsToMph   = 1.15078
+	metersToFeet = 3.28084
+)
+
+var (
+	altitudeComment = regexp.MustCompile(`/A=(-?\d{5,6})`)
+	courseSpeed     = regexp.MustCompile(`^(\d{3})/(\d{3})`)
+)
+
+// normalizePosition decodes the packet's position, if it has one, and fills
+// in any parts of it the APRS library didn't.  It returns ad, or a new
+// APRSData if the library couldn't parse the packet but we found a position.
+func normalizePosition(pkt ax25.APRSPacket, ad *aprs.APRSData) *aprs.APRSData {
+	p, ok := decodePosition(pkt.Dest.Callsign, infoField(pkt))
+	if !ok {
+		return ad
+	}
+
+	if ad == nil {
+		return &aprs.APRSData{Position: p}
+	}
+
+	if ad.Position.Lat == 0 && ad.Position.Lon == 0 {
+		ad.Position.Lat, ad.Position.Lon = p.Lat, p.Lon
+	}
+	if ad.Position.Altitude == 0 {
+		ad.Position.Altitude = p.Altitude
+	}
+	if ad.Position.Speed == 0 && ad.Position.Heading == 0 {
+		ad.Position.Speed, ad.Position.Heading = p.Speed, p.Heading
+	}
+	return ad
+}
+
+// decodePosition decodes the position in a packet's information field.  dest
+// is the destination callsign, which is where Mic-E keeps the latitude.
+func decodePosition(dest, body string) (geospatial.Point, bool) {
+	if body == "" {
+		return geospatial.Point{}, false
+	}
+
+	var p string
+	switch body[0] {
+	case '!', '=':
+		p = body[1:]
+	case '/', '@':
+		if len(body) < 8 {
+			return geospatial.Point{}, false
+		}
+		p = body[8:]
+	case ';':
+		if len(body) < 18 {
+			return geospatial.Point{}, false
+		}
+		p = body[18:]
+	case ')':
+		i := strings.IndexAny(body, "!_")
+		if i < 0 {
+			return geospatial.Point{}, false
+		}
+		p = body[i+1:]
+	case '`', '\'', 0x1c, 0x1d:
+		return decodeMicE(dest, body)
+	default:
+		return geospatial.Point{}, false
+	}
+
+	if p == "" {
+		return geospatial.Point{}, false
+	}
+	if p[0] >= '0' && p[0] <= '9' || p[0] == ' ' {
+		return decodeUncompressed(p)
+	}
+	return decodeCompressed(p)
+}
+
+// decodeUncompressed decodes e.g. "4903.50N/07201.75W>088/036/A=001234"
+func decodeUncompressed(p string) (geospatial.Point, bool) {
+	var pt geospatial.Point
+
+	if len(p) < 19 {
+		return pt, false
+	}
+
+	lat, ok := parseDegMin(p[0:7], 2)
+	if !ok {
+		return pt, false
+	}
+	switch p[7] {
+	case 'N':
+	case 'S':
+		lat = -lat
+	default:
+		return pt, false
+	}
+
+	lon, ok := parseDegMin(p[9:17], 3)
+	if !ok {
+		return pt, false
+	}
+	switch p[17] {
+	case 'E':
+	case 'W':
+		lon = -lon
+	default:
+		return pt, false
+	}
+
+	pt.Lat, pt.Lon = lat, lon
+
+	comment := p[19:]
+	if m := courseSpeed.FindStringSubmatch(comment); m != nil {
+		crs, _ := strconv.Atoi(m[1])
+		spd, _ := strconv.Atoi(m[2])
+		if crs <= 360 {
+			pt.Heading = uint16(crs % 360)
+			pt.Speed = float64(spd) * knotsToMph
+		}
+	}
+	pt.Altitude = commentAltitude(comment)
+
+	return pt, true
+}
+
+// parseDegMin parses degrees and decimal minutes, e.g. "4903.50" with two
+// degree digits.  Spaces from position ambiguity count as zeroes.
+func parseDegMin(s string, degDigits int) (float64, bool) {
+	s = strings.Replace(s, " ", "0", -1)
+	deg, err := strconv.Atoi(s[:degDigits])
+	if err != nil {
+		return 0, false
+	}
+	min, err := strconv.ParseFloat(s[degDigits:], 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(deg) + min/60, true
+}
+
+func commentAltitude(comment string) float64 {
+	m := altitudeComment.FindStringSubmatch(comment)
+	if m == nil {
+		return 0
+	}
+	alt, _ := strconv.Atoi(m[1])
+	return float64(alt)
+}
+
+func base91(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		n = n*91 + int(s[i]) - 33
+	}
+	return n
+}
+
+// decodeCompressed decodes e.g. "/5L!!<*e7>7P[", the symbol table, four
+// characters each of latitude and longitude, the symbol code, then either
+// course and speed or altitude
+func decodeCompressed(p string) (geospatial.Point, bool) {
+	var pt geospatial.Point
+
+	if len(p) < 13 {
+		return pt, false
+	}
+	for i := 1; i < 9; i++ {
+		if p[i] < 33 || p[i] > 123 {
+			return pt, false
+		}
+	}
+
+	pt.Lat = 90 - float64(base91(p[1:5]))/380926
+	pt.Lon = -180 + float64(base91(p[5:9]))/190463
+
+	c, s, t := p[10], p[11], p[12]
+	switch {
+	case c == ' ':
+		// No course, speed or altitude
+	case (t-33)&0x18 == 0x10:
+		// The cs bytes are altitude, from a GGA sentence
+		pt.Altitude = math.Pow(1.002, float64(base91(string([]byte{c, s}))))
+	case c >= '!' && c <= 'z':
+		pt.Heading = uint16(((int(c) - 33) * 4) % 360)
+		pt.Speed = (math.Pow(1.08, float64(int(s)-33)) - 1) * knotsToMph
+	}
+
+	if alt := commentAltitude(p[13:]); alt != 0 {
+		pt.Altitude = alt
+	}
+
+	return pt, true
+}
+
+// micEDigit decodes one character of a Mic-E destination address.  It
+// returns the digit and whether the character is one of the "custom" or
+// upper-case forms, which also carry the N/S, E/W and longitude offset bits.
+func micEDigit(c byte) (byte, bool, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c, false, true
+	case c >= 'A' && c <= 'J':
+		return c - 'A' + '0', true, true
+	case c >= 'P' && c <= 'Y':
+		return c - 'P' + '0', true, true
+	case c == 'K', c == 'L', c == 'Z':
+		// Ambiguity: the digit is left out
+		return '0', c != 'L', true
+	}
+	return 0, false, false
+}
+
+// decodeMicE decodes a Mic-E position.  The latitude and a few flag bits are
+// in the destination address; longitude, speed and course are packed into the
+// first bytes of the body, and altitude may follow in the comment.
+func decodeMicE(dest, body string) (geospatial.Point, bool) {
+	var pt geospatial.Point
+
+	if len(dest) < 6 || len(body) < 9 {
+		return pt, false
+	}
+
+	var digits [6]byte
+	var flags [6]bool
+	for i := 0; i < 6; i++ {
+		d, f, ok := micEDigit(dest[i])
+		if !ok {
+			return pt, false
+		}
+		digits[i], flags[i] = d, f
+	}
+
+	lat, ok := parseDegMin(string(digits[0:4])+"."+string(digits[4:6]), 2)
+	if !ok {
+		return pt, false
+	}
+	if !flags[3] {
+		lat = -lat
+	}
+
+	deg := int(body[1]) - 28
+	if flags[4] {
+		deg += 100
+	}
+	if deg >= 180 && deg <= 189 {
+		deg -= 80
+	} else if deg >= 190 && deg <= 199 {
+		deg -= 190
+	}
+	min := int(body[2]) - 28
+	if min >= 60 {
+		min -= 60
+	}
+	hun := int(body[3]) - 28
+	lon := float64(deg) + (float64(min)+float64(hun)/100)/60
+	if flags[5] {
+		lon = -lon
+	}
+
+	pt.Lat, pt.Lon = lat, lon
+
+	sp := int(body[4]) - 28
+	dc := int(body[5]) - 28
+	se := int(body[6]) - 28
+	speed := sp*10 + dc/10
+	if speed >= 800 {
+		speed -= 800
+	}
+	course := (dc%10)*100 + se
+	if course >= 400 {
+		course -= 400
+	}
+	pt.Speed = float64(speed) * knotsToMph
+	if course > 0 && course <= 360 {
+		pt.Heading = uint16(course % 360)
+	}
+
+	// Altitude is three base-91 characters of meters above -10km followed by
+	// a }, possibly after a byte that identifies the radio
+	rest := body[9:]
+	for _, off := range []int{0, 1} {
+		if len(rest) >= off+4 && rest[off+3] == '}' {
+			pt.Altitude = float64(base91(rest[off:off+3])-10000) * metersToFeet
+			return pt, true
+		}
+	}
+	pt.Altitude = commentAltitude(rest)
+
+	return pt, true
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/aprs"
+	"github.com/chrissnell/GoBalloon/ax25"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"math"
+	"testing"
+)
+
+// samePoint compares positions to about a foot, and speeds and altitudes to
+// a tenth
+func samePoint(a, b geospatial.Point) bool {
+	return math.Abs(a.Lat-b.Lat) < 1e-5 && math.Abs(a.Lon-b.Lon) < 1e-5 &&
+		math.Abs(a.Altitude-b.Altitude) < 0.1 && math.Abs(a.Speed-b.Speed) < 0.1 &&
+		a.Heading == b.Heading
+}
+
+func TestDecodePosition(t *testing.T) {
+	tests := []struct {
+		name string
+		dest string
+		body string
+		want geospatial.Point
+		ok   bool
+	}{
+		{
+			"uncompressed, no timestamp", "APRS", "!4903.50N/07201.75W-Test 001234",
+			geospatial.Point{Lat: 49.058333, Lon: -72.029167}, true,
+		},
+		{
+			"uncompressed with course, speed and altitude", "APRS", "@092345z4903.50N/07201.75W>088/036/A=001234",
+			geospatial.Point{Lat: 49.058333, Lon: -72.029167, Altitude: 1234, Speed: 36 * knotsToMph, Heading: 88}, true,
+		},
+		{
+			"balloon beacon", "APRS", "/092345h4738.40N/12218.00WO/A=031400 3.7V",
+			geospatial.Point{Lat: 47.64, Lon: -122.3, Altitude: 31400}, true,
+		},
+		{
+			"southern and eastern hemispheres", "APRS", "=3351.90S\\15112.60E&/A=-00012",
+			geospatial.Point{Lat: -33.865, Lon: 151.21, Altitude: -12}, true,
+		},
+		{
+			"ambiguous", "APRS", "!49  .  N/072  .  W-",
+			geospatial.Point{Lat: 49, Lon: -72}, true,
+		},
+		{
+			"object", "APRS", ";LEADER   *092345z4903.50N/07201.75W>088/036",
+			geospatial.Point{Lat: 49.058333, Lon: -72.029167, Speed: 36 * knotsToMph, Heading: 88}, true,
+		},
+		{
+			"item", "APRS", ")AID #2!4903.50N/07201.75WA",
+			geospatial.Point{Lat: 49.058333, Lon: -72.029167}, true,
+		},
+		{
+			"compressed with course and speed", "APRS", "!/5L!!<*e7>7P[",
+			geospatial.Point{Lat: 49.5, Lon: -72.75, Speed: 36.2 * knotsToMph, Heading: 88}, true,
+		},
+		{
+			"compressed with altitude", "APRS", "!/5L!!<*e7OS]S",
+			geospatial.Point{Lat: 49.5, Lon: -72.75, Altitude: math.Pow(1.002, 50*91+60)}, true,
+		},
+		{
+			"compressed with /A= in the comment", "APRS", "=/5L!!<*e7O   /A=012345",
+			geospatial.Point{Lat: 49.5, Lon: -72.75, Altitude: 12345}, true,
+		},
+		{
+			// Kenwood TM-D700: 33 25.64N 112 07.74W, 20 knots at 251,
+			// 61m up
+			"Kenwood Mic-E", "S32UVT", "`(_fn\"Oj/]\"4T}=",
+			geospatial.Point{Lat: 33.427333, Lon: -112.129, Altitude: 61 * metersToFeet, Speed: 20 * knotsToMph, Heading: 251}, true,
+		},
+		{
+			"Yaesu Mic-E", "S32UVT", "`(_fn\"Oj/`\"4T}_%",
+			geospatial.Point{Lat: 33.427333, Lon: -112.129, Altitude: 61 * metersToFeet, Speed: 20 * knotsToMph, Heading: 251}, true,
+		},
+		{
+			"old Mic-E tracker, no altitude", "S32UVT", "'(_fn\"Oj/",
+			geospatial.Point{Lat: 33.427333, Lon: -112.129, Speed: 20 * knotsToMph, Heading: 251}, true,
+		},
+		{
+			// Standard (not custom) message bits make it southern and
+			// eastern
+			"Mic-E south and east", "332564", "`(_fn\"Oj/",
+			geospatial.Point{Lat: -33.427333, Lon: 12.129, Speed: 20 * knotsToMph, Heading: 251}, true,
+		},
+		{"Mic-E with a bad destination", "APRS", "`(_fn\"Oj/", geospatial.Point{}, false},
+		{"Mic-E too short", "S32U6T", "`(_f", geospatial.Point{}, false},
+		{"bad hemisphere", "APRS", "!4903.50X/07201.75W-", geospatial.Point{}, false},
+		{"truncated", "APRS", "!4903.50N/0720", geospatial.Point{}, false},
+		{"truncated timestamp", "APRS", "@0923", geospatial.Point{}, false},
+		{"status", "APRS", ">Net Control Center", geospatial.Point{}, false},
+		{"message", "APRS", ":WU2Z     :Testing", geospatial.Point{}, false},
+		{"empty", "APRS", "", geospatial.Point{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := decodePosition(tt.dest, tt.body)
+		if ok != tt.ok || ok && !samePoint(got, tt.want) {
+			t.Errorf("%v: decodePosition(%q, %q) = %+v, %v, want %+v, %v", tt.name, tt.dest, tt.body, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNormalizePosition(t *testing.T) {
+	full := geospatial.Point{Lat: 49.058333, Lon: -72.029167, Altitude: 1234, Speed: 36 * knotsToMph, Heading: 88}
+	body := "@092345z4903.50N/07201.75W>088/036/A=001234"
+
+	tests := []struct {
+		name string
+		body string
+		ad   *aprs.APRSData
+		want *geospatial.Point // nil if normalizePosition should return nil
+	}{
+		{"library couldn't parse it", body, nil, &full},
+		{"library missed everything", body, &aprs.APRSData{}, &full},
+		{
+			"library missed the altitude", body,
+			&aprs.APRSData{Position: geospatial.Point{Lat: 49.058333, Lon: -72.029167, Speed: 41, Heading: 88}},
+			&geospatial.Point{Lat: 49.058333, Lon: -72.029167, Altitude: 1234, Speed: 41, Heading: 88},
+		},
+		{
+			"library got it all", body,
+			&aprs.APRSData{Position: geospatial.Point{Lat: 49, Lon: -72, Altitude: 1000, Speed: 10, Heading: 90}},
+			&geospatial.Point{Lat: 49, Lon: -72, Altitude: 1000, Speed: 10, Heading: 90},
+		},
+		{"not a position", ">Net Control Center", nil, nil},
+		{
+			"not a position, but parsed", ">Net Control Center",
+			&aprs.APRSData{Position: geospatial.Point{Lat: 49, Lon: -72}},
+			&geospatial.Point{Lat: 49, Lon: -72},
+		},
+	}
+
+	for _, tt := range tests {
+		pkt := ax25.APRSPacket{Dest: ax25.APRSAddress{Callsign: "APRS"}, Body: tt.body}
+		got := normalizePosition(pkt, tt.ad)
+		switch {
+		case tt.want == nil && got != nil:
+			t.Errorf("%v: got %+v, want nil", tt.name, got.Position)
+		case tt.want != nil && got == nil:
+			t.Errorf("%v: got nil, want %+v", tt.name, *tt.want)
+		case tt.want != nil && !samePoint(got.Position, *tt.want):
+			t.Errorf("%v: got %+v, want %+v", tt.name, got.Position, *tt.want)
+		}
+		if tt.ad != nil && got != tt.ad {
+			t.Errorf("%v: didn't fill in the library's APRSData", tt.name)
+		}
+	}
+}
+
+// Mic-E puts the latitude in the destination, so normalizePosition has to
+// pass it along
+func TestNormalizePositionMicE(t *testing.T) {
+	pkt := ax25.APRSPacket{Dest: ax25.APRSAddress{Callsign: "S32UVT"}, Body: "`(_fn\"Oj/]\"4T}="}
+	got := normalizePosition(pkt, nil)
+	want := geospatial.Point{Lat: 33.427333, Lon: -112.129, Altitude: 61 * metersToFeet, Speed: 20 * knotsToMph, Heading: 251}
+	if got == nil || !samePoint(got.Position, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	earthRadiusMiles = 3958.8
+	predictionWindow = 10 * time.Minute
+
+	// We re-send the predicted landing object this often, or sooner if the
+	// prediction moves more than landingObjectMove miles
+	landingObjectInterval = 2 * time.Minute
+	landingObjectMove     = 0.25
+
+	// Once we're sending a prediction, the payload counts as recovered when we
+	// or another chaser get this many miles from it, unless the config says otherwise
+	defaultRecoveryRadius = 0.05
+)
+
+// LandingConfig is about the predicted landing object we send to the team
+type LandingConfig struct {
+	// RecoveryRadius is how close (miles) we or another chaser have to get to
+	// the payload for it to count as recovered
+	RecoveryRadius float64 `yaml:"recovery_radius"`
+}
+
+// LandingPrediction is an estimate of where and when the payload will come down
+type LandingPrediction struct {
+	Point geospatial.Point
+	ETA   time.Time
+}
+
+// PredictedLanding extrapolates the balloon's recent descent down to groundAlt (feet).
+// This is a straight-line estimate using the average vertical rate and ground track
+// over the last few minutes, so it's only meaningful once the payload is descending.
+func (a *APRSTNC) PredictedLanding(groundAlt float64) (LandingPrediction, bool) {
+	return predictLanding(a.TrackAsSlice(), groundAlt)
+}
+
+func predictLanding(track []PayloadPacket, groundAlt float64) (LandingPrediction, bool) {
+	var pred LandingPrediction
+	var fixes []PayloadPacket
+
+	for _, v := range track {
+		if v.data.Position.Lat != 0 && v.data.Position.Altitude != 0 {
+			fixes = append(fixes, v)
+		}
+	}
+
+	if len(fixes) < 2 {
+		return pred, false
+	}
+
+	newest := fixes[0]
+	oldest := fixes[0]
+	for _, v := range fixes[1:] {
+		if newest.ts.Sub(v.ts) > predictionWindow {
+			break
+		}
+		oldest = v
+	}
+
+	dt := newest.ts.Sub(oldest.ts).Seconds()
+	if dt <= 0 {
+		return pred, false
+	}
+
+	// Vertical rate in feet/sec.  We only predict a landing if we're coming down.
+	vrate := (float64(newest.data.Position.Altitude) - float64(oldest.data.Position.Altitude)) / dt
+	if vrate >= -1 {
+		return pred, false
+	}
+
+	height := float64(newest.data.Position.Altitude) - groundAlt
+	if height <= 0 {
+		pred.Point = newest.data.Position
+		pred.ETA = newest.ts
+		return pred, true
+	}
+	secsToGround := height / -vrate
+
+	// Ground speed in miles/sec along the recent track
+	from := oldest.data.Position
+	dist := from.GreatCircleDistanceTo(newest.data.Position)
+	bearing := float64(from.BearingTo(newest.data.Position))
+	drift := dist / dt * secsToGround
+
+	pred.Point = projectPoint(newest.data.Position, bearing, drift)
+	pred.Point.Altitude = groundAlt
+	pred.ETA = newest.ts.Add(time.Duration(secsToGround) * time.Second)
+
+	return pred, true
+}
+
+// projectPoint returns the point that lies dist miles from p along bearing (degrees)
+func projectPoint(p geospatial.Point, bearing, dist float64) geospatial.Point {
+	lat1 := p.Lat * math.Pi / 180
+	lon1 := p.Lon * math.Pi / 180
+	brg := bearing * math.Pi / 180
+	d := dist / earthRadiusMiles
+
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(d) + math.Cos(lat1)*math.Sin(d)*math.Cos(brg))
+	lon2 := lon1 + math.Atan2(math.Sin(brg)*math.Sin(d)*math.Cos(lat1), math.Cos(d)-math.Sin(lat1)*math.Sin(lat2))
+
+	var dest geospatial.Point
+	dest.Lat = lat2 * 180 / math.Pi
+	dest.Lon = math.Mod(lon2*180/math.Pi+540, 360) - 180
+	return dest
+}
+
+// landingObject is the predicted landing as an APRS object, so that chasers
+// running other software can see it.  It's named after the balloon's callsign,
+// less its SSID, so that everyone can tell which flight it belongs to.
+func landingObject(pred LandingPrediction) APRSObject {
+	call := balloonCallsign()
+	if i := strings.Index(call, "-"); i >= 0 {
+		call = call[:i]
+	}
+
+	return APRSObject{
+		Name:        fmt.Sprintf("%.6s-LZ", call),
+		Pos:         pred.Point,
+		SymbolTable: '/',
+		SymbolCode:  '/', // Red dot
+		Comment:     fmt.Sprintf("Predicted landing of %v, ETA %vz", balloonCallsign(), pred.ETA.UTC().Format("15:04")),
+	}
+}
+
+// TransmitLandingPrediction keeps the team's maps up to date with where we
+// think the payload is coming down.  The prediction comes off their maps once
+// the payload has been recovered, and when we quit, since nobody will be
+// keeping it up to date after that.
+func TransmitLandingPrediction(ctx context.Context, a *APRSTNC, g PositionSource, lc LandingConfig) {
+	defer a.lastWords.Done()
+
+	b := &landingBeacon{a: a, g: g, radius: lc.RecoveryRadius}
+	if b.radius <= 0 {
+		b.radius = defaultRecoveryRadius
+	}
+
+	for sleep(ctx, 10*time.Second) {
+		b.update(time.Now())
+	}
+	b.kill("Shutting down")
+}
+
+// landingBeacon is the predicted landing object we've sent, if any
+type landingBeacon struct {
+	a      *APRSTNC
+	g      PositionSource
+	radius float64 // Recovery radius, miles
+
+	last   APRSObject
+	sent   time.Time
+	killed time.Time // When we killed last because the payload was recovered
+}
+
+// update sends a new or moved prediction, or kills it if the payload's been
+// recovered
+func (b *landingBeacon) update(now time.Time) {
+	if !b.killed.IsZero() {
+		// A payload heard again away from everyone wasn't recovered after all,
+		// e.g. a chaser just drove past it
+		lp, ok := b.a.LastPacket(balloonCallsign())
+		if !ok || !lp.ts.After(b.killed) || recovered(b.a, b.g, b.radius) {
+			return
+		}
+		log.Printf("Payload heard again after it was recovered; predicting its landing again")
+		b.last, b.killed = APRSObject{}, time.Time{}
+	}
+
+	if b.last.Name != "" && recovered(b.a, b.g, b.radius) {
+		if b.kill("Payload recovered") {
+			b.killed = now
+		}
+		return
+	}
+
+	o := b.last
+	if pred, ok := b.a.PredictedLanding(b.g.Position().Altitude); ok {
+		o = landingObject(pred)
+	}
+	if o.Name == "" {
+		return
+	}
+
+	// Send it when the prediction moves, and now and then anyway so that
+	// stations that missed it get it
+	moved := b.last.Name == "" || b.last.Pos.GreatCircleDistanceTo(o.Pos) > landingObjectMove
+	if !moved && now.Sub(b.sent) < landingObjectInterval {
+		return
+	}
+
+	if err := b.a.SendObject(o); err != nil {
+		log.Printf("Error sending predicted landing object: %v", err)
+		return
+	}
+	b.last, b.sent = o, now
+}
+
+// kill takes the prediction off the team's maps, if it's on them.  It returns
+// false if there was nothing to kill or the kill couldn't be queued.
+func (b *landingBeacon) kill(why string) bool {
+	if b.last.Name == "" || !b.killed.IsZero() {
+		return false
+	}
+
+	o := b.last
+	o.Killed = true
+	if err := b.a.SendObject(o); err != nil {
+		log.Printf("Error killing predicted landing object: %v", err)
+		return false
+	}
+	log.Printf("%v; killed predicted landing object %v", why, o.Name)
+	return true
+}
+
+// recovered reports whether we or another chaser are within radius miles of
+// the payload
+func recovered(a *APRSTNC, g PositionSource, radius float64) bool {
+	lp, ok := a.LastPosition(balloonCallsign())
+	if !ok {
+		return false
+	}
+	payload := lp.data.Position
+
+	near := func(p geospatial.Point) bool {
+		return (p.Lat != 0 || p.Lon != 0) && p.GreatCircleDistanceTo(payload) <= radius
+	}
+
+	if near(g.Position()) {
+		return true
+	}
+	for _, c := range sortedChaserCallsigns() {
+		if cp, ok := a.LastPosition(c); ok && near(cp.data.Position) {
+			return true
+		}
+	}
+	return false
+}
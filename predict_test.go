@@ -0,0 +1,150 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"math"
+	"testing"
+	"time"
+)
+
+// fix is a balloon position packet heard secs seconds after t0
+func fix(t0 time.Time, secs int, lat, lon, alt float64) PayloadPacket {
+	pp := PayloadPacket{ts: t0.Add(time.Duration(secs) * time.Second)}
+	pp.data.Position = geospatial.Point{Lat: lat, Lon: lon, Altitude: alt}
+	return pp
+}
+
+func TestPredictLanding(t *testing.T) {
+	t0 := time.Date(2014, 6, 9, 18, 0, 0, 0, time.UTC)
+	telemetry := PayloadPacket{ts: t0.Add(70 * time.Second)}
+
+	tests := []struct {
+		name      string
+		track     []PayloadPacket // Newest first
+		groundAlt float64
+		ok        bool
+		lat, lon  float64
+		eta       time.Time
+	}{
+		{
+			"not enough fixes",
+			[]PayloadPacket{fix(t0, 60, 47.01, -122, 9000)},
+			0, false, 0, 0, time.Time{},
+		},
+		{
+			"climbing",
+			[]PayloadPacket{fix(t0, 60, 47.01, -122, 11000), fix(t0, 0, 47, -122, 10000)},
+			0, false, 0, 0, time.Time{},
+		},
+		{
+			// 1,000 ft/min down from 9,000 feet is 9 minutes to go, drifting
+			// north 0.01° a minute
+			"descending",
+			[]PayloadPacket{fix(t0, 60, 47.01, -122, 9000), fix(t0, 0, 47, -122, 10000)},
+			0, true, 47.1, -122, t0.Add(10 * time.Minute),
+		},
+		{
+			"descending to high ground",
+			[]PayloadPacket{fix(t0, 60, 47.01, -122, 9000), fix(t0, 0, 47, -122, 10000)},
+			4500, true, 47.055, -122, t0.Add(5*time.Minute + 30*time.Second),
+		},
+		{
+			"packets without a position are skipped",
+			[]PayloadPacket{telemetry, fix(t0, 60, 47.01, -122, 9000), fix(t0, 0, 47, -122, 10000)},
+			0, true, 47.1, -122, t0.Add(10 * time.Minute),
+		},
+		{
+			// The climb from 20 minutes ago is outside the window
+			"only the last few minutes count",
+			[]PayloadPacket{fix(t0, 60, 47.01, -122, 9000), fix(t0, 0, 47, -122, 10000), fix(t0, -20*60, 46.9, -122, 2000)},
+			0, true, 47.1, -122, t0.Add(10 * time.Minute),
+		},
+		{
+			"already down",
+			[]PayloadPacket{fix(t0, 60, 47.01, -122, 400), fix(t0, 0, 47, -122, 1400)},
+			500, true, 47.01, -122, t0.Add(time.Minute),
+		},
+	}
+
+	for _, tt := range tests {
+		pred, ok := predictLanding(tt.track, tt.groundAlt)
+		if ok != tt.ok {
+			t.Errorf("%v: ok = %v, want %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.Abs(pred.Point.Lat-tt.lat) > 0.001 || math.Abs(pred.Point.Lon-tt.lon) > 0.001 {
+			t.Errorf("%v: landing at %.4f, %.4f, want %.4f, %.4f", tt.name, pred.Point.Lat, pred.Point.Lon, tt.lat, tt.lon)
+		}
+		if !pred.ETA.Equal(tt.eta) {
+			t.Errorf("%v: ETA %v, want %v", tt.name, pred.ETA, tt.eta)
+		}
+	}
+}
+
+// sentObject returns the object the TNC was asked to send, if there was one
+func sentObject(a *APRSTNC) (APRSObject, bool) {
+	select {
+	case o := <-a.aprsObject:
+		return o, true
+	default:
+		return APRSObject{}, false
+	}
+}
+
+// The landing object is killed when we reach the payload, comes back if the
+// payload turns up somewhere else, and is killed again when we quit
+func TestLandingBeacon(t *testing.T) {
+	setupFlight(t)
+	a := newAPRSTNC()
+	g := &fakePosition{pos: geospatial.Point{Lat: 47.5, Lon: -122}}
+	b := &landingBeacon{a: a, g: g, radius: defaultRecoveryRadius}
+
+	now := time.Now()
+	hearBalloon(t, a, now, 10000, 9000)
+	b.update(now)
+	if o, ok := sentObject(a); !ok || o.Killed || o.Name != "N0CALL-LZ" {
+		t.Fatalf("sent %+v, %v, want the predicted landing", o, ok)
+	}
+
+	// Nothing new to say
+	b.update(now.Add(10 * time.Second))
+	if o, ok := sentObject(a); ok {
+		t.Errorf("sent %+v with no change in the prediction", o)
+	}
+
+	// We've reached the payload
+	g.pos = geospatial.Point{Lat: 47.65, Lon: -122.3}
+	b.update(now.Add(20 * time.Second))
+	if o, ok := sentObject(a); !ok || !o.Killed {
+		t.Fatalf("sent %+v, %v, want the landing object killed", o, ok)
+	}
+	b.update(now.Add(30 * time.Second))
+	if o, ok := sentObject(a); ok {
+		t.Errorf("sent %+v after the payload was recovered", o)
+	}
+
+	// It's heard again while we're still beside it, so it's in the car
+	hearBalloon(t, a, now.Add(40*time.Second), 8500, 8000)
+	b.update(now.Add(40 * time.Second))
+	if o, ok := sentObject(a); ok {
+		t.Errorf("sent %+v while we still had the payload", o)
+	}
+
+	// We drove off and it's still coming down
+	g.pos = geospatial.Point{Lat: 47.5, Lon: -122}
+	hearBalloon(t, a, now.Add(50*time.Second), 7500, 7000)
+	b.update(now.Add(50 * time.Second))
+	if o, ok := sentObject(a); !ok || o.Killed {
+		t.Fatalf("sent %+v, %v, want the predicted landing again", o, ok)
+	}
+
+	if !b.kill("Shutting down") {
+		t.Fatal("kill() = false")
+	}
+	if o, ok := sentObject(a); !ok || !o.Killed {
+		t.Errorf("sent %+v, %v on shutdown, want the landing object killed", o, ok)
+	}
+}
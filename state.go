@@ -0,0 +1,235 @@
+package main
+
+import (
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"time"
+)
+
+// TrackerState is a point-in-time copy of everything the console UI shows.
+// It's what we hand to the web dashboard and the API.
+type TrackerState struct {
+	Time        time.Time       `json:"time"`
+	Payload     PayloadState    `json:"payload"`
+	Me          ChaserState     `json:"me"`
+	Chasers     []ChaserState   `json:"chasers"`
+	Landing     *LandingState   `json:"landing,omitempty"`
+	Packets     []PacketState   `json:"packets"`
+	Connections ConnectionState `json:"connections"`
+	Units       UnitLabels      `json:"units"`
+}
+
+// UnitLabels says what units a TrackerState's altitudes, speeds, distances
+// and vertical rates are in
+type UnitLabels struct {
+	Name     string `json:"name"`
+	Altitude string `json:"altitude"`
+	Speed    string `json:"speed"`
+	Distance string `json:"distance"`
+	Rate     string `json:"rate"`
+}
+
+type PositionState struct {
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Altitude float64 `json:"altitude"`
+	Speed    float64 `json:"speed"`
+	Heading  int     `json:"heading"`
+}
+
+// Vector is a distance and bearing (degrees) from one point to another
+type Vector struct {
+	Distance float64 `json:"distance"`
+	Bearing  int     `json:"bearing"`
+}
+
+type PayloadState struct {
+	Callsign     string         `json:"callsign"`
+	LastHeard    *time.Time     `json:"lastHeard,omitempty"`
+	Age          string         `json:"age,omitempty"`
+	Position     *PositionState `json:"position,omitempty"`
+	VerticalRate *float64       `json:"verticalRate,omitempty"`
+	Telemetry    []float64      `json:"telemetry,omitempty"`
+	FromMe       *Vector        `json:"fromMe,omitempty"`
+}
+
+type ChaserState struct {
+	Callsign    string         `json:"callsign"`
+	LastHeard   *time.Time     `json:"lastHeard,omitempty"`
+	Position    *PositionState `json:"position,omitempty"`
+	FromMe      *Vector        `json:"fromMe,omitempty"`
+	FromPayload *Vector        `json:"fromPayload,omitempty"`
+}
+
+type LandingState struct {
+	Position *PositionState `json:"position"`
+	ETA      time.Time      `json:"eta"`
+	FromMe   *Vector        `json:"fromMe,omitempty"`
+}
+
+type PacketState struct {
+	Time   time.Time `json:"time"`
+	Age    string    `json:"age"`
+	Source string    `json:"source"`
+	Type   string    `json:"type"`
+	Body   string    `json:"body"`
+	Paths  []string  `json:"paths"` // Every path the packet arrived by, first first
+}
+
+type LinkState struct {
+	Address   string `json:"address"`
+	Connected bool   `json:"connected"`
+}
+
+// GPSLinkState is the GPS connection plus the quality of its fix
+type GPSLinkState struct {
+	LinkState
+	Fix        string     `json:"fix"`
+	Mode       string     `json:"mode,omitempty"`
+	HDOP       float64    `json:"hdop,omitempty"`
+	Satellites int        `json:"satellites"`
+	Visible    int        `json:"visible,omitempty"`
+	FixTime    *time.Time `json:"fixTime,omitempty"`
+	Stale      bool       `json:"stale"`
+}
+
+type ConnectionState struct {
+	TNC LinkState    `json:"tnc"`
+	GPS GPSLinkState `json:"gps"`
+}
+
+func positionState(p geospatial.Point) *PositionState {
+	if p.Lat == 0 && p.Lon == 0 {
+		return nil
+	}
+	us := units()
+	return &PositionState{
+		Lat:      p.Lat,
+		Lon:      p.Lon,
+		Altitude: us.Altitude.Value(p.Altitude),
+		Speed:    us.Speed.Value(p.Speed),
+		Heading:  int(p.Heading),
+	}
+}
+
+func vectorBetween(from, to geospatial.Point) *Vector {
+	if from.Lat == 0 || to.Lat == 0 {
+		return nil
+	}
+	return &Vector{
+		Distance: units().Distance.Value(from.GreatCircleDistanceTo(to)),
+		Bearing:  int(from.BearingTo(to)),
+	}
+}
+
+func packetState(v PayloadPacket, now time.Time) PacketState {
+	return PacketState{
+		Time:   v.ts,
+		Age:    shortDuration(now.Sub(v.ts)),
+		Source: v.pkt.Source.String(),
+		Type:   packetType(v),
+		Body:   v.pkt.OriginalBody,
+		Paths:  arrivalPaths(v),
+	}
+}
+
+func arrivalPaths(v PayloadPacket) []string {
+	var paths []string
+	for _, ar := range v.Arrivals() {
+		paths = append(paths, markedPath(ar.Path))
+	}
+	return paths
+}
+
+// snapshotState gathers the current tracker state from the TNC and GPS
+func snapshotState(a *APRSTNC, g PositionSource) TrackerState {
+	var balloonPos geospatial.Point
+
+	now := time.Now()
+	myPos := g.Position()
+
+	us := units()
+	st := TrackerState{
+		Time:    now,
+		Chasers: []ChaserState{},
+		Packets: []PacketState{},
+		Units: UnitLabels{
+			Name:     us.Name,
+			Altitude: us.Altitude.Label,
+			Speed:    us.Speed.Label,
+			Distance: us.Distance.Label,
+			Rate:     us.Rate.Label,
+		},
+	}
+
+	st.Payload.Callsign = balloonCallsign()
+	if lp, exists := a.LastPacket(st.Payload.Callsign); exists {
+		heard := lp.ts
+		st.Payload.LastHeard = &heard
+		st.Payload.Age = shortDuration(now.Sub(lp.ts))
+		if lp.data.StandardTelemetry.A1 != 0 {
+			t := lp.data.StandardTelemetry
+			st.Payload.Telemetry = []float64{float64(t.A1), float64(t.A2), float64(t.A3), float64(t.A4), float64(t.A5)}
+		} else if lp.data.CompressedTelemetry.A1 != 0 {
+			t := lp.data.CompressedTelemetry
+			st.Payload.Telemetry = []float64{float64(t.A1), float64(t.A2), float64(t.A3), float64(t.A4), float64(t.A5)}
+		}
+	}
+	if lp, exists := a.LastPosition(st.Payload.Callsign); exists {
+		st.Payload.Position = positionState(lp.data.Position)
+		balloonPos = lp.data.Position
+	}
+	if rate, ok := verticalRate(a.TrackAsSlice()); ok {
+		vr := units().Rate.Value(float64(rate))
+		st.Payload.VerticalRate = &vr
+	}
+	st.Payload.FromMe = vectorBetween(myPos, balloonPos)
+
+	st.Me = ChaserState{
+		Callsign:    chaserCallsign(),
+		Position:    positionState(myPos),
+		FromPayload: vectorBetween(myPos, balloonPos),
+	}
+
+	for _, v := range sortedChaserCallsigns() {
+		cs := ChaserState{Callsign: v}
+		if lp, exists := a.LastPacket(v); exists {
+			heard := lp.ts
+			cs.LastHeard = &heard
+		}
+		if lp, exists := a.LastPosition(v); exists {
+			cs.Position = positionState(lp.data.Position)
+			cs.FromMe = vectorBetween(myPos, lp.data.Position)
+			cs.FromPayload = vectorBetween(lp.data.Position, balloonPos)
+		}
+		st.Chasers = append(st.Chasers, cs)
+	}
+
+	if pred, ok := a.PredictedLanding(float64(myPos.Altitude)); ok {
+		st.Landing = &LandingState{
+			Position: positionState(pred.Point),
+			ETA:      pred.ETA,
+			FromMe:   vectorBetween(myPos, pred.Point),
+		}
+	}
+
+	for _, v := range a.RingAsSlice() {
+		st.Packets = append(st.Packets, packetState(v, now))
+	}
+
+	st.Connections.TNC = LinkState{Address: *a.remotetnc, Connected: a.IsConnected()}
+	fix := g.Fix()
+	st.Connections.GPS = GPSLinkState{
+		LinkState:  LinkState{Address: g.Address(), Connected: g.IsReady()},
+		Fix:        fix.String(),
+		Mode:       fix.ModeString(),
+		HDOP:       fix.HDOP,
+		Satellites: fix.Satellites,
+		Visible:    fix.Visible,
+		Stale:      fix.Stale(now),
+	}
+	if !fix.Time.IsZero() {
+		st.Connections.GPS.FixTime = &fix.Time
+	}
+
+	return st
+}
@@ -0,0 +1,856 @@
+package main
+
+import (
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"github.com/chrissnell/gophertrak/draw"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What the modal dialog is currently being used for
+const (
+	modalNone = iota
+	modalMessageTo
+	modalMessageText
+	modalCutdown
+	modalNotice
+	modalInspector
+	modalAlerts
+	modalWaypointName
+)
+
+// Which screen we're showing inside the frame
+const (
+	viewMain = iota
+	viewHeard
+	viewPaths
+	viewNav
+	viewWaypoints
+)
+
+// trackerUI is the console's widget tree.  Our goroutines update the widgets'
+// contents and the draw package's render loop puts them on the screen.
+type trackerUI struct {
+	frame *draw.Panel
+
+	payload        *draw.Panel
+	payloadLast    *draw.Label
+	payloadBattery *draw.Label
+	payloadAlt     *draw.Label
+	payloadSpeed   *draw.Label
+	payloadCourse  *draw.Label
+	payloadArrow   *draw.Label
+	payloadRate    *draw.Label
+	payloadPos     *draw.Label
+
+	chase         *draw.Panel
+	mySpeedTitle  *draw.Label
+	myCourseTitle *draw.Label
+	myLatTitle    *draw.Label
+	myLonTitle    *draw.Label
+	myLat         *draw.Label
+	myLon         *draw.Label
+	myAlt         *draw.Label
+	mySpeed       *draw.Label
+	myCourse      *draw.Label
+	myFix         *draw.Label
+	myFixDetail   *draw.Label
+	chasers       *draw.Table
+
+	packetsPanel *draw.Panel
+	packets      *draw.Table
+
+	heardPanel *draw.Panel
+	heard      *draw.Table
+
+	pathsPanel   *draw.Panel
+	pathsSummary *draw.Label
+	digis        *draw.Table
+	payloadPaths *draw.Table
+
+	navPanel      *draw.Panel
+	navTarget     *draw.Label
+	navTurn       *draw.Label
+	navDistance   *draw.Label
+	navCourse     *draw.Label
+	navClosing    *draw.Label
+	navETA        *draw.Label
+	navCrossTrack *draw.Label
+
+	waypointsPanel *draw.Panel
+	waypointTable  *draw.Table
+
+	status *draw.StatusBar
+	banner *draw.Label
+	alerts *alertEngine
+	g      PositionSource
+
+	modal     *draw.Modal
+	input     *draw.TextInput
+	modalMode int
+	msgTo     string
+	alertRows []int // IDs of the alerts listed in the alerts modal
+
+	// What's in each row of the chaser and packet tables, so that we know
+	// what was clicked on
+	mu             sync.Mutex
+	chaserRows     []string
+	selectedChaser string
+	packetRows     []PayloadPacket
+	selectedPacket time.Time
+	packetFilter   string
+	view           int
+
+	// What we're navigating to, and where the course line to it starts
+	navTargets    []navTarget
+	navTargetName string
+	navOrigin     geospatial.Point
+
+	// The waypoint in each row of the waypoint table, and where a waypoint
+	// we're naming is going to go
+	waypointRows []string
+	newWaypoint  geospatial.Point
+}
+
+func newTrackerUI() *trackerUI {
+	u := &trackerUI{}
+
+	u.frame = draw.NewBorderedPanel(vers, draw.DoubleSolid, draw.BlueText, draw.WhiteText)
+
+	// PAYLOAD
+	u.payload = draw.NewTitledPanel("PAYLOAD", draw.RedTitle)
+	u.payloadLast = draw.NewLabel(draw.WhiteText, "---------")
+	u.payloadBattery = draw.NewLabel(draw.YellowText, "-.-- V")
+	u.payloadAlt = draw.NewLabel(draw.WhiteText, "---------")
+	u.payloadSpeed = draw.NewLabel(draw.WhiteText, "---------")
+	u.payloadCourse = draw.NewLabel(draw.WhiteText, "---°")
+	u.payloadArrow = draw.NewLabel(draw.CyanText, "•")
+	u.payloadRate = draw.NewLabel(draw.WhiteText, "")
+	u.payloadPos = draw.NewLabel(draw.WhiteText, "")
+	u.payloadPos.SetSpans(
+		draw.Span{Text: "------°-", Style: draw.WhiteText},
+		draw.Span{Text: " / ", Style: draw.PurpleText},
+		draw.Span{Text: "-------°-", Style: draw.WhiteText},
+	)
+
+	u.payload.Place(draw.NewLabel(draw.WhiteText, "CALLSIGN:"), draw.Rect{X: 0, Y: 2})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, balloonCallsign()), draw.Rect{X: 11, Y: 2})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, "    LAST:"), draw.Rect{X: 0, Y: 3})
+	u.payload.Place(u.payloadLast, draw.Rect{X: 11, Y: 3})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, " BATTERY:"), draw.Rect{X: 0, Y: 4})
+	u.payload.Place(u.payloadBattery, draw.Rect{X: 11, Y: 4})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, "ALTITUDE:"), draw.Rect{X: 0, Y: 6})
+	u.payload.Place(u.payloadAlt, draw.Rect{X: 11, Y: 6})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, "SPEED:"), draw.Rect{X: 3, Y: 7})
+	u.payload.Place(u.payloadSpeed, draw.Rect{X: 11, Y: 7})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, "COURSE:"), draw.Rect{X: 2, Y: 8})
+	u.payload.Place(u.payloadCourse, draw.Rect{X: 11, Y: 8, W: 5})
+	u.payload.Place(u.payloadArrow, draw.Rect{X: 16, Y: 8})
+	u.payload.Place(draw.NewLabel(draw.WhiteText, "ELEV Δ:"), draw.Rect{X: 2, Y: 10})
+	u.payload.Place(u.payloadRate, draw.Rect{X: 11, Y: 10})
+	u.payload.Place(u.payloadPos, draw.Rect{X: 0, Y: 12})
+
+	// CHASERS
+	u.chase = draw.NewPanel()
+	u.mySpeedTitle = draw.NewLabel(draw.WhiteText, "SPEED:")
+	u.myCourseTitle = draw.NewLabel(draw.WhiteText, "COURSE:")
+	u.myLatTitle = draw.NewLabel(draw.WhiteText, "LAT:")
+	u.myLonTitle = draw.NewLabel(draw.WhiteText, "LON:")
+	u.myLat = draw.NewLabel(draw.YellowText, "-----------")
+	u.myLon = draw.NewLabel(draw.YellowText, "-----------")
+	u.myAlt = draw.NewLabel(draw.YellowText, "-----------")
+	u.mySpeed = draw.NewLabel(draw.YellowText, "-----------")
+	u.myCourse = draw.NewLabel(draw.YellowText, "-----------")
+	u.myFix = draw.NewLabel(draw.RedText, "NO FIX")
+	u.myFixDetail = draw.NewLabel(draw.GreyText, "")
+	u.chasers = draw.NewTable(draw.CyanTitle,
+		draw.Column{X: 0},
+		draw.Column{Title: "CALLSIGN", X: 1, Width: 8},
+		draw.Column{Title: "FROM ME", X: 14, Width: 16},
+		draw.Column{Title: "FROM PAYLOAD", X: 34, Width: 16},
+	)
+
+	u.chase.Place(draw.NewLabel(draw.RedTitle, "CHASERS"), draw.Rect{X: 1, Y: 0})
+	u.chase.Place(draw.NewLabel(draw.CyanTitle, "MY CHASE VEHICLE"), draw.Rect{X: 1, Y: 2})
+	u.chase.Place(u.myFix, draw.Rect{X: 19, Y: 2})
+	u.chase.Place(u.myLatTitle, draw.Rect{X: 1, Y: 3, W: 5})
+	u.chase.Place(u.myLonTitle, draw.Rect{X: 1, Y: 4, W: 5})
+	u.chase.Place(draw.NewLabel(draw.WhiteText, "ALT:"), draw.Rect{X: 1, Y: 5})
+	u.chase.Place(u.myLat, draw.Rect{X: 7, Y: 3})
+	u.chase.Place(u.myLon, draw.Rect{X: 7, Y: 4})
+	u.chase.Place(u.myAlt, draw.Rect{X: 7, Y: 5})
+	u.chase.Place(u.chasers, draw.Rect{X: 0, Y: 8})
+	u.chase.Arrange = u.arrangeChase
+
+	// RECENT PACKETS
+	u.packetsPanel = draw.NewTitledPanel("RECENT PACKETS", draw.RedTitle)
+	u.packets = draw.NewTable(draw.CyanTitle,
+		draw.Column{Title: "AGE", X: 0, Width: 7},
+		draw.Column{Title: "TYPE", X: 9, Width: 7},
+		draw.Column{Title: "CONTENTS", X: 18, Width: 60},
+	)
+	u.packetsPanel.Place(u.packets, draw.Rect{X: 0, Y: 2})
+
+	// HEARD STATIONS
+	u.heardPanel = draw.NewTitledPanel("HEARD STATIONS", draw.RedTitle)
+	u.heard = draw.NewTable(draw.CyanTitle,
+		draw.Column{Title: "CALLSIGN", X: 0, Width: 9},
+		draw.Column{Title: "PKTS", X: 11, Width: 5},
+		draw.Column{Title: "VIA", X: 18, Width: 6},
+		draw.Column{Title: "LAST", X: 26, Width: 7},
+		draw.Column{Title: "SYMBOL", X: 35, Width: 14},
+		draw.Column{Title: "POSITION", X: 51, Width: 20},
+		draw.Column{Title: "FROM ME", X: 73, Width: 16},
+	)
+	u.heardPanel.Place(u.heard, draw.Rect{X: 0, Y: 2})
+
+	// PAYLOAD PATHS
+	u.pathsPanel = draw.NewTitledPanel("PAYLOAD PATHS", draw.RedTitle)
+	u.pathsSummary = draw.NewLabel(draw.WhiteText, "No packets heard from the payload yet")
+	u.digis = draw.NewTable(draw.CyanTitle,
+		draw.Column{Title: "DIGIPEATER", X: 0, Width: 10},
+		draw.Column{Title: "RELAYED", X: 12, Width: 7},
+		draw.Column{Title: "LAST HOP", X: 21, Width: 8},
+		draw.Column{Title: "FIRST", X: 31, Width: 8},
+		draw.Column{Title: "LAST", X: 41, Width: 8},
+	)
+	u.payloadPaths = draw.NewTable(draw.CyanTitle,
+		draw.Column{Title: "AGE", X: 0, Width: 7},
+		draw.Column{Title: "VIA", X: 9, Width: 6},
+		draw.Column{Title: "PATH", X: 17, Width: 50},
+	)
+	u.pathsPanel.Place(u.pathsSummary, draw.Rect{X: 0, Y: 2})
+	u.pathsPanel.Place(u.digis, draw.Rect{X: 0, Y: 4, H: digiRows + 1})
+	u.pathsPanel.Place(u.payloadPaths, draw.Rect{X: 0, Y: digiRows + 6})
+
+	// NAVIGATION
+	u.navPanel = draw.NewTitledPanel("NAVIGATION", draw.RedTitle)
+	u.navTarget = draw.NewLabel(draw.GreyText, "- NO TARGETS -")
+	u.navTurn = draw.NewLabel(draw.YellowTitle, "")
+	u.navDistance = draw.NewLabel(draw.WhiteText, "--")
+	u.navCourse = draw.NewLabel(draw.WhiteText, "--")
+	u.navClosing = draw.NewLabel(draw.WhiteText, "--")
+	u.navETA = draw.NewLabel(draw.WhiteText, "--")
+	u.navCrossTrack = draw.NewLabel(draw.WhiteText, "--")
+
+	u.navPanel.Place(draw.NewLabel(draw.WhiteText, "     TARGET:"), draw.Rect{X: 0, Y: 2})
+	u.navPanel.Place(u.navTarget, draw.Rect{X: 13, Y: 2})
+	u.navPanel.Place(u.navTurn, draw.Rect{X: 13, Y: 4})
+	u.navPanel.Place(draw.NewLabel(draw.WhiteText, "   DISTANCE:"), draw.Rect{X: 0, Y: 6})
+	u.navPanel.Place(u.navDistance, draw.Rect{X: 13, Y: 6})
+	u.navPanel.Place(draw.NewLabel(draw.WhiteText, "  MY COURSE:"), draw.Rect{X: 0, Y: 7})
+	u.navPanel.Place(u.navCourse, draw.Rect{X: 13, Y: 7})
+	u.navPanel.Place(draw.NewLabel(draw.WhiteText, "    CLOSING:"), draw.Rect{X: 0, Y: 8})
+	u.navPanel.Place(u.navClosing, draw.Rect{X: 13, Y: 8})
+	u.navPanel.Place(draw.NewLabel(draw.WhiteText, "        ETA:"), draw.Rect{X: 0, Y: 9})
+	u.navPanel.Place(u.navETA, draw.Rect{X: 13, Y: 9})
+	u.navPanel.Place(draw.NewLabel(draw.WhiteText, "CROSS-TRACK:"), draw.Rect{X: 0, Y: 11})
+	u.navPanel.Place(u.navCrossTrack, draw.Rect{X: 13, Y: 11})
+	u.navPanel.Place(draw.NewLabel(draw.GreyText, "←/→ change target   ENTER restart course line from here   ESC back"), draw.Rect{X: 0, Y: 13})
+
+	// WAYPOINTS
+	u.waypointsPanel = draw.NewTitledPanel("WAYPOINTS", draw.RedTitle)
+	u.waypointTable = draw.NewTable(draw.CyanTitle,
+		draw.Column{Title: "NAME", X: 0, Width: 9},
+		draw.Column{Title: "KIND", X: 11, Width: 7},
+		draw.Column{Title: "POSITION", X: 20, Width: 20},
+		draw.Column{Title: "FROM ME", X: 42, Width: 18},
+		draw.Column{Title: "TX", X: 62, Width: 3},
+		draw.Column{Title: "", X: 67, Width: 12},
+	)
+	u.waypointsPanel.Place(draw.NewLabel(draw.GreyText, "M add at my position   P add at the payload   T send to team on/off   DEL remove"), draw.Rect{X: 0, Y: 2})
+	u.waypointsPanel.Place(u.waypointTable, draw.Rect{X: 0, Y: 4})
+
+	u.status = draw.NewStatusBar(draw.WhiteOnBlueText, draw.BlueText)
+	u.banner = draw.NewLabel(draw.WhiteOnRedText, "")
+
+	u.modal = draw.NewModal(draw.BlueText, draw.WhiteText, draw.WhiteText)
+	u.input = draw.NewTextInput("", 67)
+
+	return u
+}
+
+// arrangeChase puts MY CHASE VEHICLE's speed and course beside its position,
+// or below it if the panel is too narrow
+func (u *trackerUI) arrangeChase(r draw.Rect) {
+	x, y := 32, 3
+	if r.W < chaseWideWidth {
+		x, y = 10, 6
+	}
+	u.chase.Place(u.mySpeedTitle, draw.Rect{X: x - 8, Y: y, W: 6})
+	u.chase.Place(u.myCourseTitle, draw.Rect{X: x - 9, Y: y + 1, W: 7})
+	u.chase.Place(u.mySpeed, draw.Rect{X: x, Y: y})
+	u.chase.Place(u.myCourse, draw.Rect{X: x, Y: y + 1})
+
+	if r.W < chaseWideWidth {
+		u.chase.Place(u.myFixDetail, draw.Rect{X: 20, Y: 5})
+	} else {
+		u.chase.Place(u.myFixDetail, draw.Rect{X: x - 8, Y: y + 2})
+	}
+}
+
+// Draw makes trackerUI the root of the widget tree.  Panels are laid out to
+// suit the terminal's current size every time we draw, so a resize just needs
+// a redraw.
+func (u *trackerUI) Draw(c *draw.Canvas, r draw.Rect) {
+	l := computeLayout(r.W-1, r.H-1)
+
+	u.frame.Draw(c, r)
+	switch u.View() {
+	case viewHeard:
+		u.heardPanel.Draw(c, l.Main)
+	case viewPaths:
+		u.pathsPanel.Draw(c, l.Main)
+	case viewNav:
+		u.navPanel.Draw(c, l.Main)
+	case viewWaypoints:
+		u.waypointsPanel.Draw(c, l.Main)
+	default:
+		u.payload.Draw(c, l.Payload)
+		u.chase.Draw(c, l.Chase)
+		u.packetsPanel.Draw(c, l.Packets)
+	}
+	u.status.Draw(c, l.StatusBar)
+	u.banner.Draw(c, l.Banner)
+	u.modal.Draw(c, r)
+}
+
+//
+// Hot keys and the modal dialogs behind them
+//
+
+// HandleKey deals with a keypress and returns false if it's time to quit
+func (u *trackerUI) HandleKey(ev draw.Event, a *APRSTNC) bool {
+	if u.modal.Visible() {
+		u.handleModalKey(ev, a)
+		return true
+	}
+
+	// The other screens scroll their table and go back to the main screen on ESC
+	if t := u.viewTable(); t != nil {
+		switch ev.Key {
+		case draw.KeyArrowUp:
+			t.MoveSelection(-1)
+			return true
+		case draw.KeyArrowDown:
+			t.MoveSelection(1)
+			return true
+		case draw.KeyPgup:
+			t.MoveSelection(-t.PageSize())
+			return true
+		case draw.KeyPgdn:
+			t.MoveSelection(t.PageSize())
+			return true
+		case draw.KeyEsc:
+			u.setView(viewMain)
+			return true
+		}
+	}
+
+	if u.View() == viewWaypoints {
+		switch {
+		case ev.Ch == 'm' || ev.Ch == 'M':
+			u.nameWaypoint(u.g.Position())
+			return true
+		case ev.Ch == 'p' || ev.Ch == 'P':
+			if lp, ok := a.LastPosition(balloonCallsign()); ok {
+				u.nameWaypoint(lp.data.Position)
+			} else {
+				u.notice("NO PAYLOAD POSITION", "We haven't heard a position from the payload yet.")
+			}
+			return true
+		case ev.Ch == 't' || ev.Ch == 'T':
+			if w, ok := waypoints.ToggleTransmit(u.selectedWaypoint()); ok {
+				sendWaypoint(a, w, !w.Transmit)
+			}
+			return true
+		case ev.Key == draw.KeyDelete:
+			if w, ok := waypoints.Remove(u.selectedWaypoint()); ok && w.Transmit {
+				sendWaypoint(a, w, true)
+			}
+			return true
+		}
+	}
+
+	if u.View() == viewNav {
+		switch ev.Key {
+		case draw.KeyArrowLeft:
+			u.cycleNavTarget(-1)
+			return true
+		case draw.KeyArrowRight:
+			u.cycleNavTarget(1)
+			return true
+		case draw.KeyEnter:
+			u.resetCourseLine()
+			return true
+		case draw.KeyEsc:
+			u.setView(viewMain)
+			return true
+		}
+	}
+
+	if ev.Ch == '?' {
+		u.showHelp()
+		return true
+	}
+
+	switch ev.Key {
+	case draw.KeyCtrlS:
+		draw.Sync()
+	case draw.KeyF2:
+		u.toggleView(viewHeard)
+	case draw.KeyF4:
+		u.toggleView(viewPaths)
+	case draw.KeyF5:
+		u.showAlerts(0)
+	case draw.KeyF6:
+		cycleUnits()
+	case draw.KeyF8:
+		cycleCoordFormat()
+	case draw.KeyF9:
+		u.toggleView(viewNav)
+	case draw.KeyF10:
+		u.toggleView(viewWaypoints)
+	case draw.KeyF1:
+		u.modalMode = modalMessageTo
+		u.input.SetPrompt("TO:")
+		u.input.SetValue(u.messageRecipient())
+		u.modal.Show("SEND MESSAGE", []string{"Who should we send the message to?"}, u.input)
+	case draw.KeyF3:
+		u.cyclePacketFilter(a)
+	case draw.KeyF7:
+		expires := a.ArmCutdown()
+		u.modalMode = modalCutdown
+		u.modal.Show("CUTDOWN ARMED", []string{
+			fmt.Sprintf("Press F7 again before %v to cut down %v.", expires.Format("15:04:05"), balloonCallsign()),
+			"Press ESC to disarm.",
+		}, nil)
+	case draw.KeyArrowUp:
+		u.movePacketSelection(-1)
+	case draw.KeyArrowDown:
+		u.movePacketSelection(1)
+	case draw.KeyPgup:
+		u.movePacketSelection(-u.packets.PageSize())
+	case draw.KeyPgdn:
+		u.movePacketSelection(u.packets.PageSize())
+	case draw.KeyHome:
+		u.selectPacket(0)
+	case draw.KeyEnd:
+		u.selectPacket(u.packets.Len() - 1)
+	case draw.KeyEnter:
+		u.inspectPacket(u.packets.Selected())
+	case draw.KeyEsc:
+		// The first ESC lets go of the selected packet
+		if u.packets.Selected() >= 0 {
+			u.selectPacket(-1)
+			return true
+		}
+		return false
+	}
+
+	return true
+}
+
+func (u *trackerUI) handleModalKey(ev draw.Event, a *APRSTNC) {
+	switch u.modalMode {
+	case modalMessageTo:
+		switch u.input.HandleKey(ev) {
+		case draw.InputSubmitted:
+			u.msgTo = u.input.Value()
+			u.modalMode = modalMessageText
+			u.input.SetPrompt("MSG:")
+			u.input.SetValue("")
+			u.modal.Show("SEND MESSAGE", []string{fmt.Sprintf("Message to %v:", u.msgTo)}, u.input)
+		case draw.InputCancelled:
+			u.closeModal()
+		}
+
+	case modalMessageText:
+		switch u.input.HandleKey(ev) {
+		case draw.InputSubmitted:
+			err := a.SendMessage(u.msgTo, u.input.Value())
+			if err != nil {
+				u.notice("MESSAGE NOT SENT", err.Error())
+			} else {
+				u.closeModal()
+			}
+		case draw.InputCancelled:
+			u.closeModal()
+		}
+
+	case modalCutdown:
+		switch ev.Key {
+		case draw.KeyF7:
+			err := a.SendCutdown()
+			if err != nil {
+				u.notice("CUTDOWN NOT SENT", err.Error())
+			} else {
+				u.notice("CUTDOWN SENT", fmt.Sprintf("Cutdown command queued for %v.", balloonCallsign()))
+			}
+		case draw.KeyEsc:
+			a.DisarmCutdown()
+			u.closeModal()
+		}
+
+	case modalWaypointName:
+		switch u.input.HandleKey(ev) {
+		case draw.InputSubmitted:
+			u.mu.Lock()
+			pos := u.newWaypoint
+			u.mu.Unlock()
+			err := waypoints.Add(Waypoint{Name: strings.ToUpper(u.input.Value()), Kind: waypointOther, Pos: pos})
+			if err != nil {
+				u.notice("WAYPOINT NOT ADDED", err.Error())
+			} else {
+				u.closeModal()
+			}
+		case draw.InputCancelled:
+			u.closeModal()
+		}
+
+	case modalAlerts:
+		switch {
+		case ev.Key == draw.KeyArrowUp:
+			u.modal.MoveSelection(-1)
+		case ev.Key == draw.KeyArrowDown:
+			u.modal.MoveSelection(1)
+		case ev.Key == draw.KeyPgup:
+			u.modal.MoveSelection(-u.modal.PageSize())
+		case ev.Key == draw.KeyPgdn:
+			u.modal.MoveSelection(u.modal.PageSize())
+		case ev.Key == draw.KeyEnter:
+			if i := u.modal.Selected(); i >= 0 && i < len(u.alertRows) {
+				u.alerts.Ack(u.alertRows[i])
+			}
+			u.showAlerts(u.modal.Selected())
+		case ev.Ch == 'a' || ev.Ch == 'A':
+			u.alerts.AckAll()
+			u.banner.Set(draw.WhiteOnRedText, "")
+			u.closeModal()
+		default:
+			u.closeModal()
+		}
+
+	case modalInspector:
+		switch ev.Key {
+		case draw.KeyArrowUp:
+			u.modal.Scroll(-1)
+		case draw.KeyArrowDown:
+			u.modal.Scroll(1)
+		case draw.KeyPgup:
+			u.modal.Scroll(-u.modal.PageSize())
+		case draw.KeyPgdn:
+			u.modal.Scroll(u.modal.PageSize())
+		default:
+			u.closeModal()
+		}
+
+	default:
+		// Any key dismisses a notice
+		u.closeModal()
+	}
+}
+
+// HandleMouse deals with a click and returns false if it's time to quit.
+// Clicking a chaser selects it, clicking a packet shows its details and
+// clicking a hot key in the status bar is the same as pressing it.
+func (u *trackerUI) HandleMouse(ev draw.Event, a *APRSTNC) bool {
+	if u.modal.Visible() {
+		return true
+	}
+
+	if k, ok := u.status.KeyAt(ev.MouseX, ev.MouseY); ok {
+		return u.HandleKey(draw.Event{Type: draw.EventKey, Key: k}, a)
+	}
+
+	if t := u.viewTable(); t != nil {
+		if i := t.RowAt(ev.MouseX, ev.MouseY); i >= 0 {
+			t.Select(i)
+		}
+		return true
+	}
+
+	if i := u.chasers.RowAt(ev.MouseX, ev.MouseY); i >= 0 {
+		u.mu.Lock()
+		if i < len(u.chaserRows) {
+			if u.selectedChaser == u.chaserRows[i] {
+				// Clicking the selected chaser again deselects it
+				u.selectedChaser = ""
+				i = -1
+			} else {
+				u.selectedChaser = u.chaserRows[i]
+			}
+			u.chasers.Select(i)
+		}
+		u.mu.Unlock()
+		return true
+	}
+
+	if i := u.packets.RowAt(ev.MouseX, ev.MouseY); i >= 0 {
+		u.selectPacket(i)
+		u.inspectPacket(i)
+	}
+
+	return true
+}
+
+// setChaserRows updates the chaser table, keeping the selected chaser
+// highlighted wherever its row ends up
+func (u *trackerUI) setChaserRows(rows [][]draw.Span, calls []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.chaserRows = calls
+	sel := -1
+	for i, c := range calls {
+		if c == u.selectedChaser {
+			sel = i
+		}
+	}
+	u.chasers.SetRows(rows)
+	u.chasers.Select(sel)
+}
+
+// setPacketRows updates the packet table.  New packets push the old ones
+// down, so the selection follows the selected packet rather than the row.
+func (u *trackerUI) setPacketRows(rows [][]draw.Span, packets []PayloadPacket) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.packetRows = packets
+	u.packets.SetRows(rows)
+
+	if u.selectedPacket.IsZero() {
+		return
+	}
+	sel := -1
+	for i := range packets {
+		if packets[i].ts.Equal(u.selectedPacket) {
+			sel = i
+			break
+		}
+	}
+	if sel < 0 {
+		// It's aged out of the history
+		u.selectedPacket = time.Time{}
+	}
+	u.packets.Select(sel)
+}
+
+func (u *trackerUI) selectPacket(i int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.selectedPacket = time.Time{}
+	if i >= 0 && i < len(u.packetRows) {
+		u.selectedPacket = u.packetRows[i].ts
+	} else {
+		i = -1
+	}
+	u.packets.Select(i)
+}
+
+func (u *trackerUI) movePacketSelection(n int) {
+	u.selectPacket(u.packets.MoveSelection(n))
+}
+
+func (u *trackerUI) View() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.view
+}
+
+func (u *trackerUI) setView(v int) {
+	u.mu.Lock()
+	u.view = v
+	u.mu.Unlock()
+	draw.Invalidate()
+}
+
+// toggleView switches to a screen, or back to the main one if it's already showing
+func (u *trackerUI) toggleView(v int) {
+	if u.View() == v {
+		v = viewMain
+	}
+	u.setView(v)
+}
+
+// viewTable is the table that the arrow keys scroll on screens other than the
+// main one
+func (u *trackerUI) viewTable() *draw.Table {
+	switch u.View() {
+	case viewHeard:
+		return u.heard
+	case viewPaths:
+		return u.payloadPaths
+	case viewWaypoints:
+		return u.waypointTable
+	}
+	return nil
+}
+
+// nameWaypoint asks for a name for a new waypoint at p
+func (u *trackerUI) nameWaypoint(p geospatial.Point) {
+	if p.Lat == 0 && p.Lon == 0 {
+		u.notice("NO POSITION", "There's no position to put a waypoint at yet.")
+		return
+	}
+
+	u.mu.Lock()
+	u.newWaypoint = p
+	u.mu.Unlock()
+
+	u.modalMode = modalWaypointName
+	u.input.SetPrompt("NAME:")
+	u.input.SetValue("")
+	u.modal.Show("ADD WAYPOINT", []string{
+		fmt.Sprintf("Waypoint at %v", coordString(p, currentCoordFormat())),
+		"Name it (up to 9 characters):",
+	}, u.input)
+}
+
+// setWaypointRows updates the waypoint table, keeping the selected waypoint
+// selected wherever its row ends up
+func (u *trackerUI) setWaypointRows(rows [][]draw.Span, names []string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	sel := -1
+	if i := u.waypointTable.Selected(); i >= 0 && i < len(u.waypointRows) {
+		for j, n := range names {
+			if n == u.waypointRows[i] {
+				sel = j
+			}
+		}
+	}
+	u.waypointRows = names
+	u.waypointTable.SetRows(rows)
+	u.waypointTable.Select(sel)
+}
+
+// selectedWaypoint is the name of the waypoint selected in the waypoint table
+func (u *trackerUI) selectedWaypoint() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	i := u.waypointTable.Selected()
+	if i < 0 || i >= len(u.waypointRows) {
+		return ""
+	}
+	return u.waypointRows[i]
+}
+
+// PacketFilter is the type of packet the packet table is limited to, or "" for all
+func (u *trackerUI) PacketFilter() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.packetFilter
+}
+
+// cyclePacketFilter moves the packet table's filter on to the next type we
+// have packets of, and then back round to showing everything
+func (u *trackerUI) cyclePacketFilter(a *APRSTNC) {
+	heard := make(map[string]bool)
+	for _, v := range a.HistoryAsSlice() {
+		heard[packetType(v)] = true
+	}
+
+	u.mu.Lock()
+	next := ""
+	passed := u.packetFilter == ""
+	for _, t := range packetTypes {
+		if passed && heard[t] {
+			next = t
+			break
+		}
+		if t == u.packetFilter {
+			passed = true
+		}
+	}
+	u.packetFilter = next
+	u.selectedPacket = time.Time{}
+	u.mu.Unlock()
+
+	if next == "" {
+		u.packetsPanel.SetTitle("RECENT PACKETS")
+	} else {
+		u.packetsPanel.SetTitle("RECENT PACKETS: " + next)
+	}
+	u.packets.Select(-1)
+	u.refreshPackets(a)
+}
+
+// inspectPacket opens the packet inspector on row i of the packet table
+func (u *trackerUI) inspectPacket(i int) {
+	u.mu.Lock()
+	var pp *PayloadPacket
+	if i >= 0 && i < len(u.packetRows) {
+		pp = &u.packetRows[i]
+	}
+	u.mu.Unlock()
+
+	if pp != nil {
+		u.modalMode = modalInspector
+		u.modal.Show("PACKET INSPECTOR", packetDetails(*pp), nil)
+	}
+}
+
+// messageRecipient is who F1 offers to send a message to: the selected
+// chaser, or else the balloon
+func (u *trackerUI) messageRecipient() string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.selectedChaser != "" {
+		return u.selectedChaser
+	}
+	return balloonCallsign()
+}
+
+// showAlerts opens the list of alerts with alert sel selected
+func (u *trackerUI) showAlerts(sel int) {
+	var lines []string
+	u.alertRows = nil
+	for _, al := range u.alerts.Alerts() {
+		mark := "*"
+		if al.Acked {
+			mark = " "
+		}
+		lines = append(lines, fmt.Sprintf("%v %v  %v", mark, al.Time.Format("15:04:05"), al.Text))
+		u.alertRows = append(u.alertRows, al.ID)
+	}
+	if len(lines) == 0 {
+		lines = []string{"No alerts."}
+	}
+	lines = append(lines, "", "* = not acknowledged.  ENTER acknowledges the selected alert,",
+		"A acknowledges all, any other key closes.")
+
+	u.modalMode = modalAlerts
+	u.modal.ShowChoices("ALERTS", lines, len(u.alertRows))
+	u.modal.MoveSelection(sel)
+}
+
+// showHelp lists every hot key, including the ones that don't fit in the
+// status bar
+func (u *trackerUI) showHelp() {
+	var lines []string
+	for _, hk := range hotKeys {
+		lines = append(lines, fmt.Sprintf("%-7v %v", hk.key, hk.help))
+	}
+	lines = append(lines, fmt.Sprintf("%-7v %v", "[^S]", "Redraw the screen"), "", "Press any key.")
+
+	u.modalMode = modalNotice
+	u.modal.Show("HOT KEYS", lines, nil)
+}
+
+func (u *trackerUI) notice(title, text string) {
+	u.modalMode = modalNotice
+	u.modal.Show(title, []string{text, "", "Press any key."}, nil)
+}
+
+func (u *trackerUI) closeModal() {
+	u.modalMode = modalNone
+	u.modal.Hide()
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/aprs"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"github.com/chrissnell/gophertrak/draw"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden compares got against testdata/name.golden, or rewrites the file
+// with -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		err := os.MkdirAll("testdata", 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = ioutil.WriteFile(path, []byte(got), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%v doesn't match %v\ngot:\n%v\nwant:\n%s", name, path, got, want)
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// setupFlight sets the flags and config that main would have, for a balloon
+// N0CALL-11 chased by N0CALL-9 with two other chasers
+func setupFlight(t *testing.T) {
+	t.Helper()
+	ballooncall, balloonssid = strPtr("N0CALL"), strPtr("11")
+	chasercall, chaserssid = strPtr("N0CALL"), strPtr("9")
+	config = &Config{}
+	chasers = map[string]bool{"KF7FVH-1": true, "A7COG-2": true}
+
+	if err := setUnits("imperial"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setCoordFormat(coordDD); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// hear records a position packet from call as the incoming handler would
+func hear(t *testing.T, a *APRSTNC, call string, p geospatial.Point, ts time.Time) {
+	t.Helper()
+	addr, err := parseAddress(call)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pp := PayloadPacket{data: aprs.APRSData{Position: p}, ts: ts}
+	pp.pkt.Source = addr
+
+	a.pr.Push(pp)
+	a.history.Push(pp)
+	if call == balloonCallsign() {
+		a.track.Push(pp)
+		a.pos.Set(p)
+	}
+	a.lastPacket[call] = pp
+	a.lastPosition[call] = pp
+}
+
+// testTracker is a UI with the balloon climbing 0.7 miles north of us and
+// one of the other chasers halfway between
+func testTracker(t *testing.T) (*trackerUI, *APRSTNC, PositionSource) {
+	setupFlight(t)
+
+	a := newAPRSTNC()
+	a.remotetnc = strPtr("10.50.0.25:6700")
+
+	g, err := newPositionSource(GPSConfig{Source: "fixed", Lat: 47.64, Lon: -122.3, Altitude: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.Start(context.Background())
+
+	// Heard a few seconds ago, so that LAST is a whole number of seconds
+	now := time.Now().Add(-5 * time.Second)
+	balloon := geospatial.Point{Lat: 47.65, Lon: -122.3, Speed: 20, Heading: 90}
+	for i, alt := range []float64{31400, 31900, 32400} {
+		balloon.Altitude = alt
+		hear(t, a, balloonCallsign(), balloon, now.Add(time.Duration(i-2)*30*time.Second))
+	}
+	hear(t, a, "KF7FVH-1", geospatial.Point{Lat: 47.645, Lon: -122.3}, now)
+
+	return newTrackerUI(), a, g
+}
+
+// renderTracker draws the whole UI into a 100x40 MemScreen
+func renderTracker(u *trackerUI) (*draw.MemScreen, screenLayout) {
+	return renderTrackerSize(u, 100, 40)
+}
+
+// renderTrackerSize draws the whole UI into a w x h MemScreen
+func renderTrackerSize(u *trackerUI, w, h int) (*draw.MemScreen, screenLayout) {
+	m := draw.NewMemScreen(w, h)
+	draw.Init(m)
+	draw.SetRoot(u)
+	draw.Render()
+	draw.SetRoot(nil)
+	return m, computeLayout(w-1, h-1)
+}
+
+func TestPayloadPanelGolden(t *testing.T) {
+	u, a, _ := testTracker(t)
+	u.refreshPayload(a)
+
+	m, l := renderTracker(u)
+	golden(t, "payload", m.Text(l.Payload))
+}
+
+func TestChasePanelGolden(t *testing.T) {
+	u, a, g := testTracker(t)
+	u.refreshChase(g, a)
+
+	m, l := renderTracker(u)
+	golden(t, "chase", m.Text(l.Chase))
+}
+
+func TestStatusBarGolden(t *testing.T) {
+	u, a, g := testTracker(t)
+	u.refreshStatus(a, g)
+
+	m, l := renderTracker(u)
+	golden(t, "status", m.Text(l.StatusBar))
+
+	a.Connected(true)
+	u.refreshStatus(a, g)
+	m, l = renderTracker(u)
+	golden(t, "status_connected", m.Text(l.StatusBar))
+}
+
+// However narrow the terminal, cutdown and exit stay in the status bar
+func TestStatusBarEssentials(t *testing.T) {
+	u, a, g := testTracker(t)
+	a.Connected(true)
+	u.refreshStatus(a, g)
+
+	for _, w := range []int{80, 100} {
+		m, l := renderTrackerSize(u, w, 40)
+		bar := m.Text(l.StatusBar)
+		golden(t, fmt.Sprintf("status_%v", w), bar)
+
+		for _, want := range []string{"[F7] Cutdown", "[ESC] Exit"} {
+			if !strings.Contains(bar, want) {
+				t.Errorf("%v columns: %q not in status bar %q", w, want, bar)
+			}
+		}
+	}
+}
+
+// The help screen lists the hot keys that don't fit in the status bar
+func TestHelp(t *testing.T) {
+	u, a, _ := testTracker(t)
+	if !u.HandleKey(draw.Event{Type: draw.EventKey, Ch: '?'}, a) {
+		t.Fatal("? quit")
+	}
+	if !u.modal.Visible() {
+		t.Fatal("? didn't open the help screen")
+	}
+
+	m, _ := renderTracker(u)
+	screen := m.String()
+	for _, hk := range hotKeys {
+		if !strings.Contains(screen, hk.key+" ") {
+			t.Errorf("%v missing from the help screen", hk.key)
+		}
+	}
+
+	u.HandleKey(draw.Event{Type: draw.EventKey, Key: draw.KeyEsc}, a)
+	if u.modal.Visible() {
+		t.Error("help screen still open after ESC")
+	}
+}
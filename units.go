@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dustin/go-humanize"
+	"math"
+	"sync"
+)
+
+// We keep altitudes in feet, speeds in mph, distances in miles and vertical
+// rates in ft/min, and only convert them when they're shown
+
+// unit is one way of showing a quantity
+type unit struct {
+	Label    string  // e.g. "km/h"
+	Spoken   string  // e.g. "kilometers per hour", for the announcer
+	Factor   float64 // Multiplied by our internal value
+	Decimals int
+}
+
+// Units is a set of units for each kind of quantity we show
+type Units struct {
+	Name     string
+	Altitude unit
+	Speed    unit
+	Distance unit
+	Rate     unit
+}
+
+var (
+	feet          = unit{Label: "feet", Spoken: "feet", Factor: 1}
+	meters        = unit{Label: "m", Spoken: "meters", Factor: 0.3048}
+	mph           = unit{Label: "mph", Spoken: "miles per hour", Factor: 1}
+	kph           = unit{Label: "km/h", Spoken: "kilometers per hour", Factor: 1.609344}
+	knots         = unit{Label: "kn", Spoken: "knots", Factor: 1 / knotsToMph}
+	miles         = unit{Label: "mi", Spoken: "miles", Factor: 1, Decimals: 1}
+	kilometers    = unit{Label: "km", Spoken: "kilometers", Factor: 1.609344, Decimals: 1}
+	nauticalMiles = unit{Label: "nm", Spoken: "nautical miles", Factor: 0.868976, Decimals: 1}
+	feetPerMin    = unit{Label: "ft/min", Spoken: "feet per minute", Factor: 1}
+	metersPerSec  = unit{Label: "m/s", Spoken: "meters per second", Factor: 0.3048 / 60, Decimals: 1}
+)
+
+// unitSystems are the units you can pick from, in the order the hot key
+// cycles through them
+var unitSystems = []Units{
+	{Name: "imperial", Altitude: feet, Speed: mph, Distance: miles, Rate: feetPerMin},
+	{Name: "metric", Altitude: meters, Speed: kph, Distance: kilometers, Rate: metersPerSec},
+	{Name: "nautical", Altitude: meters, Speed: knots, Distance: nauticalMiles, Rate: metersPerSec},
+	{Name: "aviation", Altitude: feet, Speed: knots, Distance: nauticalMiles, Rate: feetPerMin},
+}
+
+var (
+	unitsMu      sync.Mutex
+	currentUnits = unitSystems[0]
+)
+
+// units returns the units we're showing things in
+func units() Units {
+	unitsMu.Lock()
+	defer unitsMu.Unlock()
+	return currentUnits
+}
+
+// setUnits picks the units to show things in by name
+func setUnits(name string) error {
+	for _, us := range unitSystems {
+		if us.Name == name {
+			unitsMu.Lock()
+			currentUnits = us
+			unitsMu.Unlock()
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown units %q: use imperial, metric, nautical or aviation", name)
+}
+
+// cycleUnits switches to the next set of units and returns its name
+func cycleUnits() string {
+	unitsMu.Lock()
+	defer unitsMu.Unlock()
+	for i, us := range unitSystems {
+		if us.Name == currentUnits.Name {
+			currentUnits = unitSystems[(i+1)%len(unitSystems)]
+			break
+		}
+	}
+	return currentUnits.Name
+}
+
+// Value converts v from our internal units
+func (u unit) Value(v float64) float64 {
+	return v * u.Factor
+}
+
+// Number is v converted and formatted without its label, e.g. "32,400"
+func (u unit) Number(v float64) string {
+	v = u.Value(v)
+	if u.Decimals == 0 {
+		return humanize.Comma(int64(math.Floor(v + 0.5)))
+	}
+	return fmt.Sprintf("%.*f", u.Decimals, v)
+}
+
+// Format is v converted and labelled, e.g. "32,400 feet"
+func (u unit) Format(v float64) string {
+	return u.Number(v) + " " + u.Label
+}
+
+// Say is v converted for the announcer, rounded to the nearest step
+func (u unit) Say(v float64, step int) string {
+	v = u.Value(v)
+	if u.Decimals > 0 {
+		return fmt.Sprintf("%.*f %v", u.Decimals, v, u.Spoken)
+	}
+	return fmt.Sprintf("%d %v", roundTo(v, step), u.Spoken)
+}
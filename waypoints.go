@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/chrissnell/GoBalloon/geospatial"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Waypoint kinds
+const (
+	waypointLaunch  = "launch"
+	waypointLanding = "landing"
+	waypointFuel    = "fuel"
+	waypointNoGo    = "nogo"
+	waypointOther   = "other"
+)
+
+// How often waypoints are re-sent to the team as APRS objects
+const waypointTransmitInterval = 10 * time.Minute
+
+// waypointSymbols are the APRS symbols (table, code) we send each kind of
+// waypoint with
+var waypointSymbols = map[string][2]rune{
+	waypointLaunch:  {'/', ';'},  // Portable/campsite
+	waypointLanding: {'/', '.'},  // X
+	waypointFuel:    {'\\', '9'}, // Gas station
+	waypointNoGo:    {'\\', '!'}, // Emergency
+	waypointOther:   {'\\', '.'}, // Ambiguous
+}
+
+// WaypointConfig is a waypoint from the config file
+type WaypointConfig struct {
+	Name     string  `yaml:"name"`
+	Kind     string  `yaml:"kind"` // launch, landing, fuel, nogo or other
+	Lat      float64 `yaml:"lat"`
+	Lon      float64 `yaml:"lon"`
+	Altitude float64 `yaml:"altitude"` // Feet
+	Radius   float64 `yaml:"radius"`   // Miles; how far a no-go zone reaches
+	Transmit bool    `yaml:"transmit"` // Send it to the team as an APRS object
+}
+
+// Waypoint is a named place we care about
+type Waypoint struct {
+	Name     string
+	Kind     string
+	Pos      geospatial.Point
+	Radius   float64
+	Transmit bool
+}
+
+// Inside reports whether p is inside a no-go zone's radius
+func (w Waypoint) Inside(p geospatial.Point) bool {
+	return w.Kind == waypointNoGo && w.Radius > 0 && p.GreatCircleDistanceTo(w.Pos) <= w.Radius
+}
+
+// Object is the waypoint as an APRS object
+func (w Waypoint) Object() APRSObject {
+	sym, ok := waypointSymbols[w.Kind]
+	if !ok {
+		sym = waypointSymbols[waypointOther]
+	}
+	o := APRSObject{Name: w.Name, Pos: w.Pos, SymbolTable: sym[0], SymbolCode: sym[1]}
+	if w.Kind == waypointNoGo && w.Radius > 0 {
+		o.Comment = fmt.Sprintf("No-go zone, %v radius", units().Distance.Format(w.Radius))
+	}
+	return o
+}
+
+// waypointList holds our waypoints, sorted by name
+type waypointList struct {
+	sync.Mutex
+	list []Waypoint
+}
+
+var waypoints waypointList
+
+type byName []Waypoint
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+
+// Load adds the waypoints from the config file
+func (wl *waypointList) Load(cfgs []WaypointConfig) error {
+	for _, c := range cfgs {
+		w := Waypoint{
+			Name:     c.Name,
+			Kind:     c.Kind,
+			Pos:      geospatial.Point{Lat: c.Lat, Lon: c.Lon, Altitude: c.Altitude},
+			Radius:   c.Radius,
+			Transmit: c.Transmit,
+		}
+		if w.Kind == "" {
+			w.Kind = waypointOther
+		}
+		if _, ok := waypointSymbols[w.Kind]; !ok {
+			return fmt.Errorf("waypoint %v: unknown kind %q: use launch, landing, fuel, nogo or other", c.Name, c.Kind)
+		}
+		if err := wl.Add(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add adds a waypoint.  Names must be unique and short enough to send as an
+// APRS object.
+func (wl *waypointList) Add(w Waypoint) error {
+	w.Name = strings.TrimSpace(w.Name)
+	if w.Name == "" || len(w.Name) > 9 {
+		return fmt.Errorf("waypoint names must be 1-9 characters: %q", w.Name)
+	}
+	if w.Pos.Lat == 0 && w.Pos.Lon == 0 {
+		return fmt.Errorf("waypoint %v has no position", w.Name)
+	}
+
+	wl.Lock()
+	defer wl.Unlock()
+
+	for _, o := range wl.list {
+		if strings.EqualFold(o.Name, w.Name) {
+			return fmt.Errorf("there's already a waypoint called %v", o.Name)
+		}
+	}
+	wl.list = append(wl.list, w)
+	sort.Sort(byName(wl.list))
+
+	log.Printf("Added %v waypoint %v at %.5f, %.5f", w.Kind, w.Name, w.Pos.Lat, w.Pos.Lon)
+	return nil
+}
+
+// Remove deletes a waypoint and returns it
+func (wl *waypointList) Remove(name string) (Waypoint, bool) {
+	wl.Lock()
+	defer wl.Unlock()
+
+	for i, w := range wl.list {
+		if w.Name == name {
+			wl.list = append(wl.list[:i], wl.list[i+1:]...)
+			log.Printf("Removed waypoint %v", name)
+			return w, true
+		}
+	}
+	return Waypoint{}, false
+}
+
+// ToggleTransmit turns sending a waypoint as an APRS object on or off and
+// returns the waypoint as it now is
+func (wl *waypointList) ToggleTransmit(name string) (Waypoint, bool) {
+	wl.Lock()
+	defer wl.Unlock()
+
+	for i := range wl.list {
+		if wl.list[i].Name == name {
+			wl.list[i].Transmit = !wl.list[i].Transmit
+			return wl.list[i], true
+		}
+	}
+	return Waypoint{}, false
+}
+
+// List returns a copy of the waypoints
+func (wl *waypointList) List() []Waypoint {
+	wl.Lock()
+	defer wl.Unlock()
+
+	list := make([]Waypoint, len(wl.list))
+	copy(list, wl.list)
+	return list
+}
+
+// TransmitWaypoints sends the waypoints that are marked for it as APRS
+// objects, and keeps re-sending them so that latecomers see them too
+func TransmitWaypoints(ctx context.Context, a *APRSTNC) {
+	for {
+		for _, w := range waypoints.List() {
+			if w.Transmit {
+				sendWaypoint(a, w, false)
+			}
+		}
+		if !sleep(ctx, waypointTransmitInterval) {
+			return
+		}
+	}
+}
+
+// sendWaypoint sends a waypoint as an APRS object, or kills the object
+func sendWaypoint(a *APRSTNC, w Waypoint, kill bool) error {
+	o := w.Object()
+	o.Killed = kill
+	err := a.SendObject(o)
+	if err != nil {
+		log.Printf("Error sending waypoint %v: %v", w.Name, err)
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// webServer serves the tracker's state to browsers and mapping apps.  Every
+// handler reads from the same APRSTNC and GPS that drive the console UI.
+type webServer struct {
+	a      *APRSTNC
+	g      PositionSource
+	alerts *alertEngine
+	mux    *http.ServeMux
+}
+
+// startHTTPServer serves until ctx is done
+func startHTTPServer(ctx context.Context, addr string, a *APRSTNC, g PositionSource, alerts *alertEngine) {
+	w := &webServer{
+		a:      a,
+		g:      g,
+		alerts: alerts,
+		mux:    http.NewServeMux(),
+	}
+
+	w.mux.HandleFunc("/", w.handleDashboard)
+	w.mux.Handle("/ws", requireQueryToken(http.HandlerFunc(w.handleWebSocket)))
+	w.mux.Handle("/gophertrak.kml", requireQueryToken(http.HandlerFunc(w.handleNetworkLink)))
+	w.mux.Handle("/live.kml", requireQueryToken(http.HandlerFunc(w.handleLiveKML)))
+	w.mux.Handle("/geojson", requireReadToken(http.HandlerFunc(w.handleGeoJSON)))
+	w.registerAPI()
+
+	registerMetrics(a, g)
+	w.mux.Handle("/metrics", requireReadToken(promhttp.Handler()))
+
+	// Requests get our context so that long-lived ones like the dashboard's
+	// websocket notice when we shut down
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     w.mux,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		srv.Shutdown(sctx)
+	}()
+
+	log.Println("Starting HTTP server on", addr)
+	err := srv.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		log.Printf("HTTP server on %v failed: %v", addr, err)
+	}
+}